@@ -33,6 +33,7 @@ type MiddlewareDriver string
 type IdExtractorSource string
 type IdExtractorType string
 type AuthTypeEnum string
+type AuthModeEnum string
 type RoutingTriggerOnType string
 
 const (
@@ -69,6 +70,11 @@ const (
 	OAuthKey      AuthTypeEnum = "oauth_key"
 	UnsetAuth     AuthTypeEnum = ""
 
+	// AuthModeAll requires every enabled auth method to pass, this is the
+	// default. AuthModeAny accepts a request authenticated by any one of them.
+	AuthModeAll AuthModeEnum = "all"
+	AuthModeAny AuthModeEnum = "any"
+
 	// For routing triggers
 	All    RoutingTriggerOnType = "all"
 	Any    RoutingTriggerOnType = "any"
@@ -133,6 +139,8 @@ type HardTimeoutMeta struct {
 type TrackEndpointMeta struct {
 	Path   string `bson:"path" json:"path"`
 	Method string `bson:"method" json:"method"`
+	// SampleRate overrides the API analytics sample rate for the endpoint.
+	SampleRate float64 `bson:"sample_rate" json:"sample_rate,omitempty"`
 }
 
 type InternalMeta struct {
@@ -308,6 +316,15 @@ type CacheOptions struct {
 	EnableUpstreamCacheControl bool     `bson:"enable_upstream_cache_control" json:"enable_upstream_cache_control"`
 	CacheControlTTLHeader      string   `bson:"cache_control_ttl_header" json:"cache_control_ttl_header"`
 	CacheByHeaders             []string `bson:"cache_by_headers" json:"cache_by_headers"`
+	// StaleWhileRevalidate is the number of seconds after expiry during which
+	// a cached response is still served while it is refreshed in the background.
+	StaleWhileRevalidate int64 `bson:"stale_while_revalidate" json:"stale_while_revalidate"`
+	// StaleIfError is the number of seconds after expiry during which a cached
+	// response is served if the upstream fails with a 5xx or times out.
+	StaleIfError int64 `bson:"stale_if_error" json:"stale_if_error"`
+	// SurrogateKeyHeader is the upstream response header carrying the space
+	// separated surrogate keys of a response. Defaults to "Surrogate-Key".
+	SurrogateKeyHeader string `bson:"surrogate_key_header" json:"surrogate_key_header"`
 }
 
 type ResponseProcessor struct {
@@ -349,9 +366,48 @@ type OIDProviderConfig struct {
 	ClientIDs map[string]string `bson:"client_ids" json:"client_ids"`
 }
 
+// OIDUserInfoConfig controls the optional call to the provider's userinfo
+// endpoint after an ID token has been validated.
+type OIDUserInfoConfig struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Claims lists the userinfo claims merged into the session meta data.
+	Claims []string `bson:"claims" json:"claims"`
+	// AccessTokenHeaderName is the request header carrying the access token
+	// sent to the userinfo endpoint. It is required when Enabled is set.
+	AccessTokenHeaderName string `bson:"access_token_header_name" json:"access_token_header_name"`
+	// CacheTTL is the number of seconds a userinfo response is cached for.
+	CacheTTL int64 `bson:"cache_ttl" json:"cache_ttl"`
+}
+
 type OpenIDOptions struct {
 	Providers         []OIDProviderConfig `bson:"providers" json:"providers"`
 	SegregateByClient bool                `bson:"segregate_by_client" json:"segregate_by_client"`
+	// AllowedSigningAlgorithms restricts the accepted "alg" header values.
+	// When empty, the provider's id_token_signing_alg_values_supported is used.
+	AllowedSigningAlgorithms []string `bson:"allowed_signing_algorithms" json:"allowed_signing_algorithms"`
+	// ValidateAuthorizedParty enforces the "azp" rules from OpenID Connect Core 3.1.3.7.
+	ValidateAuthorizedParty bool `bson:"validate_azp" json:"validate_azp"`
+	// NonceHeaderName is the request header holding the nonce the client
+	// used in its authentication request. The "nonce" claim must match it.
+	NonceHeaderName string `bson:"nonce_header_name" json:"nonce_header_name"`
+	// ACRValues is the list of accepted "acr" claim values.
+	ACRValues []string          `bson:"acr_values" json:"acr_values"`
+	UserInfo  OIDUserInfoConfig `bson:"userinfo" json:"userinfo"`
+}
+
+// JWTClaimRule declares a check applied to the claims of a validated JWT.
+type JWTClaimRule struct {
+	Name string `bson:"name" json:"name"`
+	// Claim is the claim name, nested claims can be addressed with dot notation.
+	Claim    string `bson:"claim" json:"claim"`
+	Required bool   `bson:"required" json:"required"`
+	// Values lists accepted values. For list claims such as "aud" any element may match.
+	Values []string `bson:"values" json:"values"`
+	Regex  string   `bson:"regex" json:"regex"`
+	// Path and Method restrict the rule to matching requests. Path is a regular
+	// expression matched against the request path without the listen path.
+	Path   string `bson:"path" json:"path"`
+	Method string `bson:"method" json:"method"`
 }
 
 // APIDefinition represents the configuration for a single proxied API and it's versions.
@@ -389,6 +445,7 @@ type APIDefinition struct {
 	ClientCertificates         []string             `bson:"client_certificates" json:"client_certificates"`
 	UpstreamCertificates       map[string]string    `bson:"upstream_certificates" json:"upstream_certificates"`
 	PinnedPublicKeys           map[string]string    `bson:"pinned_public_keys" json:"pinned_public_keys"`
+	CertificateBoundTokens     bool                 `bson:"certificate_bound_tokens" json:"certificate_bound_tokens"`
 	EnableJWT                  bool                 `bson:"enable_jwt" json:"enable_jwt"`
 	UseStandardAuth            bool                 `bson:"use_standard_auth" json:"use_standard_auth"`
 	UseGoPluginAuth            bool                 `bson:"use_go_plugin_auth" json:"use_go_plugin_auth"`
@@ -405,12 +462,14 @@ type APIDefinition struct {
 	JWTSkipKid                 bool                 `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
 	JWTScopeToPolicyMapping    map[string]string    `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"`
 	JWTScopeClaimName          string               `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`
+	JWTClaimRules              []JWTClaimRule       `bson:"jwt_claim_rules" json:"jwt_claim_rules"`
 	NotificationsDetails       NotificationsManager `bson:"notifications" json:"notifications"`
 	EnableSignatureChecking    bool                 `bson:"enable_signature_checking" json:"enable_signature_checking"`
 	HmacAllowedClockSkew       float64              `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
 	HmacAllowedAlgorithms      []string             `bson:"hmac_allowed_algorithms" json:"hmac_allowed_algorithms"`
 	RequestSigning             RequestSigningMeta   `bson:"request_signing" json:"request_signing"`
 	BaseIdentityProvidedBy     AuthTypeEnum         `bson:"base_identity_provided_by" json:"base_identity_provided_by"`
+	AuthMode                   AuthModeEnum         `bson:"auth_mode" json:"auth_mode"`
 	VersionDefinition          struct {
 		Location  string `bson:"location" json:"location"`
 		Key       string `bson:"key" json:"key"`
@@ -461,6 +520,9 @@ type APIDefinition struct {
 	StripAuthData             bool                   `bson:"strip_auth_data" json:"strip_auth_data"`
 	EnableDetailedRecording   bool                   `bson:"enable_detailed_recording" json:"enable_detailed_recording"`
 	GraphQL                   GraphQLConfig          `bson:"graphql" json:"graphql"`
+	ExternalAuthz             ExternalAuthzConfig    `bson:"external_authz" json:"external_authz"`
+	AnalyticsSampling         AnalyticsSampling      `bson:"analytics_sampling" json:"analytics_sampling"`
+	AnalyticsRedaction        AnalyticsRedaction     `bson:"analytics_redaction" json:"analytics_redaction"`
 }
 
 type AuthConfig struct {
@@ -505,6 +567,86 @@ type RequestSigningMeta struct {
 	SignatureHeader string   `bson:"signature_header" json:"signature_header"`
 }
 
+// AnalyticsSampling records analytics for a share of the requests only. The
+// decision is made when a request comes in, each record then carries the
+// number of requests it stands for.
+type AnalyticsSampling struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Rate is the share of requests recorded, between 0 and 1. Tracked
+	// endpoints can override it.
+	Rate float64 `bson:"rate" json:"rate"`
+	// AlwaysRecordErrors records every request answered with a 4xx or 5xx.
+	AlwaysRecordErrors bool `bson:"always_record_errors" json:"always_record_errors"`
+	// SlowRequestThreshold records every request that took longer, in
+	// milliseconds.
+	SlowRequestThreshold int64 `bson:"slow_request_threshold" json:"slow_request_threshold"`
+}
+
+// AnalyticsRedaction masks personal data in detailed analytics records. The
+// gateway wide rules apply on top of the ones of an API, the replacement of an
+// API takes precedence.
+type AnalyticsRedaction struct {
+	// Headers are masked in requests and responses.
+	Headers []string `bson:"headers" json:"headers"`
+	// BodyFields are dot separated paths of JSON body fields to mask, e.g.
+	// "user.email". "*" matches any key or array element, arrays are
+	// otherwise traversed. Single key paths also mask form fields.
+	BodyFields []string `bson:"body_fields" json:"body_fields"`
+	// Patterns are regular expressions masked in bodies, header values and
+	// the request URL, e.g. card numbers.
+	Patterns []string `bson:"patterns" json:"patterns"`
+	// QueryParams are removed from the request URL.
+	QueryParams []string `bson:"query_params" json:"query_params"`
+	// Replacement defaults to "[REDACTED]".
+	Replacement string `bson:"replacement" json:"replacement"`
+}
+
+// ExternalAuthzConfig configures an external decision service that is asked
+// to allow or deny each request after it has been authenticated.
+type ExternalAuthzConfig struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Driver is either "http" (default) or "grpc".
+	Driver string `bson:"driver" json:"driver"`
+	// URL is the decision endpoint for the http driver, or the target
+	// address for the grpc driver.
+	URL string `bson:"url" json:"url"`
+	// GRPCMethod is the full method name invoked by the grpc driver.
+	GRPCMethod string `bson:"grpc_method" json:"grpc_method"`
+	// Timeout for a single decision request, in milliseconds.
+	Timeout int64 `bson:"timeout" json:"timeout"`
+	// FailOpen lets requests through when the decision service cannot be
+	// reached or returns an invalid response.
+	FailOpen bool `bson:"fail_open" json:"fail_open"`
+	// CacheTTL caches decisions, in seconds. Decisions are cached per method,
+	// path, identity and the headers sent, so it is only effective together
+	// with IncludeHeaders.
+	CacheTTL int64 `bson:"cache_ttl" json:"cache_ttl"`
+	// IncludeHeaders limits the request headers sent to the decision
+	// service. All headers are sent when empty.
+	IncludeHeaders []string `bson:"include_headers" json:"include_headers"`
+	// TLS configures the connection to the decision service. The http
+	// driver applies it to https URLs, the grpc driver only dials with TLS
+	// when it is enabled.
+	TLS ExternalAuthzTLS `bson:"tls" json:"tls"`
+}
+
+// ExternalAuthzTLS configures TLS for the connection to the external
+// decision service.
+type ExternalAuthzTLS struct {
+	// Enabled dials the grpc decision service with TLS.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// CACertificates are the IDs of the certificates trusted to verify the
+	// decision service. The system roots are used when empty.
+	CACertificates []string `bson:"ca_certificates" json:"ca_certificates"`
+	// Certificate is the ID of the client certificate presented to the
+	// decision service.
+	Certificate string `bson:"certificate" json:"certificate"`
+	// ServerName overrides the name the service certificate is verified
+	// against.
+	ServerName         string `bson:"server_name" json:"server_name"`
+	InsecureSkipVerify bool   `bson:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
 type ProxyConfig struct {
 	PreserveHostHeader          bool                          `bson:"preserve_host_header" json:"preserve_host_header"`
 	ListenPath                  string                        `bson:"listen_path" json:"listen_path"`
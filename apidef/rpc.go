@@ -28,3 +28,44 @@ type KeysValuesPair struct {
 	Keys   []string
 	Values []string
 }
+
+// Types of the changes pushed by the control plane.
+const (
+	ChangeAPI         = "api"
+	ChangePolicy      = "policy"
+	ChangeKey         = "key"
+	ChangeCertificate = "certificate"
+)
+
+// WatchRequest asks the control plane for the changes made after Cursor. The
+// call is held until there are changes or Timeout seconds have passed.
+type WatchRequest struct {
+	OrgID   string
+	GroupID string
+	Cursor  string
+	Timeout int64
+}
+
+// ChangeEvent is a change of the control plane. Keys holds the changed keys
+// in the keyspace update format, or the certificate IDs.
+type ChangeEvent struct {
+	Type string
+	Keys []string
+}
+
+// WatchResponse holds the changes following the cursor of a WatchRequest and
+// the cursor to resume from. Reset is set when the requested cursor is too
+// old to resume from.
+type WatchResponse struct {
+	Cursor string
+	Events []ChangeEvent
+	Reset  bool
+}
+
+// IncrementRequest increments a counter of the control plane by Delta, the
+// counter expires after Expire seconds when it is created.
+type IncrementRequest struct {
+	KeyName string
+	Delta   int64
+	Expire  int64
+}
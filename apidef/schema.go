@@ -39,6 +39,46 @@ const Schema = `{
         "do_not_track": {
             "type": "boolean"
         },
+        "analytics_redaction": {
+            "type": ["object", "null"],
+            "properties": {
+                "headers": {
+                    "type": ["array", "null"]
+                },
+                "body_fields": {
+                    "type": ["array", "null"]
+                },
+                "patterns": {
+                    "type": ["array", "null"]
+                },
+                "query_params": {
+                    "type": ["array", "null"]
+                },
+                "replacement": {
+                    "type": "string"
+                }
+            }
+        },
+        "analytics_sampling": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "rate": {
+                    "type": "number",
+                    "minimum": 0,
+                    "maximum": 1
+                },
+                "always_record_errors": {
+                    "type": "boolean"
+                },
+                "slow_request_threshold": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
         "enable_jwt": {
             "type": "boolean"
         },
@@ -57,12 +97,34 @@ const Schema = `{
         "enable_coprocess_auth": {
             "type": "boolean"
         },
+        "certificate_bound_tokens": {
+            "type": "boolean"
+        },
+        "jwt_claim_rules": {
+            "type": ["array", "null"]
+        },
+        "external_authz": {
+            "type": ["object", "null"],
+            "properties": {
+                "driver": {
+                    "type": "string",
+                    "enum": ["", "http", "grpc"]
+                },
+                "include_headers": {
+                    "type": ["array", "null"]
+                }
+            }
+        },
         "jwt_skip_kid": {
             "type": "boolean"
         },
         "base_identity_provided_by": {
             "type": "string"
         },
+        "auth_mode": {
+            "type": "string",
+            "enum": ["", "all", "any"]
+        },
         "disable_rate_limit": {
             "type": "boolean"
         },
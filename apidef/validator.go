@@ -3,6 +3,8 @@ package apidef
 import (
 	"errors"
 	"strings"
+
+	"github.com/TykTechnologies/tyk/regexp"
 )
 
 type ValidationResult struct {
@@ -51,6 +53,7 @@ type ValidationRuleSet []ValidationRule
 
 var DefaultValidationRuleSet = ValidationRuleSet{
 	&RuleUniqueDataSourceNames{},
+	&RuleValidJWTClaimRules{},
 }
 
 func Validate(definition *APIDefinition, ruleSet ValidationRuleSet) ValidationResult {
@@ -91,3 +94,31 @@ func (r *RuleUniqueDataSourceNames) Validate(apiDef *APIDefinition, validationRe
 		usedNames[trimmedName] = true
 	}
 }
+
+var (
+	ErrJWTClaimRuleWithoutClaim = errors.New("jwt claim rule must name a claim")
+	ErrJWTClaimRuleInvalidRegex = errors.New("jwt claim rule has an invalid regular expression")
+)
+
+type RuleValidJWTClaimRules struct{}
+
+func (r *RuleValidJWTClaimRules) Validate(apiDef *APIDefinition, validationResult *ValidationResult) {
+	for _, rule := range apiDef.JWTClaimRules {
+		if strings.TrimSpace(rule.Claim) == "" {
+			validationResult.IsValid = false
+			validationResult.AppendError(ErrJWTClaimRuleWithoutClaim)
+			return
+		}
+
+		for _, expr := range []string{rule.Regex, rule.Path} {
+			if expr == "" {
+				continue
+			}
+			if _, err := regexp.Compile(expr); err != nil {
+				validationResult.IsValid = false
+				validationResult.AppendError(ErrJWTClaimRuleInvalidRegex)
+				return
+			}
+		}
+	}
+}
@@ -119,3 +119,53 @@ func TestRuleUniqueDataSourceNames_Validate(t *testing.T) {
 	))
 
 }
+
+func TestRuleValidJWTClaimRules_Validate(t *testing.T) {
+	ruleSet := ValidationRuleSet{
+		&RuleValidJWTClaimRules{},
+	}
+
+	t.Run("should return invalid when claim is missing", runValidationTest(
+		&APIDefinition{
+			JWTClaimRules: []JWTClaimRule{
+				{Name: "no-claim", Values: []string{"a"}},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: false,
+			Errors: []error{
+				ErrJWTClaimRuleWithoutClaim,
+			},
+		},
+	))
+
+	t.Run("should return invalid when regex does not compile", runValidationTest(
+		&APIDefinition{
+			JWTClaimRules: []JWTClaimRule{
+				{Name: "bad-regex", Claim: "sub", Regex: "(["},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: false,
+			Errors: []error{
+				ErrJWTClaimRuleInvalidRegex,
+			},
+		},
+	))
+
+	t.Run("should return valid for well formed rules", runValidationTest(
+		&APIDefinition{
+			JWTClaimRules: []JWTClaimRule{
+				{Name: "issuer", Claim: "iss", Values: []string{"https://idp"}},
+				{Name: "role", Claim: "realm_access.roles", Regex: "^admin$", Path: "^/admin"},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+}
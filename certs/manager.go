@@ -10,6 +10,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
@@ -97,6 +98,13 @@ func HexSHA256(cert []byte) string {
 	return hex.EncodeToString(certSHA[:])
 }
 
+// X5tS256 returns the "x5t#S256" thumbprint of a DER encoded certificate, as
+// used for certificate-bound access tokens (RFC 8705).
+func X5tS256(cert []byte) string {
+	certSHA := sha256.Sum256(cert)
+	return base64.RawURLEncoding.EncodeToString(certSHA[:])
+}
+
 func ParsePEM(data []byte, secret string) ([]*pem.Block, error) {
 	var pemBlocks []*pem.Block
 
@@ -84,6 +84,10 @@ func (s *dummyStorage) RemoveFromList(keyName, value string) error {
 	return nil
 }
 
+func (s *dummyStorage) TrimList(keyName string, from, to int64) error {
+	return nil
+}
+
 func (s *dummyStorage) GetListRange(keyName string, from, to int64) ([]string, error) {
 	for key := range s.indexList {
 		if key == keyName {
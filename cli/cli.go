@@ -10,7 +10,9 @@ import (
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/TykTechnologies/tyk/cli/bundler"
+	"github.com/TykTechnologies/tyk/cli/gitsync"
 	"github.com/TykTechnologies/tyk/cli/importer"
+	"github.com/TykTechnologies/tyk/cli/namespace"
 	logger "github.com/TykTechnologies/tyk/log"
 )
 
@@ -100,6 +102,12 @@ func Init(version string, confPaths []string) {
 
 	// Add bundler commands:
 	bundler.AddTo(app)
+
+	// Add namespace migration command:
+	namespace.AddTo(app, confPaths)
+
+	// Add sync command:
+	gitsync.AddTo(app, confPaths)
 }
 
 // Parse parses the command-line arguments.
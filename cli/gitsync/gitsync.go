@@ -0,0 +1,178 @@
+package gitsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const (
+	cmdName = "sync"
+	cmdDesc = "Syncs the APIs, policies and certificates of the sync directory to a running gateway"
+)
+
+var syncer *Syncer
+
+// Syncer wraps the sync command.
+type Syncer struct {
+	confPaths []string
+	conf      *string
+	gateway   *string
+	secret    *string
+	plan      *bool
+
+	out io.Writer
+}
+
+// Change is a change of the sync plan.
+type Change struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	File   string `json:"file"`
+}
+
+// Plan lists the changes between the loaded objects and the sync directory.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+func init() {
+	syncer = &Syncer{out: os.Stdout}
+}
+
+// AddTo initializes a syncer object.
+func AddTo(app *kingpin.Application, confPaths []string) {
+	cmd := app.Command(cmdName, cmdDesc)
+	syncer.confPaths = confPaths
+	syncer.conf = cmd.Flag("conf", "load a named configuration file").PlaceHolder("FILE").String()
+	syncer.gateway = cmd.Flag("gateway", "the gateway control API address (defaults to the local gateway)").PlaceHolder("URL").String()
+	syncer.secret = cmd.Flag("secret", "the gateway secret (defaults to the secret of the configuration)").String()
+	syncer.plan = cmd.Flag("plan", "only show the changes, without applying them").Bool()
+	cmd.Action(syncer.Sync)
+}
+
+// Sync asks the gateway to sync, or only to plan the sync.
+func (s *Syncer) Sync(ctx *kingpin.ParseContext) error {
+	if err := s.run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+	return nil
+}
+
+func (s *Syncer) run() error {
+	paths := s.confPaths
+	if *s.conf != "" {
+		paths = []string{*s.conf}
+	}
+	var conf config.Config
+	if err := config.Load(paths, &conf); err != nil {
+		return err
+	}
+
+	gateway := *s.gateway
+	if gateway == "" {
+		gateway = controlAPIAddress(conf)
+	}
+	secret := *s.secret
+	if secret == "" {
+		secret = conf.Secret
+	}
+
+	method, path := http.MethodPost, "/tyk/sync"
+	if *s.plan {
+		method, path = http.MethodGet, "/tyk/sync/plan"
+	}
+	plan, err := call(method, strings.TrimSuffix(gateway, "/")+path, secret)
+	if err != nil {
+		return err
+	}
+	s.print(plan, *s.plan)
+	return nil
+}
+
+func controlAPIAddress(conf config.Config) string {
+	scheme := "http"
+	if conf.HttpServerOptions.UseSSL {
+		scheme = "https"
+	}
+	port := conf.ListenPort
+	if conf.ControlAPIPort != 0 {
+		port = conf.ControlAPIPort
+	}
+	host := conf.ListenAddress
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return scheme + "://" + host + ":" + strconv.Itoa(port)
+}
+
+func call(method, url, secret string) (*Plan, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(headers.XTykAuthorization, secret)
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return nil, errors.New(apiErr.Message)
+	}
+
+	plan := &Plan{}
+	if err := json.NewDecoder(resp.Body).Decode(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+var actionSigns = map[string]string{"create": "+", "update": "~", "delete": "-"}
+
+func (s *Syncer) print(plan *Plan, dryRun bool) {
+	if len(plan.Changes) == 0 {
+		fmt.Fprintln(s.out, "No changes, the gateway is in sync.")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, c := range plan.Changes {
+		counts[c.Action]++
+		line := fmt.Sprintf("%s %s %s", actionSigns[c.Action], c.Kind, c.ID)
+		if c.File != "" {
+			line += " (" + c.File + ")"
+		}
+		fmt.Fprintln(s.out, line)
+	}
+
+	format := "Applied: %d created, %d updated, %d deleted.\n"
+	if dryRun {
+		format = "Plan: %d to create, %d to update, %d to delete.\n"
+	}
+	fmt.Fprintf(s.out, format, counts["create"], counts["update"], counts["delete"])
+}
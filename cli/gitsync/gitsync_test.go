@@ -0,0 +1,48 @@
+package gitsync
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestPlan(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headers.XTykAuthorization) != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Attempted administrative access with invalid or missing key!"}`))
+			return
+		}
+		w.Write([]byte(`{"changes":[
+			{"kind":"certificate","id":"cert","action":"delete"},
+			{"kind":"api","id":"api","action":"create","file":"apis/api.json"}
+		]}`))
+	}))
+	defer ts.Close()
+
+	if _, err := call(http.MethodGet, ts.URL+"/tyk/sync/plan", "wrong"); err == nil || err.Error() != "Attempted administrative access with invalid or missing key!" {
+		t.Errorf("expected the gateway error, got %v", err)
+	}
+
+	plan, err := call(http.MethodGet, ts.URL+"/tyk/sync/plan", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s := &Syncer{out: &out}
+	s.print(plan, true)
+	want := "- certificate cert\n+ api api (apis/api.json)\nPlan: 1 to create, 0 to update, 1 to delete.\n"
+	if out.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	s.print(&Plan{}, true)
+	if out.String() != "No changes, the gateway is in sync.\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
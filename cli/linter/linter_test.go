@@ -69,7 +69,7 @@ var tests = []struct {
 	},
 	{
 		"BadStorageType", `{"storage": {"type": "cd-rom"}}`,
-		`storage.type: storage.type must be one of the following: "", "redis"`,
+		`storage.type: storage.type must be one of the following: "", "redis", "embedded"`,
 	},
 	{
 		"BadPolicySource", `{"policies": {"policy_source": "internet"}}`,
@@ -0,0 +1,74 @@
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	cmdName = "migrate-namespace"
+	cmdDesc = "Moves the Redis keys into the configured key namespace"
+)
+
+var mig *Migrator
+
+// Migrator wraps the namespace migration.
+type Migrator struct {
+	confPaths []string
+	conf      *string
+	from      *string
+	to        *string
+	dryRun    *bool
+}
+
+func init() {
+	mig = &Migrator{}
+}
+
+// AddTo initializes a migrator object.
+func AddTo(app *kingpin.Application, confPaths []string) {
+	cmd := app.Command(cmdName, cmdDesc)
+	mig.confPaths = confPaths
+	mig.conf = cmd.Flag("conf", "load a named configuration file").PlaceHolder("FILE").String()
+	mig.from = cmd.Flag("from", "the namespace the keys are in, empty for keys without a namespace").String()
+	mig.to = cmd.Flag("to", "the namespace to move the keys to (defaults to storage.namespace of the configuration)").String()
+	mig.dryRun = cmd.Flag("dry-run", "only count the keys to move").Bool()
+	cmd.Action(mig.Migrate)
+}
+
+// Migrate performs the migration.
+func (m *Migrator) Migrate(ctx *kingpin.ParseContext) error {
+	paths := m.confPaths
+	if *m.conf != "" {
+		paths = []string{*m.conf}
+	}
+	var conf config.Config
+	if err := config.Load(paths, &conf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.SetGlobal(conf)
+
+	to := conf.Storage.Namespace
+	if *m.to != "" {
+		to = *m.to
+	}
+	moved, err := storage.MigrateNamespace(context.Background(), *m.from, to, *m.dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *m.dryRun {
+		fmt.Printf("%d keys to move into namespace %q\n", moved, to)
+	} else {
+		fmt.Printf("moved %d keys into namespace %q\n", moved, to)
+	}
+	os.Exit(0)
+	return nil
+}
@@ -93,6 +93,12 @@ type StorageOptionsConf struct {
 	EnableCluster         bool              `json:"enable_cluster"`
 	UseSSL                bool              `json:"use_ssl"`
 	SSLInsecureSkipVerify bool              `json:"ssl_insecure_skip_verify"`
+	// Path is the database file of the embedded storage type.
+	Path string `json:"path"`
+	// Namespace is prepended to every Redis key and pub/sub channel, so
+	// several gateway clusters can share a Redis. Only the namespace of
+	// the main storage is used.
+	Namespace string `json:"namespace"`
 }
 
 type NormalisedURLConfig struct {
@@ -119,7 +125,38 @@ type AnalyticsConfigConfig struct {
 	PoolSize                int                 `json:"pool_size"`
 	RecordsBufferSize       uint64              `json:"records_buffer_size"`
 	StorageExpirationTime   int                 `json:"storage_expiration_time"`
-	ignoredIPsCompiled      map[string]bool
+	// Sinks are the destinations analytics records are written to. Records
+	// go to Redis for Tyk Pump when no sink is configured, or when none of
+	// them could be initialised.
+	Sinks []AnalyticsSinkConfig `json:"sinks"`
+	// Redaction rules apply to the detailed records of every API.
+	Redaction          apidef.AnalyticsRedaction `json:"redaction"`
+	ignoredIPsCompiled map[string]bool
+}
+
+// AnalyticsSinkConfig configures a destination for analytics records.
+type AnalyticsSinkConfig struct {
+	// Type is one of "redis", "file", "syslog", "http" or "kafka".
+	Type string `json:"type"`
+	// Path of the newline-delimited JSON file. It is rotated once it grows
+	// over MaxSize megabytes (100 by default), keeping MaxBackups old files
+	// (5 by default).
+	Path       string `json:"path"`
+	MaxSize    int    `json:"max_size"`
+	MaxBackups int    `json:"max_backups"`
+	// Network is "udp" or "tcp", Address is the syslog collector address and
+	// Tag the syslog app name.
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Tag     string `json:"tag"`
+	// URL records are posted to in batches, as a JSON array.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Brokers and Topic of the Kafka sink.
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// Timeout in milliseconds for the network sinks.
+	Timeout int64 `json:"timeout"`
 }
 
 type HealthCheckConfig struct {
@@ -152,6 +189,18 @@ type WebHookHandlerConf struct {
 	TemplatePath string            `bson:"template_path" json:"template_path"`
 	HeaderList   map[string]string `bson:"header_map" json:"header_map"`
 	EventTimeout int64             `bson:"event_timeout" json:"event_timeout"`
+	// MaxRetries is how many times a failed delivery is retried, waiting
+	// RetryInterval milliseconds before the first retry and doubling the
+	// wait after each one.
+	MaxRetries    int   `bson:"max_retries" json:"max_retries"`
+	RetryInterval int64 `bson:"retry_interval" json:"retry_interval"`
+	// DeadLetter keeps deliveries that failed after all retries, so they can
+	// be listed and replayed with the control API.
+	DeadLetter bool `bson:"dead_letter" json:"dead_letter"`
+	// Secret signs the request body with HMAC-SHA256, the signature is sent
+	// in SignatureHeader (X-Tyk-Signature by default).
+	Secret          string `bson:"secret" json:"secret"`
+	SignatureHeader string `bson:"signature_header" json:"signature_header"`
 }
 
 type SlaveOptionsConfig struct {
@@ -169,6 +218,59 @@ type SlaveOptionsConfig struct {
 	PingTimeout                     int     `json:"ping_timeout"`
 	RPCPoolSize                     int     `json:"rpc_pool_size"`
 	KeySpaceSyncInterval            float32 `json:"key_space_sync_interval"`
+	// EnablePushSync keeps a watch call open on the control plane, which
+	// pushes API, policy, key and certificate changes as they happen instead
+	// of the gateway polling for them.
+	EnablePushSync bool `json:"enable_push_sync"`
+	// PushSyncTimeout is the time in seconds the control plane holds a watch
+	// call without changes, defaults to 30.
+	PushSyncTimeout int `json:"push_sync_timeout"`
+	// WriteBack keeps session changes and counter increments in the local
+	// Redis while the RPC connection is down and replays them on reconnect.
+	WriteBack RPCWriteBackConfig `json:"write_back"`
+}
+
+// Conflict resolution rules of the RPC write-back.
+const (
+	WriteBackNewestWins = "newest_wins"
+	WriteBackLocalWins  = "local_wins"
+	WriteBackRemoteWins = "remote_wins"
+)
+
+type RPCWriteBackConfig struct {
+	Enabled bool `json:"enabled"`
+	// ConflictResolution decides which copy of a session changed during an
+	// outage is kept when the control plane has one too. "newest_wins", the
+	// default, compares the last_updated field of both sessions while
+	// "local_wins" and "remote_wins" always keep the same side.
+	ConflictResolution string `json:"conflict_resolution"`
+}
+
+// SyncConfig configures the sync of API definitions, policies and
+// certificates from a directory. The directory holds the apis, policies and
+// certs directories, policy files have the format of the policy file.
+type SyncConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path is the directory to sync from, it can be a git checkout.
+	Path string `json:"path"`
+	// GitPull runs git pull in Path before each scan.
+	GitPull bool `json:"git_pull"`
+	// Interval is the number of seconds between scans, defaults to 10.
+	Interval int `json:"interval"`
+}
+
+// ResponseCacheL1Conf configures an in-memory tier in front of the Redis
+// response cache. It is local to each node.
+type ResponseCacheL1Conf struct {
+	Enabled bool `json:"enabled"`
+	// MaxEntries bounds the number of cached responses, defaults to 1000.
+	MaxEntries int `json:"max_entries"`
+	// MaxSize bounds the total size of the cached responses in bytes,
+	// defaults to 64MB.
+	MaxSize int64 `json:"max_size"`
+	// TTL is the longest time in seconds a response is kept in memory. It
+	// is always capped at the Redis TTL of the entry.
+	TTL int64 `json:"ttl"`
 }
 
 type LocalSessionCacheConf struct {
@@ -242,6 +344,9 @@ type SecurityConfig struct {
 	ControlAPIUseMutualTLS           bool               `json:"control_api_use_mutual_tls"`
 	PinnedPublicKeys                 map[string]string  `json:"pinned_public_keys"`
 	Certificates                     CertificatesConfig `json:"certificates"`
+	// CertificateExpiryWarningDays fires CertificateExpiringSoon events for
+	// certificates in use that expire within this many days.
+	CertificateExpiryWarningDays int `json:"certificate_expiry_warning_days"`
 }
 
 type NewRelicConfig struct {
@@ -249,6 +354,15 @@ type NewRelicConfig struct {
 	LicenseKey string `json:"license_key"`
 }
 
+// PrometheusConfig exposes gateway metrics in the Prometheus text format on
+// the control API. Unless control_api_port is set, scrapes must carry the
+// gateway secret like any other control API call.
+type PrometheusConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path of the metrics endpoint, "/metrics" by default.
+	Path string `json:"path"`
+}
+
 type Tracer struct {
 	// The name of the tracer to initialize. For instance appdash, to use appdash
 	// tracer
@@ -332,6 +446,7 @@ type Config struct {
 	HashKeyFunction         string         `json:"hash_key_function"`
 	EnableHashedKeysListing bool           `json:"enable_hashed_keys_listing"`
 	MinTokenLength          int            `json:"min_token_length"`
+	KeyRotationGracePeriod  int64          `json:"key_rotation_grace_period"`
 	EnableAPISegregation    bool           `json:"enable_api_segregation"`
 	TemplatePath            string         `json:"template_path"`
 	Policies                PoliciesConfig `json:"policies"`
@@ -414,6 +529,7 @@ type Config struct {
 	LocalSessionCache        LocalSessionCacheConf `json:"local_session_cache"`
 	EnableSeperateCacheStore bool                  `json:"enable_separate_cache_store"`
 	CacheStorage             StorageOptionsConf    `json:"cache_storage"`
+	ResponseCacheL1          ResponseCacheL1Conf   `json:"response_cache_l1"`
 
 	// Middleware/Plugin Configuration
 	EnableBundleDownloader       bool            `bson:"enable_bundle_downloader" json:"enable_bundle_downloader"`
@@ -429,26 +545,27 @@ type Config struct {
 	IgnoreCanonicalMIMEHeaderKey bool            `json:"ignore_canonical_mime_header_key"`
 
 	// Monitoring, Logging & Profiling
-	LogLevel                string         `json:"log_level"`
-	HealthCheckEndpointName string         `json:"health_check_endpoint_name"`
-	Tracer                  Tracer         `json:"tracing"`
-	NewRelic                NewRelicConfig `json:"newrelic"`
-	HTTPProfile             bool           `json:"enable_http_profiler"`
-	UseRedisLog             bool           `json:"use_redis_log"`
-	SentryCode              string         `json:"sentry_code"`
-	SentryLogLevel          string         `json:"sentry_log_level"`
-	UseSentry               bool           `json:"use_sentry"`
-	UseSyslog               bool           `json:"use_syslog"`
-	UseGraylog              bool           `json:"use_graylog"`
-	UseLogstash             bool           `json:"use_logstash"`
-	Track404Logs            bool           `json:"track_404_logs"`
-	GraylogNetworkAddr      string         `json:"graylog_network_addr"`
-	LogstashNetworkAddr     string         `json:"logstash_network_addr"`
-	SyslogTransport         string         `json:"syslog_transport"`
-	LogstashTransport       string         `json:"logstash_transport"`
-	SyslogNetworkAddr       string         `json:"syslog_network_addr"`
-	StatsdConnectionString  string         `json:"statsd_connection_string"`
-	StatsdPrefix            string         `json:"statsd_prefix"`
+	LogLevel                string           `json:"log_level"`
+	HealthCheckEndpointName string           `json:"health_check_endpoint_name"`
+	Tracer                  Tracer           `json:"tracing"`
+	NewRelic                NewRelicConfig   `json:"newrelic"`
+	Prometheus              PrometheusConfig `json:"prometheus"`
+	HTTPProfile             bool             `json:"enable_http_profiler"`
+	UseRedisLog             bool             `json:"use_redis_log"`
+	SentryCode              string           `json:"sentry_code"`
+	SentryLogLevel          string           `json:"sentry_log_level"`
+	UseSentry               bool             `json:"use_sentry"`
+	UseSyslog               bool             `json:"use_syslog"`
+	UseGraylog              bool             `json:"use_graylog"`
+	UseLogstash             bool             `json:"use_logstash"`
+	Track404Logs            bool             `json:"track_404_logs"`
+	GraylogNetworkAddr      string           `json:"graylog_network_addr"`
+	LogstashNetworkAddr     string           `json:"logstash_network_addr"`
+	SyslogTransport         string           `json:"syslog_transport"`
+	LogstashTransport       string           `json:"logstash_transport"`
+	SyslogNetworkAddr       string           `json:"syslog_network_addr"`
+	StatsdConnectionString  string           `json:"statsd_connection_string"`
+	StatsdPrefix            string           `json:"statsd_prefix"`
 
 	// Event System
 	EventHandlers        apidef.EventHandlerMetaConfig         `json:"event_handlers"`
@@ -461,9 +578,18 @@ type Config struct {
 	GlobalSessionLifetime          int64 `bson:"global_session_lifetime" json:"global_session_lifetime"`
 	ForceGlobalSessionLifetime     bool  `bson:"force_global_session_lifetime" json:"force_global_session_lifetime"`
 	HideGeneratorHeader            bool  `json:"hide_generator_header"`
-	KV                             struct {
+
+	// Sync loads the APIs, policies and certificates from a directory
+	// instead of the app path and policy file.
+	Sync SyncConfig `json:"sync"`
+
+	KV struct {
 		Consul ConsulConfig `json:"consul"`
 		Vault  VaultConfig  `json:"vault"`
+		// RefreshInterval is how often, in seconds, the KV references of the
+		// API definitions and policies are resolved again to pick up changed
+		// secrets. Defaults to 60, a negative value disables it.
+		RefreshInterval int `json:"refresh_interval"`
 	} `json:"kv"`
 
 	// Secrets are key-value pairs that can be accessed in the dashboard via "secrets://"
@@ -664,7 +790,7 @@ func Load(paths []string, conf *Config) error {
 	if err := envconfig.Process(envPrefix, conf); err != nil {
 		return fmt.Errorf("failed to process config env vars: %v", err)
 	}
-	if err := processCustom(envPrefix, conf, loadZipkin, loadJaeger); err != nil {
+	if err := processCustom(envPrefix, conf, loadZipkin, loadJaeger, loadOpenTelemetry); err != nil {
 		return fmt.Errorf("failed to process config custom loader: %v", err)
 	}
 	return nil
@@ -46,6 +46,26 @@ type Sampler struct {
 	Mod uint64 `json:"mod"`
 }
 
+// OpenTelemetryConfig configuration options used to initialize the
+// OpenTelemetry tracer.
+type OpenTelemetryConfig struct {
+	// Exporter is the OTLP transport used to send spans, "grpc" or "http".
+	// Defaults to "grpc".
+	Exporter string `json:"exporter"`
+	// Endpoint of the collector. This is host:port for grpc and a URL for http,
+	// spans are posted to /v1/traces when the URL has no path.
+	Endpoint string `json:"endpoint"`
+	// Headers sent along with every export, for instance for authentication.
+	Headers map[string]string `json:"headers"`
+	// Insecure disables TLS on the grpc connection.
+	Insecure bool `json:"insecure"`
+	// Timeout of a single export in seconds, 10 by default.
+	Timeout int `json:"timeout"`
+	// BatchSize is the maximum number of spans sent in one export, 512 by
+	// default.
+	BatchSize int `json:"batch_size"`
+}
+
 // DecodeJSON marshals src to json and tries to unmarshal the result into
 // dest.
 func DecodeJSON(dest, src interface{}) error {
@@ -138,3 +158,35 @@ func loadJaeger(prefix string, c *Config) error {
 	c.Tracer.Options = o
 	return nil
 }
+
+// loadOpenTelemetry loads opentelemetry configuration from environment
+// variables.
+//
+// list of opentelemetry configuration env variables
+//
+// TYK_GW_TRACER_OPTIONS_EXPORTER
+// TYK_GW_TRACER_OPTIONS_ENDPOINT
+// TYK_GW_TRACER_OPTIONS_HEADERS
+// TYK_GW_TRACER_OPTIONS_INSECURE
+// TYK_GW_TRACER_OPTIONS_TIMEOUT
+// TYK_GW_TRACER_OPTIONS_BATCHSIZE
+func loadOpenTelemetry(prefix string, c *Config) error {
+	if c.Tracer.Name != "opentelemetry" {
+		return nil
+	}
+	var otel OpenTelemetryConfig
+	if err := DecodeJSON(&otel, c.Tracer.Options); err != nil {
+		return err
+	}
+	qualifyPrefix := prefix + "_TRACER_OPTIONS"
+	err := envconfig.Process(qualifyPrefix, &otel)
+	if err != nil {
+		return err
+	}
+	o := make(map[string]interface{})
+	if err := DecodeJSON(&o, otel); err != nil {
+		return err
+	}
+	c.Tracer.Options = o
+	return nil
+}
@@ -122,3 +122,37 @@ func TestLoadJaeger(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadOpenTelemetry(t *testing.T) {
+	t.Run("Returns nil when it is not opentelemetry config", func(t *testing.T) {
+		conf := &Config{}
+		err := loadOpenTelemetry(envPrefix, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.Tracer.Options != nil {
+			t.Error("expected options to be nil")
+		}
+	})
+
+	t.Run("Loads env vars", func(t *testing.T) {
+		os.Setenv("TYK_GW_TRACER_OPTIONS_EXPORTER", "http")
+		os.Setenv("TYK_GW_TRACER_OPTIONS_HEADERS", "x-api-key:secret")
+		defer os.Unsetenv("TYK_GW_TRACER_OPTIONS_EXPORTER")
+		defer os.Unsetenv("TYK_GW_TRACER_OPTIONS_HEADERS")
+
+		conf := &Config{Tracer: Tracer{Name: "opentelemetry", Options: map[string]interface{}{"endpoint": "http://collector:4318"}}}
+		err := loadOpenTelemetry(envPrefix, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got OpenTelemetryConfig
+		err = DecodeJSON(&got, conf.Tracer.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Exporter != "http" || got.Endpoint != "http://collector:4318" || got.Headers["x-api-key"] != "secret" {
+			t.Errorf("unexpected config %#v", got)
+		}
+	})
+}
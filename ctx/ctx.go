@@ -39,6 +39,9 @@ const (
 	RequestStatus
 	GraphQLRequest
 	GraphQLIsWebSocketUpgrade
+	JWTClaims
+	AnalyticsSample
+	AuthFailures
 )
 
 func setContext(r *http.Request, ctx context.Context) {
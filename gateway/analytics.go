@@ -9,7 +9,6 @@ import (
 	"time"
 
 	maxminddb "github.com/oschwald/maxminddb-golang"
-	msgpack "gopkg.in/vmihailenco/msgpack.v2"
 
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/regexp"
@@ -73,6 +72,9 @@ type AnalyticsRecord struct {
 	Alias         string
 	TrackPath     bool
 	ExpireAt      time.Time `bson:"expireAt" json:"expireAt"`
+	// SampleWeight is the number of requests the record stands for when
+	// analytics are sampled, aggregations should sum it instead of counting.
+	SampleWeight float64
 }
 
 type GeoData struct {
@@ -176,10 +178,11 @@ func (a *AnalyticsRecord) SetExpiry(expiresInSeconds int64) {
 }
 
 // RedisAnalyticsHandler will record analytics data to a redis back end
-// as defined in the Config object
+// as defined in the Config object, or to the configured sinks
 type RedisAnalyticsHandler struct {
 	Store            storage.AnalyticsHandler
 	GeoIPDB          *maxminddb.Reader
+	sinks            []AnalyticsSink
 	globalConf       config.Config
 	recordsChan      chan *AnalyticsRecord
 	workerBufferSize uint64
@@ -200,6 +203,26 @@ func (r *RedisAnalyticsHandler) Init(globalConf config.Config) {
 
 	analytics.Store.Connect()
 
+	r.sinks = r.sinks[:0]
+	for _, sinkConf := range r.globalConf.AnalyticsConfig.Sinks {
+		sink, err := NewAnalyticsSink(sinkConf, r.Store)
+		if err != nil {
+			log.WithError(err).WithField("type", sinkConf.Type).Error("Failed to init analytics sink")
+			continue
+		}
+		r.sinks = append(r.sinks, sink)
+	}
+	if len(r.sinks) == 0 {
+		if len(r.globalConf.AnalyticsConfig.Sinks) > 0 {
+			// the records would pile up in the embedded storage
+			if r.globalConf.Storage.Type == storage.EmbeddedType {
+				log.Fatal("None of the configured analytics sinks could be initialised")
+			}
+			log.Error("None of the configured analytics sinks could be initialised, writing analytics records to Redis")
+		}
+		r.sinks = append(r.sinks, &redisAnalyticsSink{store: r.Store})
+	}
+
 	ps := config.Global().AnalyticsConfig.PoolSize
 	recordsBufferSize := config.Global().AnalyticsConfig.RecordsBufferSize
 	r.workerBufferSize = recordsBufferSize / uint64(ps)
@@ -224,6 +247,10 @@ func (r *RedisAnalyticsHandler) Stop() {
 
 	// wait for all workers to be done
 	r.poolWg.Wait()
+
+	for _, sink := range r.sinks {
+		sink.Close()
+	}
 }
 
 // RecordHit will store an AnalyticsRecord in Redis
@@ -243,9 +270,9 @@ func (r *RedisAnalyticsHandler) RecordHit(record *AnalyticsRecord) error {
 func (r *RedisAnalyticsHandler) recordWorker() {
 	defer r.poolWg.Done()
 
-	// this is buffer to send one pipelined command to redis
+	// this is buffer to send one batch of records to the sinks
 	// use r.recordsBufferSize as cap to reduce slice re-allocations
-	recordsBuffer := make([][]byte, 0, r.workerBufferSize)
+	recordsBuffer := make([]*AnalyticsRecord, 0, r.workerBufferSize)
 
 	// read records from channel and process
 	lastSentTs := time.Now()
@@ -257,7 +284,7 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 			// check if channel was closed and it is time to exit from worker
 			if !ok {
 				// send what is left in buffer
-				r.Store.AppendToSetPipelined(analyticsKeyName, recordsBuffer)
+				r.writeRecords(recordsBuffer)
 				return
 			}
 
@@ -295,11 +322,7 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 				record.RawPath = "/" + record.RawPath
 			}
 
-			if encoded, err := msgpack.Marshal(record); err != nil {
-				log.WithError(err).Error("Error encoding analytics data")
-			} else {
-				recordsBuffer = append(recordsBuffer, encoded)
-			}
+			recordsBuffer = append(recordsBuffer, record)
 
 			// identify that buffer is ready to be sent
 			readyToSend = uint64(len(recordsBuffer)) == r.workerBufferSize
@@ -310,15 +333,29 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 			readyToSend = true
 		}
 
-		// send data to Redis and reset buffer
+		// send data to the sinks and reset buffer
 		if len(recordsBuffer) > 0 && (readyToSend || time.Since(lastSentTs) >= recordsBufferForcedFlushInterval) {
-			r.Store.AppendToSetPipelined(analyticsKeyName, recordsBuffer)
+			r.writeRecords(recordsBuffer)
 			recordsBuffer = recordsBuffer[:0]
 			lastSentTs = time.Now()
 		}
 	}
 }
 
+// writeRecords writes a batch of records to every sink, a failing sink does
+// not prevent the others from receiving the batch.
+func (r *RedisAnalyticsHandler) writeRecords(records []*AnalyticsRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	for _, sink := range r.sinks {
+		if err := sink.WriteRecords(records); err != nil {
+			log.WithError(err).Errorf("Failed to write %d analytics records", len(records))
+		}
+	}
+}
+
 func DurationToMillisecond(d time.Duration) float64 {
 	return float64(d) / 1e6
 }
@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+const defaultRedactionReplacement = "[REDACTED]"
+
+// analyticsRedactor masks personal data in the raw requests and responses of
+// detailed analytics records. A nil redactor leaves them untouched.
+type analyticsRedactor struct {
+	headers     map[string]bool
+	fields      [][]string
+	formFields  map[string]bool
+	patterns    []*regexp.Regexp
+	queryParams []string
+	replacement string
+}
+
+// newAnalyticsRedactor merges the given rules, it returns nil when there is
+// nothing to redact. The last replacement set wins.
+func newAnalyticsRedactor(logger *logrus.Entry, rules ...apidef.AnalyticsRedaction) *analyticsRedactor {
+	a := &analyticsRedactor{
+		headers:     map[string]bool{},
+		formFields:  map[string]bool{},
+		replacement: defaultRedactionReplacement,
+	}
+
+	empty := true
+	for _, rule := range rules {
+		for _, name := range rule.Headers {
+			a.headers[http.CanonicalHeaderKey(name)] = true
+			empty = false
+		}
+
+		for _, field := range rule.BodyFields {
+			path := strings.Split(field, ".")
+			a.fields = append(a.fields, path)
+			if len(path) == 1 {
+				a.formFields[field] = true
+			}
+			empty = false
+		}
+
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				logger.WithError(err).WithField("pattern", pattern).Error("Invalid analytics redaction pattern")
+				continue
+			}
+			a.patterns = append(a.patterns, re)
+			empty = false
+		}
+
+		if len(rule.QueryParams) > 0 {
+			a.queryParams = append(a.queryParams, rule.QueryParams...)
+			empty = false
+		}
+
+		if rule.Replacement != "" {
+			a.replacement = rule.Replacement
+		}
+	}
+
+	if empty {
+		return nil
+	}
+	return a
+}
+
+// request redacts a request in wire format.
+func (a *analyticsRedactor) request(raw []byte) []byte {
+	if a == nil {
+		return raw
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return a.maskPatterns(raw)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	body = decodeBody(req.Header, body)
+
+	query := req.URL.Query()
+	for _, name := range a.queryParams {
+		query.Del(name)
+	}
+	req.URL.RawQuery = query.Encode()
+	for _, re := range a.patterns {
+		req.URL.Path = re.ReplaceAllLiteralString(req.URL.Path, a.replacement)
+		req.URL.RawQuery = re.ReplaceAllLiteralString(req.URL.RawQuery, a.replacement)
+	}
+	req.URL.RawPath = ""
+
+	a.redactHeader(req.Header)
+	body = a.redactBody(req.Header.Get(headers.ContentType), body)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+
+	var buf bytes.Buffer
+	req.Write(&buf)
+	return buf.Bytes()
+}
+
+// response redacts a response in wire format.
+func (a *analyticsRedactor) response(raw []byte) []byte {
+	if a == nil {
+		return raw
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return a.maskPatterns(raw)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	body = decodeBody(res.Header, body)
+
+	a.redactHeader(res.Header)
+	body = a.redactBody(res.Header.Get(headers.ContentType), body)
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.TransferEncoding = nil
+
+	var buf bytes.Buffer
+	res.Write(&buf)
+	return buf.Bytes()
+}
+
+// decodeBody decodes a compressed body so that it can be redacted, and drops
+// it if the encoding is not supported. The body is recorded uncompressed.
+func decodeBody(h http.Header, body []byte) []byte {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch strings.ToLower(h.Get(headers.ContentEncoding)) {
+	case "", "identity":
+		return body
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		err = errors.New("unsupported content encoding")
+	}
+
+	h.Del(headers.ContentEncoding)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+func (a *analyticsRedactor) redactHeader(h http.Header) {
+	for name, values := range h {
+		for i := range values {
+			if a.headers[name] {
+				values[i] = a.replacement
+				continue
+			}
+			for _, re := range a.patterns {
+				values[i] = re.ReplaceAllLiteralString(values[i], a.replacement)
+			}
+		}
+	}
+}
+
+func (a *analyticsRedactor) redactBody(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		body = a.redactJSON(body)
+	case strings.HasPrefix(contentType, headers.FormURLEncoded):
+		body = a.redactForm(body)
+	}
+
+	return a.maskPatterns(body)
+}
+
+func (a *analyticsRedactor) redactJSON(body []byte) []byte {
+	if len(a.fields) == 0 {
+		return body
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return body
+	}
+
+	masked := false
+	for _, path := range a.fields {
+		if maskJSONPath(doc, path, a.replacement) {
+			masked = true
+		}
+	}
+	if !masked {
+		return body
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (a *analyticsRedactor) redactForm(body []byte) []byte {
+	if len(a.formFields) == 0 {
+		return body
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return body
+	}
+
+	masked := false
+	for name, values := range form {
+		if !a.formFields[name] {
+			continue
+		}
+		for i := range values {
+			values[i] = a.replacement
+		}
+		masked = true
+	}
+	if !masked {
+		return body
+	}
+
+	return []byte(form.Encode())
+}
+
+func (a *analyticsRedactor) maskPatterns(b []byte) []byte {
+	for _, re := range a.patterns {
+		b = re.ReplaceAllLiteral(b, []byte(a.replacement))
+	}
+	return b
+}
+
+// maskJSONPath replaces the values at path in a decoded JSON document.
+func maskJSONPath(node interface{}, path []string, replacement string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	masked := false
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			if len(path) == 1 {
+				v[key] = replacement
+				masked = true
+			} else if maskJSONPath(child, path[1:], replacement) {
+				masked = true
+			}
+		}
+	case []interface{}:
+		index, err := strconv.Atoi(path[0])
+		if path[0] != "*" && err != nil {
+			// arrays are traversed when the path does not address them
+			for _, child := range v {
+				if maskJSONPath(child, path, replacement) {
+					masked = true
+				}
+			}
+			return masked
+		}
+
+		for i, child := range v {
+			if path[0] != "*" && i != index {
+				continue
+			}
+			if len(path) == 1 {
+				v[i] = replacement
+				masked = true
+			} else if maskJSONPath(child, path[1:], replacement) {
+				masked = true
+			}
+		}
+	}
+
+	return masked
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func testAnalyticsRedactor(t *testing.T, rules ...apidef.AnalyticsRedaction) *analyticsRedactor {
+	t.Helper()
+	a := newAnalyticsRedactor(logrus.NewEntry(log), rules...)
+	if a == nil {
+		t.Fatal("Expected a redactor")
+	}
+	return a
+}
+
+func Test_newAnalyticsRedactor(t *testing.T) {
+	if a := newAnalyticsRedactor(logrus.NewEntry(log), apidef.AnalyticsRedaction{}, apidef.AnalyticsRedaction{Replacement: "***"}); a != nil {
+		t.Error("No redactor should be created without rules")
+	}
+
+	a := testAnalyticsRedactor(t,
+		apidef.AnalyticsRedaction{Headers: []string{"authorization"}, Patterns: []string{"("}},
+		apidef.AnalyticsRedaction{Headers: []string{"X-Api-Key"}, Replacement: "***"},
+	)
+	if !a.headers["Authorization"] || !a.headers["X-Api-Key"] || a.replacement != "***" {
+		t.Errorf("Rules should be merged: %+v", a)
+	}
+	if len(a.patterns) != 0 {
+		t.Error("Invalid patterns should be skipped")
+	}
+}
+
+func Test_maskJSONPath(t *testing.T) {
+	a := testAnalyticsRedactor(t, apidef.AnalyticsRedaction{
+		BodyFields: []string{"user.email", "cards.number", "tokens.0", "secrets.*"},
+	})
+
+	body := `{"user":{"email":"a@b.c","name":"Al"},"cards":[{"number":"1"},{"number":"2"}],"tokens":["x","y"],"secrets":{"a":1,"b":2},"total":1.50}`
+	got := string(a.redactJSON([]byte(body)))
+	want := `{"cards":[{"number":"[REDACTED]"},{"number":"[REDACTED]"}],"secrets":{"a":"[REDACTED]","b":"[REDACTED]"},"tokens":["[REDACTED]","y"],"total":1.50,"user":{"email":"[REDACTED]","name":"Al"}}`
+	if got != want {
+		t.Errorf("Unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := a.redactJSON([]byte(`not json`)); string(got) != "not json" {
+		t.Error("Invalid JSON should be left as is")
+	}
+}
+
+func TestAnalyticsRedactor_request(t *testing.T) {
+	a := testAnalyticsRedactor(t, apidef.AnalyticsRedaction{
+		Headers:     []string{"Authorization"},
+		BodyFields:  []string{"password"},
+		Patterns:    []string{`\b\d{4}-\d{4}-\d{4}-\d{4}\b`},
+		QueryParams: []string{"api_key"},
+	})
+
+	t.Run("JSON body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/pay?api_key=secret&card=1234-5678-9012-3456&ref=1",
+			strings.NewReader(`{"password":"hunter2","card":"1234-5678-9012-3456"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Card", "1234-5678-9012-3456")
+
+		var wire bytes.Buffer
+		req.Write(&wire)
+
+		redacted, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(a.request(wire.Bytes()))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(redacted.Body)
+
+		if redacted.URL.RawQuery != "card=[REDACTED]&ref=1" {
+			t.Error("Unexpected query:", redacted.URL.RawQuery)
+		}
+		if redacted.Header.Get("Authorization") != "[REDACTED]" || redacted.Header.Get("X-Card") != "[REDACTED]" {
+			t.Error("Unexpected headers:", redacted.Header)
+		}
+		if string(body) != `{"card":"[REDACTED]","password":"[REDACTED]"}` || redacted.ContentLength != int64(len(body)) {
+			t.Error("Unexpected body:", string(body))
+		}
+	})
+
+	t.Run("Form body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/login", strings.NewReader("user=al&password=hunter2"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		var wire bytes.Buffer
+		req.Write(&wire)
+
+		redacted := string(a.request(wire.Bytes()))
+		if !strings.HasSuffix(redacted, "password=%5BREDACTED%5D&user=al") {
+			t.Error("Unexpected request:", redacted)
+		}
+	})
+}
+
+func TestAnalyticsRedactor_response(t *testing.T) {
+	a := testAnalyticsRedactor(t, apidef.AnalyticsRedaction{
+		Headers:    []string{"Set-Cookie"},
+		BodyFields: []string{"email"},
+	})
+
+	raw := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nSet-Cookie: session=1\r\nContent-Length: 19\r\n\r\n{\"email\":\"a@b.com\"}"
+	redacted := string(a.response([]byte(raw)))
+	if !strings.Contains(redacted, "Set-Cookie: [REDACTED]") || !strings.HasSuffix(redacted, `{"email":"[REDACTED]"}`) {
+		t.Error("Unexpected response:", redacted)
+	}
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(`{"email":"a@b.com"}`))
+	w.Close()
+	raw = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Encoding: gzip\r\nContent-Length: " + strconv.Itoa(gz.Len()) + "\r\n\r\n" + gz.String()
+	redacted = string(a.response([]byte(raw)))
+	if strings.Contains(redacted, "Content-Encoding") || !strings.HasSuffix(redacted, `{"email":"[REDACTED]"}`) {
+		t.Error("Unexpected gzip response:", redacted)
+	}
+
+	raw = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Encoding: br\r\nContent-Length: 5\r\n\r\nbrotl"
+	if redacted = string(a.response([]byte(raw))); strings.Contains(redacted, "brotl") {
+		t.Error("Bodies with an unsupported encoding should be dropped:", redacted)
+	}
+}
+
+func TestAnalyticsRedaction(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer ResetTestConfig()
+
+	globalConf := config.Global()
+	globalConf.AnalyticsConfig.EnableDetailedRecording = true
+	globalConf.AnalyticsConfig.Redaction = apidef.AnalyticsRedaction{Headers: []string{"Authorization"}, Replacement: "[GLOBAL]"}
+	config.SetGlobal(globalConf)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.AnalyticsRedaction = apidef.AnalyticsRedaction{BodyFields: []string{"ssn"}, Replacement: "***"}
+	})
+
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	key := CreateSession()
+	ts.Run(t, test.TestCase{
+		Method:  http.MethodPost,
+		Path:    "/",
+		Data:    `{"ssn":"078-05-1120"}`,
+		Headers: map[string]string{"Authorization": key, "Content-Type": "application/json"},
+		Code:    http.StatusOK,
+	})
+
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+	if len(results) != 1 {
+		t.Fatal("Expected a record, got", len(results))
+	}
+
+	var record AnalyticsRecord
+	msgpack.Unmarshal([]byte(results[0].(string)), &record)
+	rawRequest, _ := base64.StdEncoding.DecodeString(record.RawRequest)
+
+	if strings.Contains(string(rawRequest), key) || strings.Contains(string(rawRequest), "078-05-1120") {
+		t.Error("The record should be redacted:", string(rawRequest))
+	}
+	if !strings.Contains(string(rawRequest), `{"ssn":"***"}`) {
+		t.Error("Unexpected raw request:", string(rawRequest))
+	}
+}
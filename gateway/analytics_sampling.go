@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// analyticsSample is the sampling decision made for a request. The weight is
+// the number of requests the record stands for.
+type analyticsSample struct {
+	sampled bool
+	weight  float64
+}
+
+func newAnalyticsSample(rate float64) analyticsSample {
+	switch {
+	case rate >= 1:
+		return analyticsSample{sampled: true, weight: 1}
+	case rate <= 0:
+		return analyticsSample{}
+	}
+
+	return analyticsSample{sampled: rand.Float64() < rate, weight: 1 / rate}
+}
+
+// shouldRecordAnalytics tells whether the analytics record of a request should
+// be stored and the sample weight it carries. Errors and slow requests can
+// be recorded regardless of sampling, such records have a weight of 1.
+func (a *APISpec) shouldRecordAnalytics(r *http.Request, code int, latency int64) (bool, float64) {
+	conf := a.AnalyticsSampling
+	if !conf.Enabled {
+		return true, 1
+	}
+
+	if conf.AlwaysRecordErrors && code >= http.StatusBadRequest {
+		return true, 1
+	}
+
+	if conf.SlowRequestThreshold > 0 && latency > conf.SlowRequestThreshold {
+		return true, 1
+	}
+
+	// requests which failed before reaching TrackEndpointMiddleware
+	sample, ok := ctxGetAnalyticsSample(r)
+	if !ok {
+		sample = newAnalyticsSample(conf.Rate)
+		ctxSetAnalyticsSample(r, sample)
+	}
+
+	return sample.sampled, sample.weight
+}
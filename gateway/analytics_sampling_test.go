@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func Test_newAnalyticsSample(t *testing.T) {
+	if s := newAnalyticsSample(1); !s.sampled || s.weight != 1 {
+		t.Errorf("Every request should be sampled: %+v", s)
+	}
+	if s := newAnalyticsSample(0); s.sampled {
+		t.Errorf("No request should be sampled: %+v", s)
+	}
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		s := newAnalyticsSample(0.25)
+		if s.weight != 4 {
+			t.Fatal("Unexpected weight:", s.weight)
+		}
+		if s.sampled {
+			sampled++
+		}
+	}
+	if sampled < 2000 || sampled > 3000 {
+		t.Error("Expected about a quarter of the requests to be sampled, got", sampled)
+	}
+}
+
+func TestAPISpec_shouldRecordAnalytics(t *testing.T) {
+	spec := BuildAPI(func(spec *APISpec) {
+		spec.AnalyticsSampling = apidef.AnalyticsSampling{
+			Enabled:              true,
+			AlwaysRecordErrors:   true,
+			SlowRequestThreshold: 100,
+		}
+	})[0]
+
+	for _, tc := range []struct {
+		name    string
+		code    int
+		latency int64
+		record  bool
+	}{
+		{"Sampled out", 200, 10, false},
+		{"Error", 502, 10, true},
+		{"Slow request", 200, 150, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			record, weight := spec.shouldRecordAnalytics(r, tc.code, tc.latency)
+			if record != tc.record {
+				t.Errorf("Expected record to be %v", tc.record)
+			}
+			if record && weight != 1 {
+				t.Error("Overrides should have a weight of 1, got", weight)
+			}
+		})
+	}
+
+	t.Run("Sampling disabled", func(t *testing.T) {
+		spec.AnalyticsSampling.Enabled = false
+		if record, weight := spec.shouldRecordAnalytics(httptest.NewRequest("GET", "/", nil), 200, 0); !record || weight != 1 {
+			t.Error("Every request should be recorded")
+		}
+	})
+}
+
+func TestAnalyticsSampling(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.AnalyticsSampling = apidef.AnalyticsSampling{
+			Enabled:            true,
+			AlwaysRecordErrors: true,
+		}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.TrackEndpoints = []apidef.TrackEndpointMeta{
+				{Path: "/sampled", Method: "GET", SampleRate: 0.5},
+			}
+		})
+	})
+
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	key := CreateSession()
+	authHeaders := map[string]string{"authorization": key}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: 401},
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 200},
+	}...)
+	for i := 0; i < 100; i++ {
+		ts.Run(t, test.TestCase{Path: "/sampled", Headers: authHeaders, Code: 200})
+	}
+
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	var errors, sampled int
+	for _, result := range results {
+		var record AnalyticsRecord
+		msgpack.Unmarshal([]byte(result.(string)), &record)
+
+		switch {
+		case record.ResponseCode == 401 && record.SampleWeight == 1:
+			errors++
+		case record.Path == "/sampled" && record.TrackPath && record.SampleWeight == 2:
+			sampled++
+		default:
+			t.Errorf("Unexpected record: %s %d weight %v", record.Path, record.ResponseCode, record.SampleWeight)
+		}
+	}
+
+	if errors != 1 {
+		t.Error("Errors should always be recorded, got", errors)
+	}
+	if sampled < 20 || sampled > 80 {
+		t.Error("Expected about half of the tracked endpoint requests to be recorded, got", sampled)
+	}
+}
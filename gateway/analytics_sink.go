@@ -0,0 +1,378 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	defaultAnalyticsFileMaxSize    = 100 // megabytes
+	defaultAnalyticsFileMaxBackups = 5
+	defaultAnalyticsSinkTimeout    = 5 * time.Second
+	defaultAnalyticsSyslogTag      = "tyk-analytics"
+	defaultAnalyticsKafkaTopic     = "tyk-analytics"
+
+	// syslog priority of the records: facility local0, severity info
+	analyticsSyslogPriority = 16*8 + 6
+)
+
+// AnalyticsSink is a destination analytics records are written to. Records
+// are written in batches by the analytics workers, a sink must not keep the
+// slice it is given.
+type AnalyticsSink interface {
+	WriteRecords(records []*AnalyticsRecord) error
+	Close() error
+}
+
+// analyticsSinksBypassRedis reports whether analytics records are only
+// written to sinks other than Redis.
+func analyticsSinksBypassRedis() bool {
+	sinks := config.Global().AnalyticsConfig.Sinks
+	if len(sinks) == 0 {
+		return false
+	}
+	for _, sink := range sinks {
+		if sink.Type == "" || sink.Type == "redis" {
+			return false
+		}
+	}
+	return true
+}
+
+// NewAnalyticsSink creates the sink described by conf. The Redis sink writes
+// to store.
+func NewAnalyticsSink(conf config.AnalyticsSinkConfig, store storage.AnalyticsHandler) (AnalyticsSink, error) {
+	timeout := defaultAnalyticsSinkTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Millisecond
+	}
+
+	switch conf.Type {
+	case "", "redis":
+		return &redisAnalyticsSink{store: store}, nil
+	case "file":
+		if conf.Path == "" {
+			return nil, errors.New("no file path given")
+		}
+		sink := &fileAnalyticsSink{
+			path:       conf.Path,
+			maxSize:    int64(conf.MaxSize) << 20,
+			maxBackups: conf.MaxBackups,
+		}
+		if sink.maxSize <= 0 {
+			sink.maxSize = defaultAnalyticsFileMaxSize << 20
+		}
+		if sink.maxBackups <= 0 {
+			sink.maxBackups = defaultAnalyticsFileMaxBackups
+		}
+		return sink, nil
+	case "syslog":
+		if conf.Address == "" {
+			return nil, errors.New("no syslog address given")
+		}
+		sink := &syslogAnalyticsSink{
+			network: conf.Network,
+			address: conf.Address,
+			tag:     conf.Tag,
+			timeout: timeout,
+		}
+		if sink.network == "" {
+			sink.network = "udp"
+		}
+		if sink.tag == "" {
+			sink.tag = defaultAnalyticsSyslogTag
+		}
+		sink.hostname, _ = os.Hostname()
+		return sink, nil
+	case "http":
+		if conf.URL == "" {
+			return nil, errors.New("no URL given")
+		}
+		return &httpAnalyticsSink{
+			url:     conf.URL,
+			headers: conf.Headers,
+			client:  &http.Client{Timeout: timeout},
+		}, nil
+	case "kafka":
+		if len(conf.Brokers) == 0 {
+			return nil, errors.New("no Kafka brokers given")
+		}
+		topic := conf.Topic
+		if topic == "" {
+			topic = defaultAnalyticsKafkaTopic
+		}
+		return &kafkaAnalyticsSink{
+			timeout: timeout,
+			writer: kafka.NewWriter(kafka.WriterConfig{
+				Brokers: conf.Brokers,
+				Topic:   topic,
+				// records are batched by the workers already
+				BatchTimeout: 10 * time.Millisecond,
+				WriteTimeout: timeout,
+			}),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown analytics sink type %q", conf.Type)
+}
+
+// redisAnalyticsSink stores msgpack encoded records in Redis for Tyk Pump.
+type redisAnalyticsSink struct {
+	store storage.AnalyticsHandler
+}
+
+func (s *redisAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	encoded := make([][]byte, 0, len(records))
+	for _, record := range records {
+		raw, err := msgpack.Marshal(record)
+		if err != nil {
+			log.WithError(err).Error("Error encoding analytics data")
+			continue
+		}
+		encoded = append(encoded, raw)
+	}
+
+	s.store.AppendToSetPipelined(analyticsKeyName, encoded)
+	return nil
+}
+
+func (s *redisAnalyticsSink) Close() error {
+	return nil
+}
+
+// encodeAnalyticsLines encodes records as newline-delimited JSON.
+func encodeAnalyticsLines(records []*AnalyticsRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// fileAnalyticsSink appends records to a newline-delimited JSON file. The
+// file is rotated to path.1, path.2... once it grows over maxSize bytes.
+type fileAnalyticsSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (s *fileAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	lines, err := encodeAnalyticsLines(records)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(len(lines)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(lines)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileAnalyticsSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileAnalyticsSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		os.Rename(s.backupPath(i), s.backupPath(i+1))
+	}
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *fileAnalyticsSink) backupPath(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
+
+func (s *fileAnalyticsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// syslogAnalyticsSink streams records as RFC 5424 syslog messages with a
+// JSON body, one message per record. TCP messages are newline terminated.
+type syslogAnalyticsSink struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *syslogAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	for _, record := range records {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("<%d>1 %s %s %s - - - %s\n", analyticsSyslogPriority,
+			record.TimeStamp.Format(time.RFC3339Nano), s.hostname, s.tag, body)
+		if _, err := io.WriteString(s.conn, msg); err != nil {
+			// reconnect on the next batch
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syslogAnalyticsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// httpAnalyticsSink posts each batch of records as a JSON array.
+type httpAnalyticsSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *httpAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headers.ContentType, headers.ApplicationJSON)
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("analytics endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpAnalyticsSink) Close() error {
+	return nil
+}
+
+// kafkaAnalyticsSink publishes records as JSON messages keyed by API ID.
+type kafkaAnalyticsSink struct {
+	writer  *kafka.Writer
+	timeout time.Duration
+}
+
+func (s *kafkaAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	msgs := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{Key: []byte(record.APIID), Value: value})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	return s.writer.WriteMessages(ctx, msgs...)
+}
+
+func (s *kafkaAnalyticsSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func testAnalyticsRecords(apiIDs ...string) []*AnalyticsRecord {
+	records := make([]*AnalyticsRecord, len(apiIDs))
+	for i, apiID := range apiIDs {
+		records[i] = &AnalyticsRecord{APIID: apiID, Path: "/get", ResponseCode: 200, TimeStamp: time.Now()}
+	}
+	return records
+}
+
+func readAnalyticsLines(t *testing.T, path string) []AnalyticsRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []AnalyticsRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AnalyticsRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewAnalyticsSink(t *testing.T) {
+	invalid := []config.AnalyticsSinkConfig{
+		{Type: "unknown"},
+		{Type: "file"},
+		{Type: "syslog"},
+		{Type: "http"},
+		{Type: "kafka"},
+	}
+	for _, conf := range invalid {
+		if _, err := NewAnalyticsSink(conf, nil); err == nil {
+			t.Errorf("Expected an error for %+v", conf)
+		}
+	}
+
+	if sink, err := NewAnalyticsSink(config.AnalyticsSinkConfig{}, nil); err != nil {
+		t.Error(err)
+	} else if _, ok := sink.(*redisAnalyticsSink); !ok {
+		t.Error("Expected the Redis sink by default")
+	}
+}
+
+func TestFileAnalyticsSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.log")
+	sink := &fileAnalyticsSink{path: path, maxSize: 300, maxBackups: 2}
+	defer sink.Close()
+
+	for i := 0; i < 4; i++ {
+		if err := sink.WriteRecords(testAnalyticsRecords("a", "b")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if records := readAnalyticsLines(t, path); len(records) != 2 || records[1].APIID != "b" {
+		t.Errorf("Expected the current file to hold the last batch, got %d records", len(records))
+	}
+	for _, backup := range []string{path + ".1", path + ".2"} {
+		if records := readAnalyticsLines(t, backup); len(records) != 2 {
+			t.Errorf("Expected %s to hold a batch, got %d records", backup, len(records))
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Only 2 backups should be kept")
+	}
+}
+
+func TestSyslogAnalyticsSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewAnalyticsSink(config.AnalyticsSinkConfig{Type: "syslog", Address: conn.LocalAddr().String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.WriteRecords(testAnalyticsRecords("syslog")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<134>1 ") || !strings.Contains(msg, " tyk-analytics - - - {") ||
+		!strings.Contains(msg, `"APIID":"syslog"`) {
+		t.Error("Unexpected syslog message:", msg)
+	}
+}
+
+func TestHTTPAnalyticsSink(t *testing.T) {
+	received := make(chan []AnalyticsRecord, 1)
+	var status int32 = http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var records []AnalyticsRecord
+		json.Unmarshal(body, &records)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		received <- records
+	}))
+	defer upstream.Close()
+
+	sink, err := NewAnalyticsSink(config.AnalyticsSinkConfig{
+		Type:    "http",
+		URL:     upstream.URL,
+		Headers: map[string]string{"Authorization": "secret"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.WriteRecords(testAnalyticsRecords("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if records := <-received; len(records) != 2 || records[0].APIID != "a" {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	if err := sink.WriteRecords(testAnalyticsRecords("c")); err == nil {
+		t.Error("Expected an error for a failed request")
+	}
+	<-received
+}
+
+func TestRedisAnalyticsHandler_Sinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.log")
+
+	globalConf := config.Global()
+	globalConf.AnalyticsConfig.PoolSize = 1
+	globalConf.AnalyticsConfig.RecordsBufferSize = 10
+	globalConf.AnalyticsConfig.Sinks = []config.AnalyticsSinkConfig{{Type: "file", Path: path}}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	handler := RedisAnalyticsHandler{Store: analytics.Store}
+	handler.Init(globalConf)
+
+	for _, record := range testAnalyticsRecords("a", "b", "c") {
+		handler.RecordHit(record)
+	}
+	handler.Stop()
+
+	records := readAnalyticsLines(t, path)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Tags[0] != "api-a" {
+		t.Error("Records should be prepared before being written:", records[0].Tags)
+	}
+}
+
+func TestRedisAnalyticsHandler_SinksFallback(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.AnalyticsConfig.PoolSize = 1
+	globalConf.AnalyticsConfig.RecordsBufferSize = 10
+	globalConf.AnalyticsConfig.Sinks = []config.AnalyticsSinkConfig{{Type: "file"}}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	handler := RedisAnalyticsHandler{Store: analytics.Store}
+	handler.Init(globalConf)
+	defer handler.Stop()
+
+	if len(handler.sinks) != 1 {
+		t.Fatalf("Expected a single sink, got %d", len(handler.sinks))
+	}
+	if _, ok := handler.sinks[0].(*redisAnalyticsSink); !ok {
+		t.Errorf("Expected records to fall back to Redis, got %T", handler.sinks[0])
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"sync"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	uuid "github.com/satori/go.uuid"
 	"github.com/sirupsen/logrus"
@@ -479,11 +480,14 @@ func handleGetDetail(sessionKey, apiID string, byHash bool) (interface{}, int) {
 	// TODO: handle apply policies error
 	mw.ApplyPolicies(&session)
 
+	keyHash := sessionKey
+	if !byHash {
+		keyHash = storage.HashKey(sessionKey)
+	}
+	session.SetKeyHash(keyHash)
+
 	if session.QuotaMax != -1 {
-		quotaKey := QuotaKeyPrefix + storage.HashKey(sessionKey)
-		if byHash {
-			quotaKey = QuotaKeyPrefix + sessionKey
-		}
+		quotaKey := QuotaKeyPrefix + session.GetCounterKeyHash()
 
 		if usedQuota, err := GlobalSessionManager.Store().GetRawKey(quotaKey); err == nil {
 			qInt, _ := strconv.Atoi(usedQuota)
@@ -515,10 +519,7 @@ func handleGetDetail(sessionKey, apiID string, byHash bool) (interface{}, int) {
 			quotaScope = access.AllowanceScope + "-"
 		}
 
-		limQuotaKey := QuotaKeyPrefix + quotaScope + storage.HashKey(sessionKey)
-		if byHash {
-			limQuotaKey = QuotaKeyPrefix + quotaScope + sessionKey
-		}
+		limQuotaKey := QuotaKeyPrefix + quotaScope + session.GetCounterKeyHash()
 
 		if usedQuota, err := GlobalSessionManager.Store().GetRawKey(limQuotaKey); err == nil {
 			qInt, _ := strconv.Atoi(usedQuota)
@@ -767,7 +768,7 @@ func handleGetAPIList() (interface{}, int) {
 	apiIDList := make([]*apidef.APIDefinition, len(apisByID))
 	c := 0
 	for _, apiSpec := range apisByID {
-		apiIDList[c] = apiSpec.APIDefinition
+		apiIDList[c] = apiSpec.definition()
 		c++
 	}
 	return apiIDList, http.StatusOK
@@ -775,7 +776,7 @@ func handleGetAPIList() (interface{}, int) {
 
 func handleGetAPI(apiID string) (interface{}, int) {
 	if spec := getApiSpec(apiID); spec != nil {
-		return spec.APIDefinition, http.StatusOK
+		return spec.definition(), http.StatusOK
 	}
 
 	log.WithFields(logrus.Fields{
@@ -981,6 +982,197 @@ func keyHandler(w http.ResponseWriter, r *http.Request) {
 	doJSONWrite(w, code, obj)
 }
 
+// defaultKeyRotationGracePeriod is used when neither the request nor the
+// gateway config specify for how long a rotated key keeps working.
+const defaultKeyRotationGracePeriod = 3600
+
+// rotateKeyHandler issues a new key carrying the session of an existing one.
+// Both keys share quota and rate limit counters, and the old key keeps
+// working for a grace period after which it expires.
+func rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	isHashed := r.URL.Query().Get("hashed") != ""
+	orgID := r.URL.Query().Get("org_id")
+
+	if isHashed && !config.Global().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key requested by hash but key hashing is not enabled"))
+		return
+	}
+
+	gracePeriod := config.Global().KeyRotationGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultKeyRotationGracePeriod
+	}
+	if param := r.URL.Query().Get("grace_period"); param != "" {
+		var err error
+		if gracePeriod, err = strconv.ParseInt(param, 10, 64); err != nil || gracePeriod < 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("grace_period must be a non-negative number of seconds"))
+			return
+		}
+	}
+
+	oldSession, found := GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	newSession := oldSession.Clone()
+	if newSession.CounterKeyHash == "" {
+		if isHashed {
+			newSession.CounterKeyHash = keyName
+		} else {
+			newSession.CounterKeyHash = storage.HashKey(keyName)
+		}
+	}
+
+	newKey := keyGen.GenerateAuthKey(newSession.OrgID)
+	newSession.DateCreated = time.Now()
+	newSession.RotationExpires = 0
+
+	// both keys share counters, so the rotation must not reset the quota,
+	// nor the rate limit buckets which are keyed by LastUpdated
+	lifetime := newSession.Lifetime(0)
+	if err := GlobalSessionManager.UpdateSession(newKey, &newSession, lifetime, false); err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to rotate key - "+err.Error()))
+		return
+	}
+
+	// the old key lives on only for the grace period
+	graceExpires := time.Now().Unix() + gracePeriod
+	if oldSession.Expires <= 0 || oldSession.Expires > graceExpires {
+		oldSession.Expires = graceExpires
+	}
+	if oldSession.CounterKeyHash == "" {
+		oldSession.CounterKeyHash = newSession.CounterKeyHash
+	}
+	// requests made with the old key save its session again, its lifetime
+	// is capped so those writes don't keep it past the grace period
+	oldSession.RotationExpires = graceExpires
+	if gracePeriod == 0 {
+		GlobalSessionManager.RemoveSession(orgID, keyName, isHashed)
+	} else if err := GlobalSessionManager.UpdateSession(keyName, &oldSession, oldSession.Lifetime(0), isHashed); err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to rotate key - "+err.Error()))
+		return
+	}
+
+	FireSystemEvent(EventTokenCreated, EventTokenMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Key generated by rotation."},
+		Org:              newSession.OrgID,
+		Key:              newKey,
+	})
+
+	if gracePeriod == 0 {
+		fireRotatedKeyDeleted(oldSession.OrgID, keyName)
+	} else {
+		FireSystemEvent(EventTokenUpdated, EventTokenMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Key rotated, expires after grace period."},
+			Org:              oldSession.OrgID,
+			Key:              keyName,
+		})
+
+		// the storage TTL set above removes the old key, it is tracked
+		// until then so that any node can tell event handlers
+		trackRotatedKey(rotatedKey{OrgID: oldSession.OrgID, Key: keyName, Hashed: isHashed}, graceExpires)
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":       "api",
+		"key":          obfuscateKey(keyName),
+		"new_key":      obfuscateKey(newKey),
+		"grace_period": gracePeriod,
+		"status":       "ok",
+	}).Info("Rotated key.")
+
+	obj := apiModifyKeySuccess{
+		Action: "rotated",
+		Key:    newKey,
+		Status: "ok",
+	}
+
+	if config.Global().HashKeys {
+		obj.KeyHash = storage.HashKey(newKey)
+	}
+
+	doJSONWrite(w, http.StatusOK, obj)
+}
+
+func fireRotatedKeyDeleted(orgID, keyName string) {
+	FireSystemEvent(EventTokenDeleted, EventTokenMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Rotated key expired."},
+		Org:              orgID,
+		Key:              keyName,
+	})
+}
+
+// rotatedKeysSet is the sorted set of the keys in their rotation grace
+// period, scored by the end of it. It lives in storage so that the deletion
+// event survives restarts and is fired by whichever node checks first.
+const rotatedKeysSet = "rotated-keys"
+
+type rotatedKey struct {
+	OrgID  string `json:"org_id"`
+	Key    string `json:"key"`
+	Hashed bool   `json:"hashed"`
+}
+
+func rotatedKeysStore() storage.Handler {
+	return storage.New("", false, false)
+}
+
+func trackRotatedKey(key rotatedKey, expires int64) {
+	member, err := json.Marshal(key)
+	if err != nil {
+		return
+	}
+	rotatedKeysStore().AddToSortedSet(rotatedKeysSet, string(member), float64(expires))
+}
+
+// expireRotatedKeys fires TokenDeleted for the rotated keys whose grace period
+// is over. Each key is claimed first, so only one node fires its event.
+func expireRotatedKeys() {
+	store := rotatedKeysStore()
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	members, _, err := store.GetSortedSetRange(rotatedKeysSet, "-inf", now)
+	if err != nil || len(members) == 0 {
+		return
+	}
+
+	for _, member := range members {
+		var key rotatedKey
+		if err := json.Unmarshal([]byte(member), &key); err != nil {
+			continue
+		}
+		// the key was saved again without its rotation expiry
+		if _, found := GlobalSessionManager.SessionDetail(key.OrgID, key.Key, key.Hashed); found {
+			continue
+		}
+		if store.IncrememntWithExpire(rotatedKeysSet+"-claim-"+storage.HashStr(member), 60) == 1 {
+			fireRotatedKeyDeleted(key.OrgID, key.Key)
+		}
+	}
+
+	store.RemoveSortedSetRange(rotatedKeysSet, "-inf", now)
+}
+
+// rotatedKeyExpiryLoop checks for rotated keys at the end of their grace
+// period.
+func rotatedKeyExpiryLoop(ctx context.Context) {
+	ticker := time.NewTicker(rotatedKeyExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expireRotatedKeys()
+		}
+	}
+}
+
+const rotatedKeyExpiryInterval = 10 * time.Second
+
 type PolicyUpdateObj struct {
 	Policy        string   `json:"policy"`
 	ApplyPolicies []string `json:"apply_policies"`
@@ -2117,7 +2309,7 @@ func invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
 
 	keyPrefix := "cache-" + apiID
 	matchPattern := keyPrefix + "*"
-	store := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true}
+	store := storage.New(keyPrefix, false, true)
 
 	if ok := store.DeleteScanMatch(matchPattern); !ok {
 		err := errors.New("scan/delete failed")
@@ -2141,6 +2333,11 @@ func invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	inv := &cacheInvalidation{APIID: apiID, All: true}
+	getResponseCacheL1().invalidate(inv)
+	notifyCacheInvalidation(inv)
+	fireCacheInvalidatedEvent(inv, 0)
+
 	doJSONWrite(w, http.StatusOK, apiOk("cache invalidated"))
 }
 
@@ -2333,6 +2530,15 @@ func ctxSetDoNotTrack(r *http.Request, b bool) {
 	setCtxValue(r, ctx.DoNotTrackThisEndpoint, b)
 }
 
+func ctxGetAnalyticsSample(r *http.Request) (analyticsSample, bool) {
+	v, ok := r.Context().Value(ctx.AnalyticsSample).(analyticsSample)
+	return v, ok
+}
+
+func ctxSetAnalyticsSample(r *http.Request, s analyticsSample) {
+	setCtxValue(r, ctx.AnalyticsSample, s)
+}
+
 func ctxGetVersionInfo(r *http.Request) *apidef.VersionInfo {
 	if v := r.Context().Value(ctx.VersionData); v != nil {
 		return v.(*apidef.VersionInfo)
@@ -2456,6 +2662,30 @@ func ctxGetGraphQLIsWebSocketUpgrade(r *http.Request) (isWebSocketUpgrade bool)
 	return false
 }
 
+func ctxSetJWTClaims(r *http.Request, claims jwt.MapClaims) {
+	setCtxValue(r, ctx.JWTClaims, claims)
+}
+
+func ctxGetJWTClaims(r *http.Request) jwt.MapClaims {
+	if v := r.Context().Value(ctx.JWTClaims); v != nil {
+		if claims, ok := v.(jwt.MapClaims); ok {
+			return claims
+		}
+	}
+	return nil
+}
+
+func ctxSetAuthFailures(r *http.Request, failures *[]func()) {
+	setCtxValue(r, ctx.AuthFailures, failures)
+}
+
+func ctxGetAuthFailures(r *http.Request) *[]func() {
+	if failures, ok := r.Context().Value(ctx.AuthFailures).(*[]func()); ok {
+		return failures
+	}
+	return nil
+}
+
 func ctxGetDefaultVersion(r *http.Request) bool {
 	return r.Context().Value(ctx.VersionDefault) != nil
 }
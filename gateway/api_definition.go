@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -9,7 +10,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -162,6 +162,13 @@ type APISpec struct {
 	*apidef.APIDefinition
 	sync.RWMutex
 
+	// rawDefinition is the definition as loaded when APIDefinition is a
+	// copy with its templates or KV references resolved.
+	rawDefinition *apidef.APIDefinition
+	// templateKVRefs holds the KV references resolved by the templates of
+	// the definition file.
+	templateKVRefs map[string]string
+
 	RxPaths                  map[string][]URLSpec
 	WhiteListEnabled         map[string]bool
 	target                   *url.URL
@@ -190,6 +197,8 @@ type APISpec struct {
 
 	network NetworkStats
 
+	analyticsRedactor *analyticsRedactor
+
 	GraphQLExecutor struct {
 		Engine   *graphql.ExecutionEngine
 		EngineV2 *graphql.ExecutionEngineV2
@@ -202,6 +211,15 @@ type APISpec struct {
 	}
 }
 
+// definition returns the API definition as it was loaded, with its KV
+// references.
+func (s *APISpec) definition() *apidef.APIDefinition {
+	if s.rawDefinition != nil {
+		return s.rawDefinition
+	}
+	return s.APIDefinition
+}
+
 // Release re;leases all resources associated with API spec
 func (s *APISpec) Release() {
 	// release circuit breaker resources
@@ -286,6 +304,8 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 
 	spec.GlobalConfig = config.Global()
 
+	spec.analyticsRedactor = newAnalyticsRedactor(logger, spec.GlobalConfig.AnalyticsConfig.Redaction, def.AnalyticsRedaction)
+
 	// Create and init the virtual Machine
 	if config.Global().EnableJSVM {
 		mwPaths, _, _, _, _, _, _ := loadCustomMiddleware(spec)
@@ -507,19 +527,37 @@ func (a APIDefinitionLoader) FromDir(dir string) []*APISpec {
 	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
 	for _, path := range paths {
 		log.Info("Loading API Specification from ", path)
-		f, err := os.Open(path)
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			log.Error("Couldn't open api configuration file: ", err)
 			continue
 		}
-		def := a.ParseDefinition(f)
-		f.Close()
-		spec := a.MakeSpec(def, nil)
+		spec, err := a.makeSpecFromFile(data)
+		if err != nil {
+			log.WithField("file", path).Error("Couldn't expand api configuration templates: ", err)
+			continue
+		}
 		specs = append(specs, spec)
 	}
 	return specs
 }
 
+// makeSpecFromFile makes a spec from the definition file data, expanding its
+// templates. The definition as written is kept for the control API, so the
+// values resolved by the templates aren't exposed.
+func (a APIDefinitionLoader) makeSpecFromFile(data []byte) (*APISpec, error) {
+	expanded, refs, err := expandFileTemplates(data)
+	if err != nil {
+		return nil, err
+	}
+	spec := a.MakeSpec(a.ParseDefinition(bytes.NewReader(expanded)), nil)
+	if hasFileTemplates(data) {
+		spec.rawDefinition = a.ParseDefinition(bytes.NewReader(data))
+		spec.templateKVRefs = refs
+	}
+	return spec, nil
+}
+
 func (a APIDefinitionLoader) getPathSpecs(apiVersionDef apidef.VersionInfo) ([]URLSpec, bool) {
 	ignoredPaths := a.compilePathSpec(apiVersionDef.Paths.Ignored, Ignored)
 	blackListPaths := a.compilePathSpec(apiVersionDef.Paths.BlackList, BlackList)
@@ -790,6 +828,7 @@ func (a APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.Circui
 						}
 					}
 
+					prometheusMetrics.breakerState(spec, path, true)
 					spec.FireEvent(EventBreakerTriggered, EventCurcuitBreakerMeta{
 						EventMetaDefault: EventMetaDefault{Message: "Breaker Tripped"},
 						CircuitEvent:     e,
@@ -798,6 +837,7 @@ func (a APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.Circui
 					})
 
 				case circuit.BreakerReset:
+					prometheusMetrics.breakerState(spec, path, false)
 					spec.FireEvent(EventBreakerTriggered, EventCurcuitBreakerMeta{
 						EventMetaDefault: EventMetaDefault{Message: "Breaker Reset"},
 						CircuitEvent:     e,
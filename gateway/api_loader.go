@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"reflect"
 	"runtime/debug"
 	"sort"
 	"strconv"
@@ -36,9 +37,9 @@ type ChainObject struct {
 
 func prepareStorage() generalStores {
 	var gs generalStores
-	gs.redisStore = &storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: config.Global().HashKeys}
-	gs.redisOrgStore = &storage.RedisCluster{KeyPrefix: "orgkey."}
-	gs.healthStore = &storage.RedisCluster{KeyPrefix: "apihealth."}
+	gs.redisStore = storage.New("apikey-", config.Global().HashKeys, false)
+	gs.redisOrgStore = storage.New("orgkey.", false, false)
+	gs.healthStore = storage.New("apihealth.", false, false)
 	gs.rpcAuthStore = &RPCStorageHandler{KeyPrefix: "apikey-", HashKeys: config.Global().HashKeys}
 	gs.rpcOrgStore = &RPCStorageHandler{KeyPrefix: "orgkey."}
 	GlobalSessionManager.Init(gs.redisStore)
@@ -118,6 +119,12 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 		"prefix": "coprocess",
 	})
 
+	if err := resolveSpecKVRefs(spec); err != nil {
+		logger.WithError(err).Error("Spec not valid, skipped!")
+		chainDef.Skip = true
+		return &chainDef
+	}
+
 	if strings.Contains(spec.Proxy.TargetURL, "h2c://") {
 		spec.Proxy.TargetURL = strings.Replace(spec.Proxy.TargetURL, "h2c://", "http://", 1)
 	}
@@ -222,6 +229,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	if spec.CustomMiddlewareBundle != "" {
 		if err := loadBundle(spec); err != nil {
 			logger.WithError(err).Error("Couldn't load bundle")
+			firePluginLoadFailure(spec, err)
 		}
 		prefix = getBundleDestPath(spec)
 	}
@@ -294,12 +302,13 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 
 	keyPrefix := "cache-" + spec.APIID
-	cacheStore := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true}
+	cacheStore := storage.New(keyPrefix, false, true)
 	cacheStore.Connect()
 
 	var chain http.Handler
 	var chainArray []alice.Constructor
 	var authArray []alice.Constructor
+	var authMws []TykMiddleware
 
 	if spec.UseKeylessAccess {
 		chainDef.Open = true
@@ -336,23 +345,23 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 
 	if !spec.UseKeylessAccess {
 		// Select the keying method to use for setting session states
-		if mwAppendEnabled(&authArray, &Oauth2KeyExists{baseMid}) {
+		if mwEnabled(&authMws, &Oauth2KeyExists{baseMid}) {
 			logger.Info("Checking security policy: OAuth")
 		}
 
-		if mwAppendEnabled(&authArray, &BasicAuthKeyIsValid{baseMid, nil, nil}) {
+		if mwEnabled(&authMws, &BasicAuthKeyIsValid{baseMid, nil, nil}) {
 			logger.Info("Checking security policy: Basic")
 		}
 
-		if mwAppendEnabled(&authArray, &HTTPSignatureValidationMiddleware{BaseMiddleware: baseMid}) {
+		if mwEnabled(&authMws, &HTTPSignatureValidationMiddleware{BaseMiddleware: baseMid}) {
 			logger.Info("Checking security policy: HMAC")
 		}
 
-		if mwAppendEnabled(&authArray, &JWTMiddleware{baseMid}) {
+		if mwEnabled(&authMws, &JWTMiddleware{baseMid}) {
 			logger.Info("Checking security policy: JWT")
 		}
 
-		if mwAppendEnabled(&authArray, &OpenIDMW{BaseMiddleware: baseMid}) {
+		if mwEnabled(&authMws, &OpenIDMW{BaseMiddleware: baseMid}) {
 			logger.Info("Checking security policy: OpenID")
 		}
 
@@ -364,22 +373,22 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 			coprocessLog.Debug("Registering coprocess middleware, hook name: ", mwAuthCheckFunc.Name, "hook type: CustomKeyCheck", ", driver: ", mwDriver)
 
 			newExtractor(spec, baseMid)
-			mwAppendEnabled(&authArray, &CoProcessMiddleware{baseMid, coprocess.HookType_CustomKeyCheck, mwAuthCheckFunc.Name, mwDriver, mwAuthCheckFunc.RawBodyOnly, nil})
+			mwEnabled(&authMws, &CoProcessMiddleware{baseMid, coprocess.HookType_CustomKeyCheck, mwAuthCheckFunc.Name, mwDriver, mwAuthCheckFunc.RawBodyOnly, nil})
 		}
 
 		if ottoAuth {
 			logger.Info("----> Checking security policy: JS Plugin")
-			authArray = append(authArray, createMiddleware(&DynamicMiddleware{
+			authMws = append(authMws, &DynamicMiddleware{
 				BaseMiddleware:      baseMid,
 				MiddlewareClassName: mwAuthCheckFunc.Name,
 				Pre:                 true,
 				Auth:                true,
-			}))
+			})
 		}
 
 		if gopluginAuth {
-			mwAppendEnabled(
-				&authArray,
+			mwEnabled(
+				&authMws,
 				&GoPluginMiddleware{
 					BaseMiddleware: baseMid,
 					Path:           mwAuthCheckFunc.Path,
@@ -388,9 +397,18 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 			)
 		}
 
-		if spec.UseStandardAuth || len(authArray) == 0 {
+		if spec.UseStandardAuth || len(authMws) == 0 {
 			logger.Info("Checking security policy: Token")
-			authArray = append(authArray, createMiddleware(&AuthKey{baseMid}))
+			authMws = append(authMws, &AuthKey{baseMid})
+		}
+
+		if spec.AuthMode == apidef.AuthModeAny && len(authMws) > 1 {
+			logger.Info("Checking security policy: any of the auth methods")
+			mwAppendEnabled(&authArray, &MultiAuthMiddleware{BaseMiddleware: baseMid, Methods: authMws})
+		} else {
+			for _, mw := range authMws {
+				authArray = append(authArray, createMiddleware(mw))
+			}
 		}
 
 		chainArray = append(chainArray, authArray...)
@@ -415,7 +433,10 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 		mwAppendEnabled(&chainArray, &KeyExpired{baseMid})
 		mwAppendEnabled(&chainArray, &AccessRightsCheck{baseMid})
 		mwAppendEnabled(&chainArray, &GranularAccessMiddleware{baseMid})
+		mwAppendEnabled(&chainArray, &ExternalAuthzMiddleware{BaseMiddleware: baseMid})
 		mwAppendEnabled(&chainArray, &RateLimitAndQuotaCheck{baseMid})
+	} else {
+		mwAppendEnabled(&chainArray, &ExternalAuthzMiddleware{BaseMiddleware: baseMid})
 	}
 
 	mwAppendEnabled(&chainArray, &RateLimitForAPI{BaseMiddleware: baseMid})
@@ -453,7 +474,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 	//Do not add middlewares after cache middleware.
 	//It will not get executed
-	mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: &cacheStore})
+	mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: cacheStore})
 
 	chain = alice.New(chainArray...).Then(&DummyProxyHandler{SH: SuccessHandler{baseMid}})
 
@@ -822,6 +843,18 @@ func loadApps(specs []*APISpec) {
 	// Swap in the new register
 	apisMu.Lock()
 
+	oldIDs := make([]string, 0, len(apisByID))
+	for id := range apisByID {
+		oldIDs = append(oldIDs, id)
+	}
+	newIDs := make([]string, 0, len(tmpSpecRegister))
+	for id := range tmpSpecRegister {
+		newIDs = append(newIDs, id)
+	}
+	reloadMeta := newReloadMeta(oldIDs, newIDs, func(id string) bool {
+		return !reflect.DeepEqual(apisByID[id].definition(), tmpSpecRegister[id].definition())
+	})
+
 	// release current specs resources before overwriting map
 	for _, curSpec := range apisByID {
 		curSpec.Release()
@@ -832,6 +865,15 @@ func loadApps(specs []*APISpec) {
 
 	apisMu.Unlock()
 
+	pruneKVRefs(kvRefOwnerAPI, func(id string) bool {
+		_, ok := tmpSpecRegister[id]
+		return ok
+	})
+
+	FireSystemEvent(EventAPIsReloaded, reloadMeta)
+	prometheusMetrics.reloaded("apis")
+	checkCertificateExpiry(specs)
+
 	mainLog.Debug("Checker host list")
 
 	// Kick off our host checkers
@@ -1,8 +1,11 @@
 package gateway
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/TykTechnologies/tyk/test"
 
 	"github.com/TykTechnologies/tyk/trace"
+	"github.com/TykTechnologies/tyk/user"
 )
 
 func TestOpenTracing(t *testing.T) {
@@ -50,6 +54,61 @@ func TestOpenTracing(t *testing.T) {
 	})
 }
 
+func TestOpenTelemetryTracing(t *testing.T) {
+	var exported bytes.Buffer
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		exported.Write(body)
+	}))
+	defer collector.Close()
+
+	globalConf := config.Global()
+	globalConf.EnableRedisRollingLimiter = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	trace.SetInit(trace.Init)
+	trace.SetupTracing("opentelemetry", map[string]interface{}{"exporter": "http", "endpoint": collector.URL})
+	closed := false
+	defer func() {
+		if !closed {
+			trace.Close()
+		}
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Name = "otel"
+		spec.APIID = "otel-api"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+	key := CreateSession(func(s *user.SessionState) {
+		s.Alias = "otel-alias"
+	})
+
+	ts.Run(t, test.TestCase{
+		Path: "/",
+		Headers: map[string]string{
+			"Authorization": key,
+			"traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Code:      http.StatusOK,
+		BodyMatch: `"Traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-`,
+	})
+
+	trace.Close()
+	closed = true
+
+	for _, want := range []string{"AuthKey", "RateLimitAndQuotaCheck", "redis pipeline", "tyk.api.id", "otel-api", "tyk.key.alias", "otel-alias"} {
+		if !bytes.Contains(exported.Bytes(), []byte(want)) {
+			t.Errorf("Expected the exported spans to contain %q", want)
+		}
+	}
+}
+
 func TestInternalAPIUsage(t *testing.T) {
 	g := StartTest()
 	defer g.Close()
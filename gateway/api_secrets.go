@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const defaultKVRefreshInterval = 60
+
+var kvRefPrefixes = []string{"secrets://", "env://", "consul://", "vault://"}
+
+const (
+	kvRefOwnerAPI    = "api/"
+	kvRefOwnerPolicy = "policy/"
+	// kvRefOwnerPolicyFile owns the references of the templates of the
+	// policy file or of the synced policies.
+	kvRefOwnerPolicyFile = "policy-file"
+)
+
+// kvRefs holds the KV references resolved in the loaded API definitions and
+// policies along with their last value, so secret changes can be detected.
+// They are grouped by the API or policy using them, so the references of
+// removed ones can be dropped.
+var kvRefs = struct {
+	sync.Mutex
+	values map[string]map[string]string
+}{values: map[string]map[string]string{}}
+
+func isKVRef(value string) bool {
+	for _, prefix := range kvRefPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setKVRefs records the references resolved for owner, replacing the ones
+// recorded before.
+func setKVRefs(owner string, refs map[string]string) {
+	kvRefs.Lock()
+	defer kvRefs.Unlock()
+	if len(refs) == 0 {
+		delete(kvRefs.values, owner)
+		return
+	}
+	kvRefs.values[owner] = refs
+}
+
+// pruneKVRefs drops the references of the owners of kind that are not in
+// loaded anymore.
+func pruneKVRefs(kind string, loaded func(id string) bool) {
+	kvRefs.Lock()
+	defer kvRefs.Unlock()
+	for owner := range kvRefs.values {
+		if strings.HasPrefix(owner, kind) && !loaded(strings.TrimPrefix(owner, kind)) {
+			delete(kvRefs.values, owner)
+		}
+	}
+}
+
+// kvResolver resolves the KV references of a definition and records whether
+// it held any. The first reference that can't be resolved is kept in err.
+type kvResolver struct {
+	refs  map[string]string
+	found bool
+	err   error
+}
+
+func (k *kvResolver) value(value string) string {
+	if !isKVRef(value) {
+		return value
+	}
+	k.found = true
+	resolved, err := kvStore(value)
+	if err != nil {
+		if k.err == nil {
+			k.err = fmt.Errorf("couldn't resolve KV reference %s: %v", value, err)
+		}
+		return value
+	}
+	if k.refs == nil {
+		k.refs = map[string]string{}
+	}
+	k.refs[value] = resolved
+	return resolved
+}
+
+// headers returns a copy of m with its values resolved, so the map of the
+// loaded definition keeps the references.
+func (k *kvResolver) headers(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	resolved := make(map[string]string, len(m))
+	for name, value := range m {
+		resolved[name] = k.value(value)
+	}
+	return resolved
+}
+
+func (k *kvResolver) injections(metas []apidef.HeaderInjectionMeta) []apidef.HeaderInjectionMeta {
+	if metas == nil {
+		return nil
+	}
+	resolved := make([]apidef.HeaderInjectionMeta, len(metas))
+	for i, meta := range metas {
+		meta.AddHeaders = k.headers(meta.AddHeaders)
+		resolved[i] = meta
+	}
+	return resolved
+}
+
+// resolveSpecKVRefs resolves the KV references in the secret fields and
+// injected headers of spec into a copy of its definition, which replaces
+// APIDefinition. The loaded definition, still holding the references, is
+// kept for the control API and for change detection. An error is returned
+// when a reference can't be resolved, the spec must not be loaded then.
+func resolveSpecKVRefs(spec *APISpec) error {
+	k := &kvResolver{}
+	for ref, value := range spec.templateKVRefs {
+		if k.refs == nil {
+			k.refs = map[string]string{}
+		}
+		k.refs[ref] = value
+	}
+	defer func() { setKVRefs(kvRefOwnerAPI+spec.APIID, k.refs) }()
+	def := *spec.APIDefinition
+
+	def.UpstreamCertificates = k.headers(def.UpstreamCertificates)
+	def.RequestSigning.Secret = k.value(def.RequestSigning.Secret)
+	def.JWTSource = k.value(def.JWTSource)
+
+	def.Auth.Signature.Secret = k.value(def.Auth.Signature.Secret)
+	if def.AuthConfigs != nil {
+		authConfigs := make(map[string]apidef.AuthConfig, len(def.AuthConfigs))
+		for name, authConfig := range def.AuthConfigs {
+			authConfig.Signature.Secret = k.value(authConfig.Signature.Secret)
+			authConfigs[name] = authConfig
+		}
+		def.AuthConfigs = authConfigs
+	}
+
+	versions := make(map[string]apidef.VersionInfo, len(def.VersionData.Versions))
+	for name, version := range def.VersionData.Versions {
+		version.GlobalHeaders = k.headers(version.GlobalHeaders)
+		version.GlobalResponseHeaders = k.headers(version.GlobalResponseHeaders)
+		version.ExtendedPaths.TransformHeader = k.injections(version.ExtendedPaths.TransformHeader)
+		version.ExtendedPaths.TransformResponseHeader = k.injections(version.ExtendedPaths.TransformResponseHeader)
+		versions[name] = version
+	}
+	def.VersionData.Versions = versions
+
+	if k.err != nil {
+		return k.err
+	}
+	if !k.found {
+		return nil
+	}
+	// the definition of a templated file was kept as written when loading
+	if spec.rawDefinition == nil {
+		spec.rawDefinition = spec.APIDefinition
+	}
+	spec.APIDefinition = &def
+
+	// the compiled paths share the header maps of the loaded definition
+	for _, paths := range spec.RxPaths {
+		for i := range paths {
+			paths[i].InjectHeaders.AddHeaders = k.headers(paths[i].InjectHeaders.AddHeaders)
+			paths[i].InjectHeadersResponse.AddHeaders = k.headers(paths[i].InjectHeadersResponse.AddHeaders)
+		}
+	}
+	return nil
+}
+
+// resolvePolicyKVRefs resolves the KV references in the string meta data
+// values of the policies into copies of their meta data. It returns the
+// policies that held references as they were loaded. Policies with a
+// reference that can't be resolved are removed from pols.
+func resolvePolicyKVRefs(pols map[string]user.Policy) map[string]user.Policy {
+	logger := mainLog.WithField("prefix", "policy")
+	defs := map[string]user.Policy{}
+	for id, pol := range pols {
+		k := &kvResolver{}
+		metaData := make(map[string]interface{}, len(pol.MetaData))
+		for key, v := range pol.MetaData {
+			if s, ok := v.(string); ok {
+				v = k.value(s)
+			}
+			metaData[key] = v
+		}
+		setKVRefs(kvRefOwnerPolicy+id, k.refs)
+		if k.err != nil {
+			logger.WithError(k.err).Error("Skipping policy: ", id)
+			delete(pols, id)
+			continue
+		}
+		if !k.found {
+			continue
+		}
+		defs[id] = pol
+		pol.MetaData = metaData
+		pols[id] = pol
+	}
+	return defs
+}
+
+// loadedPolicy returns the policy id as it was loaded, with its KV
+// references, given the resolved policies and the ones that held references.
+func loadedPolicy(pols, defs map[string]user.Policy, id string) user.Policy {
+	if pol, ok := defs[id]; ok {
+		return pol
+	}
+	return pols[id]
+}
+
+// kvRefsChanged resolves the known KV references again and reports whether
+// any of their values changed.
+func kvRefsChanged() bool {
+	kvRefs.Lock()
+	refs := map[string]string{}
+	for _, owned := range kvRefs.values {
+		for ref, value := range owned {
+			refs[ref] = value
+		}
+	}
+	kvRefs.Unlock()
+
+	changed := false
+	for ref, value := range refs {
+		resolved, err := kvStore(ref)
+		if err != nil {
+			mainLog.WithError(err).Debug("Couldn't resolve KV reference: ", ref)
+			continue
+		}
+		if resolved != value {
+			mainLog.Info("KV reference changed: ", ref)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// kvRefreshLoop periodically resolves the KV references of the loaded APIs
+// and policies, and reloads them when a secret changed.
+func kvRefreshLoop(ctx context.Context) {
+	interval := config.Global().KV.RefreshInterval
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultKVRefreshInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if kvRefsChanged() {
+				reloadURLStructure(nil)
+			}
+		}
+	}
+}
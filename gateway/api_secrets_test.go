@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestAPIKVReferences(t *testing.T) {
+	setSecret := func(value string) {
+		globalConf := config.Global()
+		globalConf.Secrets = map[string]string{"upstream-token": value, "signing": "secret"}
+		config.SetGlobal(globalConf)
+	}
+	setSecret("v1")
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	buildAPI := func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.RequestSigning.Secret = "secrets://signing"
+		spec.AuthConfigs = map[string]apidef.AuthConfig{
+			"authToken": {Signature: apidef.SignatureConfig{Secret: "secrets://signing"}},
+		}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.GlobalHeaders = map[string]string{"X-Token": "secrets://upstream-token"}
+		})
+	}
+	spec := BuildAndLoadAPI(buildAPI)[0]
+
+	if spec.RequestSigning.Secret != "secret" || spec.AuthConfigs["authToken"].Signature.Secret != "secret" {
+		t.Error("expected the secret fields to be resolved")
+	}
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: 200, BodyMatch: `"X-Token":"v1"`},
+		{Path: "/tyk/apis/" + spec.APIID, AdminAuth: true, Code: 200, BodyMatch: `"X-Token":"secrets://upstream-token"`, BodyNotMatch: `"X-Token":"v1"`},
+	}...)
+
+	if kvRefsChanged() {
+		t.Error("no secret changed yet")
+	}
+	setSecret("v2")
+	if !kvRefsChanged() {
+		t.Fatal("expected the secret change to be detected")
+	}
+
+	BuildAndLoadAPI(buildAPI)
+	ts.Run(t, test.TestCase{Path: "/", Code: 200, BodyMatch: `"X-Token":"v2"`})
+
+	t.Run("policies", func(t *testing.T) {
+		pols := map[string]user.Policy{
+			"pol": {MetaData: map[string]interface{}{"token": "secrets://upstream-token", "count": 1}},
+		}
+		defs := resolvePolicyKVRefs(pols)
+		if pols["pol"].MetaData["token"] != "v2" || pols["pol"].MetaData["count"] != 1 {
+			t.Errorf("unexpected meta data %v", pols["pol"].MetaData)
+		}
+		if defs["pol"].MetaData["token"] != "secrets://upstream-token" {
+			t.Errorf("expected the loaded policy to keep the reference, got %v", defs["pol"].MetaData)
+		}
+
+		pols = map[string]user.Policy{
+			"missing": {MetaData: map[string]interface{}{"token": "secrets://missing"}},
+		}
+		resolvePolicyKVRefs(pols)
+		if _, ok := pols["missing"]; ok {
+			t.Error("expected the policy with an unresolved reference to be skipped")
+		}
+	})
+
+	t.Run("unresolved reference", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.RequestSigning.Secret = "secrets://missing"
+		})
+		ts.Run(t, test.TestCase{Path: "/", Code: 404})
+	})
+
+	t.Run("stale references", func(t *testing.T) {
+		hasRefs := func(owner string) bool {
+			kvRefs.Lock()
+			defer kvRefs.Unlock()
+			_, ok := kvRefs.values[owner]
+			return ok
+		}
+
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "removed"
+			spec.Proxy.ListenPath = "/"
+			spec.RequestSigning.Secret = "secrets://signing"
+		})
+		if !hasRefs(kvRefOwnerAPI + "removed") {
+			t.Fatal("expected the references of the API to be recorded")
+		}
+
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+		})
+		if hasRefs(kvRefOwnerAPI + "removed") {
+			t.Error("expected the references of the removed API to be dropped")
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	uuid "github.com/satori/go.uuid"
@@ -546,6 +547,193 @@ func TestKeyHandler_CheckKeysNotDuplicateOnUpdate(t *testing.T) {
 	}
 }
 
+func TestRotateKeyHandler(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+
+	withQuota := func(s *user.SessionState) {
+		s.QuotaMax = 3
+		s.AccessRights = map[string]user.AccessDefinition{"test": {
+			APIID: "test", Versions: []string{"v1"},
+		}}
+	}
+
+	rotate := func(t *testing.T, key, query string) string {
+		resp, _ := ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/keys/" + key + "/rotate" + query,
+			AdminAuth: true,
+			Code:      http.StatusOK,
+			BodyMatch: `"action":"rotated"`,
+		})
+
+		var res apiModifyKeySuccess
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Key
+	}
+
+	authHeader := func(key string) map[string]string {
+		return map[string]string{"Authorization": key}
+	}
+
+	t.Run("Unknown key", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/keys/unknown/rotate",
+			AdminAuth: true,
+			Code:      http.StatusNotFound,
+		})
+	})
+
+	t.Run("Invalid grace period", func(t *testing.T) {
+		key := CreateSession(withQuota)
+		ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/keys/" + key + "/rotate?grace_period=soon",
+			AdminAuth: true,
+			Code:      http.StatusBadRequest,
+		})
+	})
+
+	t.Run("Shared quota during grace period", func(t *testing.T) {
+		oldKey := CreateSession(withQuota)
+		newKey := rotate(t, oldKey, "?grace_period=60")
+		if newKey == "" || newKey == oldKey {
+			t.Fatal("Expected a new key, got:", newKey)
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Headers: authHeader(oldKey), Code: http.StatusOK},
+			{Headers: authHeader(newKey), Code: http.StatusOK},
+			{Headers: authHeader(oldKey), Code: http.StatusOK},
+			{Headers: authHeader(newKey), Code: http.StatusForbidden},
+			{Headers: authHeader(oldKey), Code: http.StatusForbidden},
+		}...)
+
+		oldSession, found := GlobalSessionManager.SessionDetail("", oldKey, false)
+		if !found {
+			t.Fatal("Old key should still exist during the grace period")
+		}
+		if oldSession.Expires <= 0 || oldSession.Expires > time.Now().Unix()+60 {
+			t.Error("Old key should expire after the grace period, got:", oldSession.Expires)
+		}
+		if ttl, _ := GlobalSessionManager.Store().GetExp(oldKey); ttl <= 0 || ttl > 60 {
+			t.Error("Old key should carry the grace period as its storage TTL, got:", ttl)
+		}
+
+		newSession, _ := GlobalSessionManager.SessionDetail("", newKey, false)
+		if newSession.Expires != -1 {
+			t.Error("New key should keep the original expiry, got:", newSession.Expires)
+		}
+
+		ts.Run(t, test.TestCase{Method: http.MethodGet, Path: "/tyk/keys/" + newKey, AdminAuth: true,
+			Code: http.StatusOK, BodyMatch: `"quota_remaining":0`})
+
+		GlobalSessionManager.ResetQuota(newKey, &newSession, false)
+		time.Sleep(10 * time.Millisecond)
+		ts.Run(t, test.TestCase{Headers: authHeader(newKey), Code: http.StatusOK})
+	})
+
+	t.Run("No grace period", func(t *testing.T) {
+		oldKey := CreateSession(withQuota)
+		newKey := rotate(t, oldKey, "?grace_period=0")
+
+		ts.Run(t, []test.TestCase{
+			{Headers: authHeader(oldKey), Code: http.StatusForbidden},
+			{Headers: authHeader(newKey), Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("Shared rate limit during grace period", func(t *testing.T) {
+		oldKey := CreateSession(func(s *user.SessionState) {
+			s.Rate = 2
+			s.Per = 60
+			s.QuotaMax = -1
+			s.AccessRights = map[string]user.AccessDefinition{"test": {
+				APIID: "test", Versions: []string{"v1"},
+			}}
+		})
+		newKey := rotate(t, oldKey, "?grace_period=60")
+
+		oldSession, _ := GlobalSessionManager.SessionDetail("", oldKey, false)
+		newSession, _ := GlobalSessionManager.SessionDetail("", newKey, false)
+		if oldSession.LastUpdated != newSession.LastUpdated {
+			t.Error("Expected both keys to use the same rate limit bucket")
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Headers: authHeader(oldKey), Code: http.StatusOK},
+			{Headers: authHeader(newKey), Code: http.StatusOK},
+			{Headers: authHeader(oldKey), Code: http.StatusTooManyRequests},
+			{Headers: authHeader(newKey), Code: http.StatusTooManyRequests},
+		}...)
+	})
+
+	t.Run("Old key expires after grace period", func(t *testing.T) {
+		defer ResetTestConfig()
+		capture := captureSystemEvents(EventTokenUpdated, EventTokenDeleted)
+
+		globalConf := config.Global()
+		globalConf.ForceGlobalSessionLifetime = true
+		globalConf.GlobalSessionLifetime = 3600
+		config.SetGlobal(globalConf)
+
+		oldKey := CreateSession(withQuota)
+		rotate(t, oldKey, "?grace_period=2")
+
+		if meta := capture.next(t, EventTokenUpdated).Meta.(EventTokenMeta); meta.Key != oldKey {
+			t.Error("Expected the rotated key to be updated, got:", meta.Key)
+		}
+
+		// saving the session of the old key must not extend its lifetime
+		ts.Run(t, test.TestCase{Headers: authHeader(oldKey), Code: http.StatusOK})
+		if ttl, _ := GlobalSessionManager.Store().GetExp(oldKey); ttl <= 0 || ttl > 2 {
+			t.Error("Old key should keep the remaining grace period as its storage TTL, got:", ttl)
+		}
+
+		expireRotatedKeys()
+		select {
+		case em := <-capture.events:
+			t.Error("Expected no event during the grace period, got", em.Type)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		time.Sleep(3 * time.Second)
+		expireRotatedKeys()
+		if meta := capture.next(t, EventTokenDeleted).Meta.(EventTokenMeta); meta.Key != oldKey {
+			t.Error("Expected the rotated key to be deleted, got:", meta.Key)
+		}
+
+		// the event is only fired once
+		expireRotatedKeys()
+		select {
+		case em := <-capture.events:
+			t.Error("Expected a single event, got", em.Type)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		ts.Run(t, test.TestCase{Headers: authHeader(oldKey), Code: http.StatusForbidden})
+	})
+
+	t.Run("Rotating a rotated key keeps sharing counters", func(t *testing.T) {
+		oldKey := CreateSession(withQuota)
+		secondKey := rotate(t, oldKey, "")
+		thirdKey := rotate(t, secondKey, "")
+
+		thirdSession, _ := GlobalSessionManager.SessionDetail("", thirdKey, false)
+		if thirdSession.CounterKeyHash != storage.HashKey(oldKey) {
+			t.Error("Expected counters to be keyed by the original key, got:", thirdSession.CounterKeyHash)
+		}
+	})
+}
+
 func TestHashKeyHandler(t *testing.T) {
 	globalConf := config.Global()
 	// make it to use hashes for Redis keys
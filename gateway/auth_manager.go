@@ -114,6 +114,9 @@ func (b *DefaultSessionManager) ResetQuota(keyName string, session *user.Session
 	if !isHashed {
 		keyName = storage.HashKey(keyName)
 	}
+	// Rotated keys share their counters with the key they replaced.
+	session.SetKeyHash(keyName)
+	keyName = session.GetCounterKeyHash()
 
 	rawKey := QuotaKeyPrefix + keyName
 	log.WithFields(logrus.Fields{
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// cacheVaryPrefix marks a cache entry that only lists the request headers
+// its response varies on. The response itself is stored under a key that
+// includes the values of those headers. Base64 payloads never contain ":".
+const cacheVaryPrefix = "vary:"
+
+// varyHeaders returns the sorted, canonical request header names listed in
+// the Vary header of a response.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values(headers.Vary) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name != "*" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyCacheKey derives the key of a response variant from the key of the
+// request and the values of the headers the response varies on. The checksum
+// keeps its length, so that entries can still be found by token or IP.
+func varyCacheKey(key string, names []string, h http.Header) string {
+	prefix, sum := key[:len(key)-md5.Size*2], key[len(key)-md5.Size*2:]
+
+	hash := md5.New()
+	io.WriteString(hash, sum)
+	for _, name := range names {
+		io.WriteString(hash, "-"+name+":"+strings.Join(h.Values(name), ","))
+	}
+
+	return prefix + hex.EncodeToString(hash.Sum(nil))
+}
+
+func hasValidators(h http.Header) bool {
+	return h.Get(headers.ETag) != "" || h.Get(headers.LastModified) != ""
+}
+
+// notModified evaluates the conditional headers of a request against a cached
+// response. If-None-Match takes precedence over If-Modified-Since. Only GET and
+// HEAD requests can be answered with 304 Not Modified (RFC 9110 13.1.2).
+func notModified(r *http.Request, res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get(headers.IfNoneMatch); inm != "" {
+		return etagMatches(inm, res.Header.Get(headers.ETag))
+	}
+
+	since, err := http.ParseTime(r.Header.Get(headers.IfModifiedSince))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(res.Header.Get(headers.LastModified))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// etagMatches reports whether an If-None-Match list matches an entity tag,
+// using the weak comparison.
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,248 @@
+package gateway
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/regexp"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	defaultSurrogateKeyHeader = "Surrogate-Key"
+
+	// Cache entries are indexed in sorted sets scored by their expiry, so
+	// that entries can be found by path or surrogate key.
+	cacheIndexPaths     = "-index-paths"
+	cacheIndexSurrogate = "-index-surrogate-"
+
+	// cacheIndexSeparator separates the path from the cache key in members
+	// of the path index. Neither URL paths nor cache keys contain newlines.
+	cacheIndexSeparator = "\n"
+)
+
+// cacheInvalidation selects the cache entries of an API to invalidate. An
+// entry is invalidated if it matches any of the set criteria.
+type cacheInvalidation struct {
+	APIID         string   `json:"api_id"`
+	Path          string   `json:"path,omitempty"`
+	PathRegex     string   `json:"path_regex,omitempty"`
+	SurrogateKeys []string `json:"surrogate_keys,omitempty"`
+	Key           string   `json:"key,omitempty"`
+	IP            string   `json:"ip,omitempty"`
+	// All drops every cache entry of the API.
+	All bool `json:"all,omitempty"`
+	// Origin is the node that handled the invalidation request, it does not
+	// need to apply it again when the notification comes back.
+	Origin string `json:"origin,omitempty"`
+}
+
+func (c *cacheInvalidation) empty() bool {
+	return !c.All && c.Path == "" && c.PathRegex == "" && len(c.SurrogateKeys) == 0 && c.Key == "" && c.IP == ""
+}
+
+func cacheStoreForAPI(apiID string) storage.Handler {
+	return storage.New("cache-"+apiID, false, true)
+}
+
+// indexCacheEntry records the path and surrogate keys of a cache entry so
+// that it can be invalidated selectively.
+func indexCacheEntry(store storage.Handler, key, path string, header http.Header, surrogateHeader string, ttl int64) {
+	now := time.Now().Unix()
+	expires := float64(now + ttl)
+	expired := strconv.FormatInt(now, 10)
+
+	store.RemoveSortedSetRange(cacheIndexPaths, "-inf", expired)
+	store.AddToSortedSet(cacheIndexPaths, path+cacheIndexSeparator+key, expires)
+	extendCacheIndexExpiry(store, cacheIndexPaths, ttl)
+
+	if surrogateHeader == "" {
+		surrogateHeader = defaultSurrogateKeyHeader
+	}
+	for _, tag := range strings.Fields(header.Get(surrogateHeader)) {
+		store.RemoveSortedSetRange(cacheIndexSurrogate+tag, "-inf", expired)
+		store.AddToSortedSet(cacheIndexSurrogate+tag, key, expires)
+		extendCacheIndexExpiry(store, cacheIndexSurrogate+tag, ttl)
+	}
+}
+
+// extendCacheIndexExpiry keeps an index for as long as its longest lived
+// entry, so that the indexes of APIs which stop caching are dropped.
+func extendCacheIndexExpiry(store storage.Handler, index string, ttl int64) {
+	if exp, err := store.GetExp(index); err != nil || exp < ttl {
+		store.SetExp(index, ttl)
+	}
+}
+
+// invalidateCache removes the matching cache entries of an API and returns
+// how many were removed.
+func invalidateCache(inv *cacheInvalidation) (int, error) {
+	getResponseCacheL1().invalidate(inv)
+
+	store := cacheStoreForAPI(inv.APIID)
+	if inv.All {
+		if !store.DeleteScanMatch(store.GetKeyPrefix() + "*") {
+			return 0, errors.New("scan/delete failed")
+		}
+		return 0, nil
+	}
+
+	live := strconv.FormatInt(time.Now().Unix(), 10)
+	keys := map[string]struct{}{}
+
+	if inv.Path != "" || inv.PathRegex != "" {
+		var re *regexp.Regexp
+		if inv.PathRegex != "" {
+			var err error
+			if re, err = regexp.Compile(inv.PathRegex); err != nil {
+				return 0, err
+			}
+		}
+
+		members, _, err := store.GetSortedSetRange(cacheIndexPaths, live, "+inf")
+		if err != nil {
+			return 0, err
+		}
+
+		for _, member := range members {
+			i := strings.Index(member, cacheIndexSeparator)
+			if i < 0 {
+				continue
+			}
+			path, key := member[:i], member[i+1:]
+			if path == inv.Path || (re != nil && re.MatchString(path)) {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+
+	for _, tag := range inv.SurrogateKeys {
+		members, _, err := store.GetSortedSetRange(cacheIndexSurrogate+tag, live, "+inf")
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range members {
+			keys[key] = struct{}{}
+		}
+	}
+
+	// cache keys start with the API ID and the token or IP the request was
+	// made with, followed by a fixed length checksum
+	for _, component := range []string{inv.Key, inv.IP} {
+		if component == "" {
+			continue
+		}
+		prefix := inv.APIID + component
+		for _, key := range store.GetKeys(escapeScanPattern(prefix)) {
+			if len(key) == len(prefix)+md5.Size*2 {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+
+	removed := 0
+	for key := range keys {
+		if store.DeleteKey(key) {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// escapeScanPattern escapes the glob characters of a Redis SCAN pattern.
+func escapeScanPattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
+
+// handleCacheInvalidationNotification applies an invalidation requested on
+// another node of the cluster. That node already removed the entries from the
+// shared Redis, only the in-memory tier of this node is left to clear.
+func handleCacheInvalidationNotification(payload string) {
+	inv := &cacheInvalidation{}
+	if err := json.Unmarshal([]byte(payload), inv); err != nil {
+		pubSubLog.Error("Failed to decode cache invalidation: ", err)
+		return
+	}
+
+	if inv.Origin == GetNodeID() {
+		return
+	}
+
+	getResponseCacheL1().invalidate(inv)
+}
+
+// notifyCacheInvalidation lets the other nodes of the cluster know about an
+// invalidation handled by this node.
+func notifyCacheInvalidation(inv *cacheInvalidation) {
+	inv.Origin = GetNodeID()
+	payload, _ := json.Marshal(inv)
+	MainNotifier.Notify(Notification{
+		Command: NoticeCacheInvalidation,
+		Payload: string(payload),
+	})
+}
+
+// fireCacheInvalidatedEvent is only fired by the node handling the request,
+// not by the ones applying the notification.
+func fireCacheInvalidatedEvent(inv *cacheInvalidation, removed int) {
+	FireSystemEvent(EventCacheInvalidated, EventCacheInvalidatedMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Cache invalidated"},
+		APIID:            inv.APIID,
+		All:              inv.All,
+		Path:             inv.Path,
+		PathRegex:        inv.PathRegex,
+		SurrogateKeys:    inv.SurrogateKeys,
+		IP:               inv.IP,
+		Removed:          removed,
+	})
+}
+
+func targetedCacheInvalidationHandler(w http.ResponseWriter, r *http.Request) {
+	inv := &cacheInvalidation{}
+	if err := json.NewDecoder(r.Body).Decode(inv); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	inv.APIID = mux.Vars(r)["apiID"]
+
+	if inv.empty() {
+		doJSONWrite(w, http.StatusBadRequest, apiError("No invalidation criteria given"))
+		return
+	}
+
+	if inv.PathRegex != "" {
+		if _, err := regexp.Compile(inv.PathRegex); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Invalid path_regex: "+err.Error()))
+			return
+		}
+	}
+
+	removed, err := invalidateCache(inv)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":  "api",
+			"api_id":  inv.APIID,
+			"status":  "fail",
+			"err":     err,
+			"user_ip": requestIPHops(r),
+		}).Error("Failed to invalidate cache: ", err)
+
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Cache invalidation failed"))
+		return
+	}
+
+	notifyCacheInvalidation(inv)
+	fireCacheInvalidatedEvent(inv, removed)
+
+	doJSONWrite(w, http.StatusOK, apiOk(strconv.Itoa(removed)+" cache entries invalidated"))
+}
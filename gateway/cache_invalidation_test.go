@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestTargetedCacheInvalidation(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// "/users/1" is tagged with "users user-1"
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		w.Header().Set("Surrogate-Key", parts[0]+" "+strings.TrimSuffix(parts[0], "s")+"-"+parts[1])
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	load := func() {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+			spec.CacheOptions.EnableCache = true
+			spec.CacheOptions.CacheAllSafeRequests = true
+			spec.CacheOptions.CacheTimeout = 60
+		})
+	}
+	load()
+
+	paths := []string{"/users/1", "/users/2", "/items/1"}
+
+	// warm caches all paths and waits for the entries to be stored
+	warm := func(t *testing.T) {
+		t.Helper()
+		for _, path := range paths {
+			for i := 0; i < 50; i++ {
+				resp, _ := ts.Run(t, test.TestCase{Path: path, Code: http.StatusOK})
+				if resp.Header.Get(headers.XTykCacheStatus) == cacheStatusHit {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		// earlier misses may still be storing the same entries
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	expect := func(t *testing.T, statuses ...string) {
+		t.Helper()
+		for i, path := range paths {
+			ts.Run(t, test.TestCase{Path: path, HeadersMatch: map[string]string{headers.XTykCacheStatus: statuses[i]}})
+		}
+	}
+
+	invalidate := func(t *testing.T, body, match string) {
+		t.Helper()
+		ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/cache/test/invalidate",
+			Data:      body,
+			AdminAuth: true,
+			Code:      http.StatusOK,
+			BodyMatch: match,
+		})
+	}
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Method: http.MethodPost, Path: "/tyk/cache/test/invalidate", Data: `{}`, AdminAuth: true, Code: http.StatusBadRequest},
+			{Method: http.MethodPost, Path: "/tyk/cache/test/invalidate", Data: `{"path_regex":"["}`, AdminAuth: true, Code: http.StatusBadRequest},
+		}...)
+	})
+
+	t.Run("By path", func(t *testing.T) {
+		warm(t)
+		if exp, _ := cacheStoreForAPI("test").GetExp(cacheIndexPaths); exp <= 0 {
+			t.Error("Expected the path index to expire, got:", exp)
+		}
+		invalidate(t, `{"path":"/users/1"}`, "1 cache entries invalidated")
+		expect(t, cacheStatusMiss, cacheStatusHit, cacheStatusHit)
+	})
+
+	t.Run("By path regex", func(t *testing.T) {
+		warm(t)
+		invalidate(t, `{"path_regex":"^/users/"}`, "2 cache entries invalidated")
+		expect(t, cacheStatusMiss, cacheStatusMiss, cacheStatusHit)
+	})
+
+	t.Run("By surrogate key", func(t *testing.T) {
+		warm(t)
+		invalidate(t, `{"surrogate_keys":["user-2","items"]}`, "2 cache entries invalidated")
+		expect(t, cacheStatusHit, cacheStatusMiss, cacheStatusMiss)
+	})
+
+	t.Run("By IP", func(t *testing.T) {
+		warm(t)
+		invalidate(t, `{"ip":"10.0.0.1"}`, "0 cache entries invalidated")
+		invalidate(t, `{"ip":"127.0.0.1"}`, "3 cache entries invalidated")
+		expect(t, cacheStatusMiss, cacheStatusMiss, cacheStatusMiss)
+	})
+
+	t.Run("Notification from another node", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.ResponseCacheL1.Enabled = true
+		config.SetGlobal(globalConf)
+		responseL1 = nil
+		defer func() {
+			globalConf.ResponseCacheL1.Enabled = false
+			config.SetGlobal(globalConf)
+			responseL1 = nil
+		}()
+		load()
+
+		// the first hits after warming populate L1
+		warm(t)
+		expect(t, cacheStatusHit, cacheStatusHit, cacheStatusHit)
+		entries := responseL1.ll.Len()
+
+		handleCacheInvalidationNotification(`{"api_id":"test","path":"/items/1","origin":"` + GetNodeID() + `"}`)
+		if responseL1.ll.Len() != entries {
+			t.Error("Expected the notification of this node to be ignored")
+		}
+
+		// only the L1 tier is cleared, the entry is still served from Redis
+		handleCacheInvalidationNotification(`{"api_id":"test","path":"/items/1","origin":"other-node"}`)
+		if responseL1.ll.Len() != entries-1 {
+			t.Error("Expected the entry to be dropped from L1")
+		}
+		expect(t, cacheStatusHit, cacheStatusHit, cacheStatusHit)
+	})
+}
+
+func TestEscapeScanPattern(t *testing.T) {
+	if got := escapeScanPattern(`a*b?[c]\d`); got != `a\*b\?\[c\]\\d` {
+		t.Error("Unexpected escaped pattern:", got)
+	}
+}
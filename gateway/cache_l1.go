@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocraft/health"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+const (
+	defaultResponseCacheL1MaxEntries = 1000
+	defaultResponseCacheL1MaxSize    = 64 << 20
+)
+
+var (
+	responseL1   *responseCacheL1
+	responseL1Mu sync.Mutex
+)
+
+// getResponseCacheL1 returns the in-memory response cache of this node, or
+// nil if it is disabled. All methods of responseCacheL1 are no-ops on nil.
+func getResponseCacheL1() *responseCacheL1 {
+	conf := config.Global().ResponseCacheL1
+	if !conf.Enabled {
+		return nil
+	}
+
+	responseL1Mu.Lock()
+	defer responseL1Mu.Unlock()
+
+	if responseL1 == nil {
+		responseL1 = newResponseCacheL1(conf)
+	}
+	return responseL1
+}
+
+// l1CacheEntry is a decoded response cache entry, together with what it was
+// cached for so that invalidations can be matched without Redis.
+type l1CacheEntry struct {
+	key       string
+	apiID     string
+	path      string
+	component string
+	tags      []string
+
+	data    string
+	expires string
+	created string
+	until   time.Time
+}
+
+func (e *l1CacheEntry) size() int64 {
+	return int64(len(e.key) + len(e.data))
+}
+
+// responseCacheL1 is a size bounded LRU of decoded response cache entries.
+type responseCacheL1 struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxSize    int64
+	ttl        time.Duration
+	size       int64
+	ll         *list.List
+	items      map[string]*list.Element
+
+	hits   uint64
+	misses uint64
+	job    *health.Job
+}
+
+func newResponseCacheL1(conf config.ResponseCacheL1Conf) *responseCacheL1 {
+	c := &responseCacheL1{
+		maxEntries: conf.MaxEntries,
+		maxSize:    conf.MaxSize,
+		ttl:        time.Duration(conf.TTL) * time.Second,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		job:        instrument.NewJob("ResponseCacheL1"),
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = defaultResponseCacheL1MaxEntries
+	}
+	if c.maxSize <= 0 {
+		c.maxSize = defaultResponseCacheL1MaxSize
+	}
+	return c
+}
+
+func (c *responseCacheL1) get(key string) (*l1CacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*l1CacheEntry)
+		if time.Now().Before(entry.until) {
+			c.ll.MoveToFront(el)
+			atomic.AddUint64(&c.hits, 1)
+			c.job.Event("hit")
+			return entry, true
+		}
+		c.removeElement(el)
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	c.job.Event("miss")
+	return nil, false
+}
+
+// set stores an entry until its fresh expiry, or for the configured TTL if
+// that is shorter. Entries are never kept past the Redis entry.
+func (c *responseCacheL1) set(entry *l1CacheEntry) {
+	if c == nil {
+		return
+	}
+
+	expires, err := strconv.ParseInt(entry.expires, 10, 64)
+	if err != nil {
+		return
+	}
+
+	entry.until = time.Unix(expires, 0)
+	if c.ttl > 0 {
+		if capped := time.Now().Add(c.ttl); capped.Before(entry.until) {
+			entry.until = capped
+		}
+	}
+
+	if !time.Now().Before(entry.until) || entry.size() > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[entry.key]; ok {
+		c.removeElement(el)
+	}
+
+	c.items[entry.key] = c.ll.PushFront(entry)
+	c.size += entry.size()
+
+	for c.ll.Len() > c.maxEntries || c.size > c.maxSize {
+		c.removeElement(c.ll.Back())
+	}
+
+	c.job.Gauge("entries", float64(c.ll.Len()))
+}
+
+func (c *responseCacheL1) removeElement(el *list.Element) {
+	entry := c.ll.Remove(el).(*l1CacheEntry)
+	delete(c.items, entry.key)
+	c.size -= entry.size()
+}
+
+// invalidate drops the entries matching an invalidation and returns how many
+// were dropped.
+func (c *responseCacheL1) invalidate(inv *cacheInvalidation) int {
+	if c == nil {
+		return 0
+	}
+
+	var re *regexp.Regexp
+	if inv.PathRegex != "" {
+		re, _ = regexp.Compile(inv.PathRegex)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if entry := el.Value.(*l1CacheEntry); entry.apiID == inv.APIID && entry.matches(inv, re) {
+			c.removeElement(el)
+			removed++
+		}
+		el = next
+	}
+
+	return removed
+}
+
+func (e *l1CacheEntry) matches(inv *cacheInvalidation, re *regexp.Regexp) bool {
+	switch {
+	case inv.All:
+		return true
+	case inv.Path != "" && e.path == inv.Path:
+		return true
+	case re != nil && re.MatchString(e.path):
+		return true
+	case inv.Key != "" && e.component == inv.Key:
+		return true
+	case inv.IP != "" && e.component == inv.IP:
+		return true
+	}
+
+	for _, tag := range e.tags {
+		if contains(inv.SurrogateKeys, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stats returns the number of hits and misses since the cache was created.
+func (c *responseCacheL1) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func testL1Entry(key, path string, ttl int64) *l1CacheEntry {
+	return &l1CacheEntry{
+		key:     key,
+		apiID:   "test",
+		path:    path,
+		data:    "0123456789",
+		expires: strconv.FormatInt(time.Now().Unix()+ttl, 10),
+	}
+}
+
+func TestResponseCacheL1(t *testing.T) {
+	t.Run("Evicts by count", func(t *testing.T) {
+		c := newResponseCacheL1(config.ResponseCacheL1Conf{MaxEntries: 2})
+		c.set(testL1Entry("a", "/a", 60))
+		c.set(testL1Entry("b", "/b", 60))
+		c.get("a")
+		c.set(testL1Entry("c", "/c", 60))
+
+		if _, ok := c.get("b"); ok {
+			t.Error("Least recently used entry should have been evicted")
+		}
+		if _, ok := c.get("a"); !ok {
+			t.Error("Recently used entry should be kept")
+		}
+	})
+
+	t.Run("Evicts by size", func(t *testing.T) {
+		// each entry is 11 bytes
+		c := newResponseCacheL1(config.ResponseCacheL1Conf{MaxSize: 25})
+		c.set(testL1Entry("a", "/a", 60))
+		c.set(testL1Entry("b", "/b", 60))
+		c.set(testL1Entry("c", "/c", 60))
+
+		if len(c.items) != 2 || c.size != 22 {
+			t.Errorf("Expected 2 entries of 22 bytes, got %d of %d bytes", len(c.items), c.size)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		c := newResponseCacheL1(config.ResponseCacheL1Conf{TTL: 10})
+
+		c.set(testL1Entry("expired", "/", -1))
+		if _, ok := c.get("expired"); ok {
+			t.Error("Expired entries should not be cached")
+		}
+
+		entry := testL1Entry("capped", "/", 3600)
+		c.set(entry)
+		if entry.until.After(time.Now().Add(10 * time.Second)) {
+			t.Error("Entry TTL should be capped to the configured TTL")
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		c := newResponseCacheL1(config.ResponseCacheL1Conf{})
+		tagged := testL1Entry("a", "/users/1", 60)
+		tagged.tags = []string{"users"}
+		c.set(tagged)
+		c.set(testL1Entry("b", "/items/1", 60))
+		c.set(testL1Entry("c", "/items/2", 60))
+
+		if n := c.invalidate(&cacheInvalidation{APIID: "other", All: true}); n != 0 {
+			t.Error("Entries of other APIs should not be invalidated, got:", n)
+		}
+		if n := c.invalidate(&cacheInvalidation{APIID: "test", SurrogateKeys: []string{"users"}}); n != 1 {
+			t.Error("Expected 1 entry invalidated by surrogate key, got:", n)
+		}
+		if n := c.invalidate(&cacheInvalidation{APIID: "test", PathRegex: "^/items/"}); n != 2 {
+			t.Error("Expected 2 entries invalidated by path regex, got:", n)
+		}
+	})
+
+	t.Run("Nil cache", func(t *testing.T) {
+		var c *responseCacheL1
+		c.set(testL1Entry("a", "/", 60))
+		if _, ok := c.get("a"); ok {
+			t.Error("Disabled cache should never hit")
+		}
+	})
+}
+
+func TestRedisCacheMiddleware_L1(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.ResponseCacheL1.Enabled = true
+	config.SetGlobal(globalConf)
+	responseL1 = nil
+	defer func() {
+		globalConf.ResponseCacheL1.Enabled = false
+		config.SetGlobal(globalConf)
+		responseL1 = nil
+	}()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.CacheOptions.EnableCache = true
+		spec.CacheOptions.CacheAllSafeRequests = true
+		spec.CacheOptions.CacheTimeout = 60
+	})
+
+	// wait for the entry to be stored in Redis, the next hit populates L1
+	for i := 0; i < 50; i++ {
+		resp, _ := ts.Run(t, test.TestCase{Path: "/l1", Code: http.StatusOK})
+		if resp.Header.Get(headers.XTykCacheStatus) == cacheStatusHit {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// bypass the gateway so only the Redis tier is emptied
+	store := cacheStoreForAPI("test")
+	store.DeleteScanMatch(store.GetKeyPrefix() + "*")
+
+	hits, _ := responseL1.Stats()
+	ts.Run(t, test.TestCase{Path: "/l1", HeadersMatch: map[string]string{headers.XTykCacheStatus: cacheStatusHit}})
+	if after, _ := responseL1.Stats(); after != hits+1 {
+		t.Error("Expected the response to be served from L1")
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodDelete, Path: "/tyk/cache/test", AdminAuth: true, Code: http.StatusOK},
+		{Path: "/l1", HeadersMatch: map[string]string{headers.XTykCacheStatus: cacheStatusMiss}},
+	}...)
+}
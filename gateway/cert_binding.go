@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	ErrAuthCertificateMismatch = "auth.certificate_mismatch"
+
+	// cnfThumbprintClaim is the confirmation method member carrying the
+	// certificate thumbprint inside the "cnf" claim of a JWT.
+	cnfThumbprintClaim = "x5t#S256"
+)
+
+func init() {
+	TykErrors[ErrAuthCertificateMismatch] = config.TykError{
+		Message: "Client certificate does not match the certificate the token is bound to",
+		Code:    http.StatusUnauthorized,
+	}
+}
+
+// requestCertThumbprint returns the x5t#S256 thumbprint of the client
+// certificate presented on the request, or an empty string.
+func requestCertThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return certs.X5tS256(r.TLS.PeerCertificates[0].Raw)
+}
+
+func thumbprintMatches(r *http.Request, bound string) bool {
+	presented := requestCertThumbprint(r)
+	if presented == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(bound)) == 1
+}
+
+// sessionCertificateBindingValid checks a session created for a
+// certificate-bound token against the client certificate of the request.
+// Sessions that are not bound are always valid.
+func sessionCertificateBindingValid(r *http.Request, session *user.SessionState) bool {
+	if session.CertificateBinding == "" {
+		return true
+	}
+	return thumbprintMatches(r, session.CertificateBinding)
+}
+
+// jwtCertificateBindingValid checks the "cnf" claim of a JWT against the
+// client certificate of the request. Tokens without a thumbprint confirmation
+// are always valid.
+func jwtCertificateBindingValid(r *http.Request, claims jwt.MapClaims) bool {
+	cnf, ok := claims["cnf"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	bound, ok := cnf[cnfThumbprintClaim].(string)
+	if !ok || bound == "" {
+		return true
+	}
+
+	return thumbprintMatches(r, bound)
+}
+
+var (
+	errNoClientCertificate = errors.New("no client certificate presented")
+	errBoundTokenNotFound  = errors.New("token session not found")
+)
+
+// bindTokenToCertificate stores the thumbprint of the client certificate used
+// to request a token in the token's session, so that the token can only be
+// used together with the same certificate.
+func bindTokenToCertificate(r *http.Request, orgID, token string, lifetime int64) error {
+	thumbprint := requestCertThumbprint(r)
+	if thumbprint == "" {
+		return errNoClientCertificate
+	}
+
+	session, found := GlobalSessionManager.SessionDetail(orgID, token, false)
+	if !found {
+		return errBoundTokenNotFound
+	}
+
+	session.CertificateBinding = thumbprint
+	return GlobalSessionManager.UpdateSession(token, &session, lifetime, false)
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// certExpiryNotifyInterval is how often the same expiring certificate is
+// reported.
+const certExpiryNotifyInterval = 24 * time.Hour
+
+var (
+	certExpiryNotified   = map[string]time.Time{}
+	certExpiryNotifiedMu sync.Mutex
+)
+
+// usedCertificateIDs returns the IDs of the certificates the gateway and the
+// given APIs are configured with.
+func usedCertificateIDs(specs []*APISpec) []string {
+	globalConf := config.Global()
+
+	ids := append([]string{}, globalConf.HttpServerOptions.SSLCertificates...)
+	ids = append(ids, globalConf.Security.Certificates.API...)
+	ids = append(ids, globalConf.Security.Certificates.ControlAPI...)
+	for _, id := range globalConf.Security.Certificates.Upstream {
+		ids = append(ids, id)
+	}
+
+	for _, spec := range specs {
+		ids = append(ids, spec.Certificates...)
+		ids = append(ids, spec.ClientCertificates...)
+		for _, id := range spec.UpstreamCertificates {
+			ids = append(ids, id)
+		}
+		if spec.RequestSigning.CertificateId != "" {
+			ids = append(ids, spec.RequestSigning.CertificateId)
+		}
+	}
+
+	seen := map[string]bool{}
+	unique := ids[:0]
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// checkCertificateExpiry fires CertificateExpiringSoon for the certificates in
+// use that expire within security.certificate_expiry_warning_days. Each
+// certificate is reported at most once a day.
+func checkCertificateExpiry(specs []*APISpec) {
+	days := config.Global().Security.CertificateExpiryWarningDays
+	if days <= 0 || CertificateManager == nil {
+		return
+	}
+
+	ids := usedCertificateIDs(specs)
+	now := time.Now()
+	threshold := now.AddDate(0, 0, days)
+
+	certExpiryNotifiedMu.Lock()
+	defer certExpiryNotifiedMu.Unlock()
+
+	for _, id := range ids {
+		// public keys have no expiry
+		listed := CertificateManager.List([]string{id}, certs.CertificateAny)
+		if len(listed) == 0 || listed[0] == nil || listed[0].Leaf == nil || listed[0].Leaf.NotAfter.IsZero() {
+			continue
+		}
+		cert := listed[0]
+
+		notAfter := cert.Leaf.NotAfter
+		if notAfter.After(threshold) {
+			continue
+		}
+
+		if last, ok := certExpiryNotified[id]; ok && now.Sub(last) < certExpiryNotifyInterval {
+			continue
+		}
+		certExpiryNotified[id] = now
+
+		daysLeft := int(notAfter.Sub(now).Hours() / 24)
+		FireSystemEvent(EventCertificateExpiringSoon, EventCertificateExpiryMeta{
+			EventMetaDefault: EventMetaDefault{
+				Message: fmt.Sprintf("Certificate %s expires in %d days", cert.Leaf.Subject.CommonName, daysLeft),
+			},
+			CertID:     id,
+			CommonName: cert.Leaf.Subject.CommonName,
+			NotAfter:   notAfter,
+			DaysLeft:   daysLeft,
+		})
+	}
+}
+
+// certificateExpiryLoop checks the certificates in use every hour, reloads
+// check them too.
+func certificateExpiryLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			apisMu.RLock()
+			specs := make([]*APISpec, 0, len(apisByID))
+			for _, spec := range apisByID {
+				specs = append(specs, spec)
+			}
+			apisMu.RUnlock()
+
+			checkCertificateExpiry(specs)
+		}
+	}
+}
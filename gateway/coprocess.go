@@ -282,6 +282,7 @@ func (m *CoProcessMiddleware) EnabledForSpec() bool {
 		log.WithFields(logrus.Fields{
 			"prefix": "coprocess",
 		}).Errorf("Driver '%s' isn't loaded", m.Spec.CustomMiddleware.Driver)
+		firePluginLoadFailure(m.Spec, fmt.Errorf("driver '%s' isn't loaded", m.Spec.CustomMiddleware.Driver))
 		return false
 	}
 
@@ -402,7 +403,7 @@ func (m *CoProcessMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 		AuthFailed(m, r, token)
 
 		// Report in health check
-		reportHealthValue(m.Spec, KeyFailure, "1")
+		reportKeyFailure(r, m.Spec, "1")
 
 		errorMsg := "Key not authorised"
 		if returnObject.Request.ReturnOverrides.ResponseBody != "" {
@@ -21,7 +21,7 @@ func TykStoreData(CKey, CValue *C.char, CTTL C.int) {
 	value := C.GoString(CValue)
 	ttl := int64(CTTL)
 
-	store := storage.RedisCluster{KeyPrefix: CoProcessDefaultKeyPrefix}
+	store := storage.New(CoProcessDefaultKeyPrefix, false, false)
 	store.SetKey(key, value, ttl)
 }
 
@@ -30,7 +30,7 @@ func TykStoreData(CKey, CValue *C.char, CTTL C.int) {
 func TykGetData(CKey *C.char) *C.char {
 	key := C.GoString(CKey)
 
-	store := storage.RedisCluster{KeyPrefix: CoProcessDefaultKeyPrefix}
+	store := storage.New(CoProcessDefaultKeyPrefix, false, false)
 	// TODO: return error
 	val, _ := store.GetKey(key)
 	return C.CString(val)
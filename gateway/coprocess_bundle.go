@@ -407,6 +407,17 @@ func loadBundle(spec *APISpec) error {
 	return nil
 }
 
+// firePluginLoadFailure lets event handlers know that the plugins of an API
+// could not be loaded.
+func firePluginLoadFailure(spec *APISpec, err error) {
+	FireSystemEvent(EventPluginLoadFailure, EventPluginLoadFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: err.Error()},
+		APIID:            spec.APIID,
+		Driver:           spec.CustomMiddleware.Driver,
+		Bundle:           spec.CustomMiddlewareBundle,
+	})
+}
+
 // bundleError is a log helper.
 func bundleError(spec *APISpec, err error, message string) error {
 	if err != nil {
@@ -0,0 +1,354 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// Message queue event handlers publish event messages to a broker.
+const (
+	EH_KafkaHandler apidef.TykEventHandlerName = "eh_kafka_handler"
+	EH_NATSHandler  apidef.TykEventHandlerName = "eh_nats_handler"
+	EH_AMQPHandler  apidef.TykEventHandlerName = "eh_amqp_handler"
+
+	defaultQueueEventTopic         = "tyk.events.{{.Type}}"
+	defaultQueueEventBatchInterval = time.Second
+	defaultQueueEventTimeout       = 5 * time.Second
+)
+
+var (
+	eventPublishers   = map[string]eventPublisher{}
+	eventPublishersMu sync.Mutex
+
+	// newEventPublisher connects to a broker, it is replaced in tests.
+	newEventPublisher = dialEventPublisher
+)
+
+// QueueEventHandlerConf configures a message queue event handler.
+type QueueEventHandlerConf struct {
+	// Addresses are the Kafka brokers, or the NATS or AMQP server URLs.
+	Addresses []string `json:"addresses"`
+	// Topic is the Kafka topic, NATS subject or AMQP routing key. It is a
+	// template executed with the event message, e.g. "tyk.{{.Type}}".
+	Topic string `json:"topic"`
+	// Exchange is the AMQP exchange messages are published to.
+	Exchange string `json:"exchange"`
+	// Messages are published once BatchSize of them are pending for a topic,
+	// or BatchInterval milliseconds after the first one was queued.
+	BatchSize     int   `json:"batch_size"`
+	BatchInterval int64 `json:"batch_interval"`
+	// Timeout in milliseconds for connecting and publishing.
+	Timeout int64 `json:"timeout"`
+}
+
+// queueEventMessage is the JSON payload of a published event.
+type queueEventMessage struct {
+	Event     apidef.TykEvent `json:"event"`
+	Timestamp string          `json:"timestamp"`
+	NodeID    string          `json:"node_id"`
+	Meta      interface{}     `json:"meta"`
+}
+
+// eventPublisher sends messages to a broker.
+type eventPublisher interface {
+	Publish(topic string, messages [][]byte) error
+	Close() error
+}
+
+// QueueEventHandler publishes event messages to Kafka, NATS or AMQP.
+type QueueEventHandler struct {
+	driver apidef.TykEventHandlerName
+	conf   QueueEventHandlerConf
+	topic  *template.Template
+
+	mu      sync.Mutex
+	pending map[string][][]byte
+	timer   *time.Timer
+}
+
+func (h *QueueEventHandler) Init(handlerConf interface{}) error {
+	asJSON, _ := json.Marshal(handlerConf)
+	if err := json.Unmarshal(asJSON, &h.conf); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "events",
+		}).Error("Format of message queue handler configuration is incorrect: ", err)
+		return err
+	}
+
+	if len(h.conf.Addresses) == 0 {
+		return errors.New("no broker addresses given")
+	}
+
+	if h.conf.Topic == "" {
+		h.conf.Topic = defaultQueueEventTopic
+	}
+
+	var err error
+	if h.topic, err = template.New("topic").Parse(h.conf.Topic); err != nil {
+		return err
+	}
+
+	h.pending = map[string][][]byte{}
+	return nil
+}
+
+// HandleEvent queues the event message for its topic and publishes the batch
+// once it is full.
+func (h *QueueEventHandler) HandleEvent(em config.EventMessage) {
+	var topic bytes.Buffer
+	if err := h.topic.Execute(&topic, em); err != nil {
+		h.logger().Error("Failed to render topic: ", err)
+		return
+	}
+
+	msg, err := json.Marshal(queueEventMessage{
+		Event:     em.Type,
+		Timestamp: em.TimeStamp,
+		NodeID:    GetNodeID(),
+		Meta:      em.Meta,
+	})
+	if err != nil {
+		h.logger().Error("Failed to encode event: ", err)
+		return
+	}
+
+	h.mu.Lock()
+	h.pending[topic.String()] = append(h.pending[topic.String()], msg)
+	batch := h.pending[topic.String()]
+	if len(batch) < h.conf.BatchSize {
+		if h.timer == nil {
+			h.timer = time.AfterFunc(h.batchInterval(), h.flush)
+		}
+		h.mu.Unlock()
+		return
+	}
+	delete(h.pending, topic.String())
+	h.mu.Unlock()
+
+	h.publish(topic.String(), batch)
+}
+
+// flush publishes every pending batch.
+func (h *QueueEventHandler) flush() {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = map[string][][]byte{}
+	h.timer = nil
+	h.mu.Unlock()
+
+	for topic, batch := range pending {
+		h.publish(topic, batch)
+	}
+}
+
+func (h *QueueEventHandler) publish(topic string, batch [][]byte) {
+	publisher, err := h.publisher()
+	if err != nil {
+		h.logger().Error("Failed to connect to broker: ", err)
+		return
+	}
+
+	if err := publisher.Publish(topic, batch); err != nil {
+		h.logger().WithField("topic", topic).Error("Failed to publish events: ", err)
+		// reconnect on the next batch
+		h.closePublisher(publisher)
+		return
+	}
+
+	h.logger().WithField("topic", topic).Debugf("Published %d events", len(batch))
+}
+
+func (h *QueueEventHandler) batchInterval() time.Duration {
+	if h.conf.BatchInterval > 0 {
+		return time.Duration(h.conf.BatchInterval) * time.Millisecond
+	}
+	return defaultQueueEventBatchInterval
+}
+
+func (h *QueueEventHandler) timeout() time.Duration {
+	if h.conf.Timeout > 0 {
+		return time.Duration(h.conf.Timeout) * time.Millisecond
+	}
+	return defaultQueueEventTimeout
+}
+
+func (h *QueueEventHandler) logger() *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"prefix": "events",
+		"driver": h.driver,
+	})
+}
+
+// publisherKey identifies a broker connection, handlers of reloaded APIs
+// share the connections of the previous ones.
+func (h *QueueEventHandler) publisherKey() string {
+	return string(h.driver) + "|" + strings.Join(h.conf.Addresses, ",") + "|" + h.conf.Exchange
+}
+
+func (h *QueueEventHandler) publisher() (eventPublisher, error) {
+	eventPublishersMu.Lock()
+	defer eventPublishersMu.Unlock()
+
+	key := h.publisherKey()
+	if publisher, ok := eventPublishers[key]; ok {
+		return publisher, nil
+	}
+
+	publisher, err := newEventPublisher(h.driver, h.conf, h.timeout())
+	if err != nil {
+		return nil, err
+	}
+
+	eventPublishers[key] = publisher
+	return publisher, nil
+}
+
+func (h *QueueEventHandler) closePublisher(publisher eventPublisher) {
+	eventPublishersMu.Lock()
+	defer eventPublishersMu.Unlock()
+
+	key := h.publisherKey()
+	if eventPublishers[key] == publisher {
+		delete(eventPublishers, key)
+		publisher.Close()
+	}
+}
+
+func dialEventPublisher(driver apidef.TykEventHandlerName, conf QueueEventHandlerConf, timeout time.Duration) (eventPublisher, error) {
+	switch driver {
+	case EH_KafkaHandler:
+		return &kafkaEventPublisher{
+			brokers: conf.Addresses,
+			timeout: timeout,
+			writers: map[string]*kafka.Writer{},
+		}, nil
+	case EH_NATSHandler:
+		conn, err := nats.Connect(strings.Join(conf.Addresses, ","), nats.Timeout(timeout))
+		if err != nil {
+			return nil, err
+		}
+		return &natsEventPublisher{conn: conn, timeout: timeout}, nil
+	case EH_AMQPHandler:
+		conn, err := amqp.DialConfig(conf.Addresses[0], amqp.Config{Dial: amqp.DefaultDial(timeout)})
+		if err != nil {
+			return nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &amqpEventPublisher{conn: conn, ch: ch, exchange: conf.Exchange}, nil
+	}
+
+	return nil, errors.New("unknown message queue driver")
+}
+
+type kafkaEventPublisher struct {
+	brokers []string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	writers map[string]*kafka.Writer
+}
+
+func (p *kafkaEventPublisher) Publish(topic string, messages [][]byte) error {
+	p.mu.Lock()
+	writer, ok := p.writers[topic]
+	if !ok {
+		// events are batched by the handler already
+		writer = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      p.brokers,
+			Topic:        topic,
+			BatchTimeout: 10 * time.Millisecond,
+			WriteTimeout: p.timeout,
+		})
+		p.writers[topic] = writer
+	}
+	p.mu.Unlock()
+
+	msgs := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		msgs[i] = kafka.Message{Value: msg}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	return writer.WriteMessages(ctx, msgs...)
+}
+
+func (p *kafkaEventPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, writer := range p.writers {
+		writer.Close()
+		delete(p.writers, topic)
+	}
+	return nil
+}
+
+type natsEventPublisher struct {
+	conn    *nats.Conn
+	timeout time.Duration
+}
+
+func (p *natsEventPublisher) Publish(subject string, messages [][]byte) error {
+	for _, msg := range messages {
+		if err := p.conn.Publish(subject, msg); err != nil {
+			return err
+		}
+	}
+	return p.conn.FlushTimeout(p.timeout)
+}
+
+func (p *natsEventPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
+
+type amqpEventPublisher struct {
+	conn     *amqp.Connection
+	exchange string
+
+	// channels are not safe for concurrent publishing
+	mu sync.Mutex
+	ch *amqp.Channel
+}
+
+func (p *amqpEventPublisher) Publish(routingKey string, messages [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, msg := range messages {
+		err := p.ch.Publish(p.exchange, routingKey, false, false, amqp.Publishing{
+			ContentType: headers.ApplicationJSON,
+			Timestamp:   time.Now(),
+			Body:        msg,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *amqpEventPublisher) Close() error {
+	return p.conn.Close()
+}
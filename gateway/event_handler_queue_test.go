@@ -0,0 +1,239 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// testEventPublisher is a broker stand-in recording published batches.
+type testEventPublisher struct {
+	mu      sync.Mutex
+	batches map[string][][][]byte
+	fail    bool
+	closed  bool
+}
+
+func (p *testEventPublisher) Publish(topic string, messages [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	p.batches[topic] = append(p.batches[topic], messages)
+	return nil
+}
+
+func (p *testEventPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *testEventPublisher) published(topic string) [][][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batches[topic]
+}
+
+// useTestEventPublishers replaces the brokers with stand-ins, the returned
+// function lists the publishers created so far.
+func useTestEventPublishers(t *testing.T) func() []*testEventPublisher {
+	var mu sync.Mutex
+	var publishers []*testEventPublisher
+	newEventPublisher = func(apidef.TykEventHandlerName, QueueEventHandlerConf, time.Duration) (eventPublisher, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		p := &testEventPublisher{batches: map[string][][][]byte{}}
+		publishers = append(publishers, p)
+		return p, nil
+	}
+
+	eventPublishersMu.Lock()
+	eventPublishers = map[string]eventPublisher{}
+	eventPublishersMu.Unlock()
+
+	t.Cleanup(func() {
+		newEventPublisher = dialEventPublisher
+	})
+	return func() []*testEventPublisher {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*testEventPublisher(nil), publishers...)
+	}
+}
+
+func newTestQueueHandler(t *testing.T, driver apidef.TykEventHandlerName, conf map[string]interface{}) config.TykEventHandler {
+	h, err := EventHandlerByName(apidef.EventHandlerTriggerConfig{Handler: driver, HandlerMeta: conf}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestQueueEventHandler(t *testing.T) {
+	t.Run("Invalid configuration", func(t *testing.T) {
+		h := &QueueEventHandler{driver: EH_KafkaHandler}
+		if err := h.Init(map[string]interface{}{}); err == nil {
+			t.Error("Expected an error without broker addresses")
+		}
+		if err := h.Init(map[string]interface{}{"addresses": []string{"localhost:9092"}, "topic": "{{"}); err == nil {
+			t.Error("Expected an error for an invalid topic template")
+		}
+	})
+
+	t.Run("Topic template and batching", func(t *testing.T) {
+		publishers := useTestEventPublishers(t)
+		h := newTestQueueHandler(t, EH_KafkaHandler, map[string]interface{}{
+			"addresses":  []string{"localhost:9092"},
+			"topic":      "gateway.{{.Type}}",
+			"batch_size": 2,
+		})
+
+		h.HandleEvent(config.EventMessage{Type: EventAuthFailure, Meta: EventKeyFailureMeta{Key: "1"}})
+		if len(publishers()) != 0 {
+			t.Fatal("Nothing should be published before the batch is full")
+		}
+
+		h.HandleEvent(config.EventMessage{Type: EventAuthFailure, Meta: EventKeyFailureMeta{Key: "2"}})
+		batches := publishers()[0].published("gateway.AuthFailure")
+		if len(batches) != 1 || len(batches[0]) != 2 {
+			t.Fatalf("Expected one batch of 2 messages, got %d", len(batches))
+		}
+
+		var msg queueEventMessage
+		if err := json.Unmarshal(batches[0][1], &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Event != EventAuthFailure || msg.Meta.(map[string]interface{})["Key"] != "2" {
+			t.Errorf("Unexpected message: %+v", msg)
+		}
+	})
+
+	t.Run("Batch interval", func(t *testing.T) {
+		publishers := useTestEventPublishers(t)
+		h := newTestQueueHandler(t, EH_AMQPHandler, map[string]interface{}{
+			"addresses":      []string{"amqp://localhost"},
+			"batch_size":     10,
+			"batch_interval": 10,
+		})
+
+		h.HandleEvent(config.EventMessage{Type: EventHOSTDOWN})
+		h.HandleEvent(config.EventMessage{Type: EventQuotaExceeded})
+
+		for i := 0; i < 50 && len(publishers()) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(publishers()) == 0 {
+			t.Fatal("Pending events should have been flushed")
+		}
+		p := publishers()[0]
+		if len(p.published("tyk.events.HostDown")) != 1 || len(p.published("tyk.events.QuotaExceeded")) != 1 {
+			t.Error("Expected a batch per topic")
+		}
+	})
+
+	t.Run("Reconnect after failure", func(t *testing.T) {
+		publishers := useTestEventPublishers(t)
+		h := newTestQueueHandler(t, EH_KafkaHandler, map[string]interface{}{
+			"addresses": []string{"localhost:9092"},
+		})
+
+		h.HandleEvent(config.EventMessage{Type: EventBreakerTriggered})
+		failing := publishers()[0]
+		failing.mu.Lock()
+		failing.fail = true
+		failing.mu.Unlock()
+		h.HandleEvent(config.EventMessage{Type: EventBreakerTriggered})
+		h.HandleEvent(config.EventMessage{Type: EventBreakerTriggered})
+
+		if len(publishers()) != 2 || !failing.closed {
+			t.Fatal("Expected the failed publisher to be replaced")
+		}
+		if n := len(publishers()[1].published("tyk.events.BreakerTriggered")); n != 1 {
+			t.Error("Expected the new publisher to be used, got batches:", n)
+		}
+	})
+}
+
+// natsStandIn is a minimal NATS server accepting publications.
+func natsStandIn(t *testing.T) (string, <-chan string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, `INFO {"server_id":"test","version":"2.1.2","max_payload":1048576}`+"\r\n")
+
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					if len(fields) == 0 {
+						continue
+					}
+					switch fields[0] {
+					case "PING":
+						io.WriteString(conn, "PONG\r\n")
+					case "PUB":
+						size, _ := strconv.Atoi(fields[len(fields)-1])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(r, payload); err != nil {
+							return
+						}
+						published <- fields[1] + " " + string(payload[:size])
+					}
+				}
+			}()
+		}
+	}()
+
+	return "nats://" + lis.Addr().String(), published
+}
+
+func TestQueueEventHandler_NATS(t *testing.T) {
+	addr, published := natsStandIn(t)
+
+	eventPublishersMu.Lock()
+	eventPublishers = map[string]eventPublisher{}
+	eventPublishersMu.Unlock()
+
+	h := newTestQueueHandler(t, EH_NATSHandler, map[string]interface{}{
+		"addresses": []string{addr},
+		"topic":     "tyk.{{.Type}}",
+	})
+	h.HandleEvent(config.EventMessage{Type: EventHOSTDOWN, TimeStamp: "now"})
+
+	select {
+	case msg := <-published:
+		if !strings.HasPrefix(msg, `tyk.HostDown {"event":"HostDown","timestamp":"now"`) {
+			t.Error("Unexpected message:", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message was published")
+	}
+}
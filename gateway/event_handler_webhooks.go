@@ -2,9 +2,12 @@ package gateway
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io/ioutil"
 	"net/http"
@@ -32,11 +35,16 @@ const (
 
 	// Define the Event Handler name so we can register it
 	EH_WebHook apidef.TykEventHandlerName = "eh_web_hook_handler"
+
+	defaultWebhookSignatureHeader = "X-Tyk-Signature"
+	defaultWebhookRetryInterval   = 500 * time.Millisecond
+	maxWebhookRetryInterval       = time.Minute
 )
 
 // WebHookHandler is an event handler that triggers web hooks
 type WebHookHandler struct {
 	conf     config.WebHookHandlerConf
+	id       string
 	template *template.Template // non-nil if Init is run without error
 	store    storage.Handler
 
@@ -71,7 +79,7 @@ func (w *WebHookHandler) Init(handlerConf interface{}) error {
 		return err
 	}
 
-	w.store = &storage.RedisCluster{KeyPrefix: "webhook.cache."}
+	w.store = storage.New("webhook.cache.", false, false)
 	w.store.Connect()
 
 	// Pre-load template on init
@@ -122,6 +130,10 @@ func (w *WebHookHandler) Init(handlerConf interface{}) error {
 		w.dashboardService = DashService
 	}
 
+	if w.conf.DeadLetter {
+		w.id = registerWebhookHandler(w)
+	}
+
 	return nil
 }
 
@@ -200,9 +212,25 @@ func (w *WebHookHandler) BuildRequest(reqBody string) (*http.Request, error) {
 		req.Header.Set(headers.ContentType, w.contentType)
 	}
 
+	if w.conf.Secret != "" {
+		signatureHeader := w.conf.SignatureHeader
+		if signatureHeader == "" {
+			signatureHeader = defaultWebhookSignatureHeader
+		}
+		req.Header.Set(signatureHeader, w.Signature(reqBody))
+	}
+
 	return req, nil
 }
 
+// Signature returns the HMAC-SHA256 of a request body using the handler
+// secret, in the "sha256=<hex>" form.
+func (w *WebHookHandler) Signature(reqBody string) string {
+	mac := hmac.New(sha256.New, []byte(w.conf.Secret))
+	mac.Write([]byte(reqBody))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 func (w *WebHookHandler) CreateBody(em config.EventMessage) (string, error) {
 	var reqBody bytes.Buffer
 	w.template.Execute(&reqBody, em)
@@ -230,6 +258,51 @@ func (w *WebHookHandler) HandleEvent(em config.EventMessage) {
 		return
 	}
 
+	// mark the hook as fired before retrying, so that duplicates are not
+	// sent while a delivery is in progress
+	w.setHookFired(reqChecksum)
+
+	interval := defaultWebhookRetryInterval
+	if w.conf.RetryInterval > 0 {
+		interval = time.Duration(w.conf.RetryInterval) * time.Millisecond
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := sendWebhookRequest(req)
+		if err == nil {
+			break
+		}
+
+		if !retry || attempt > w.conf.MaxRetries {
+			if w.conf.DeadLetter {
+				addWebhookDeadLetter(w.id, em.Type, req, reqBody, err, attempt)
+			}
+			break
+		}
+
+		log.WithFields(logrus.Fields{
+			"prefix":  "webhooks",
+			"attempt": attempt,
+		}).Warning("Retrying webhook in ", interval)
+
+		time.Sleep(interval)
+		if interval *= 2; interval > maxWebhookRetryInterval {
+			interval = maxWebhookRetryInterval
+		}
+
+		if req, err = w.BuildRequest(reqBody); err != nil {
+			break
+		}
+	}
+
+	if w.dashboardService != nil && em.Type == EventTriggerExceeded {
+		w.dashboardService.NotifyDashboardOfEvent(em.Meta)
+	}
+}
+
+// sendWebhookRequest fires a webhook request once. It reports whether a failed
+// request is worth retrying: network errors, 429 and 5xx responses are.
+func sendWebhookRequest(req *http.Request) (bool, error) {
 	cli := &http.Client{Timeout: 30 * time.Second}
 
 	resp, err := cli.Do(req)
@@ -237,32 +310,31 @@ func (w *WebHookHandler) HandleEvent(em config.EventMessage) {
 		log.WithFields(logrus.Fields{
 			"prefix": "webhooks",
 		}).Error("Webhook request failed: ", err)
-	} else {
-		defer resp.Body.Close()
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			content, err := ioutil.ReadAll(resp.Body)
-			if err == nil {
-				log.WithFields(logrus.Fields{
-					"prefix":       "webhooks",
-					"responseCode": resp.StatusCode,
-				}).Debug(string(content))
-			} else {
-				log.WithFields(logrus.Fields{
-					"prefix": "webhooks",
-				}).Error(err)
-			}
+		return true, err
+	}
+	defer resp.Body.Close()
 
-		} else {
-			log.WithFields(logrus.Fields{
-				"prefix":       "webhooks",
-				"responseCode": resp.StatusCode,
-			}).Error("Request to webhook failed")
-		}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.WithFields(logrus.Fields{
+			"prefix":       "webhooks",
+			"responseCode": resp.StatusCode,
+		}).Error("Request to webhook failed")
+
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
 	}
 
-	if w.dashboardService != nil && em.Type == EventTriggerExceeded {
-		w.dashboardService.NotifyDashboardOfEvent(em.Meta)
+	content, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		log.WithFields(logrus.Fields{
+			"prefix":       "webhooks",
+			"responseCode": resp.StatusCode,
+		}).Debug(string(content))
+	} else {
+		log.WithFields(logrus.Fields{
+			"prefix": "webhooks",
+		}).Error(err)
 	}
 
-	w.setHookFired(reqChecksum)
+	return false, nil
 }
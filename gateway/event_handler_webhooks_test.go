@@ -1,13 +1,21 @@
 package gateway
 
 import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
 )
 
 func createGetHandler() *WebHookHandler {
@@ -292,3 +300,138 @@ func TestWebhookContentTypeHeader(t *testing.T) {
 	}
 
 }
+
+func TestWebhookRetriesAndSignature(t *testing.T) {
+	var calls int32
+	var signature, body string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		signature = r.Header.Get("X-Tyk-Signature")
+	}))
+	defer target.Close()
+
+	hook := &WebHookHandler{}
+	if err := hook.Init(config.WebHookHandlerConf{
+		Method:        "POST",
+		TargetPath:    target.URL,
+		TemplatePath:  "../templates/default_webhook.json",
+		EventTimeout:  10,
+		MaxRetries:    2,
+		RetryInterval: 1,
+		Secret:        "secret",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	hook.HandleEvent(config.EventMessage{
+		Type: EventKeyExpired,
+		Meta: EventKeyFailureMeta{Key: "retry-and-sign"},
+	})
+
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatal("Expected 3 delivery attempts, got:", n)
+	}
+	if want := hook.Signature(body); signature != want || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Expected signature %q, got %q", want, signature)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	webhookDeadLetterStore().DeleteKey(webhookDeadLetterList)
+
+	var (
+		failing   int32 = 1
+		replayed  http.Header
+		headersMu sync.Mutex
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		headersMu.Lock()
+		replayed = r.Header
+		headersMu.Unlock()
+	}))
+	defer target.Close()
+
+	hook := &WebHookHandler{}
+	if err := hook.Init(config.WebHookHandlerConf{
+		Method:       "POST",
+		TargetPath:   target.URL,
+		TemplatePath: "../templates/default_webhook.json",
+		EventTimeout: 10,
+		MaxRetries:   3,
+		DeadLetter:   true,
+		Secret:       "hook-secret",
+		HeaderList:   map[string]string{"Authorization": "Bearer hook-token"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	hook.HandleEvent(config.EventMessage{
+		Type: EventKeyExpired,
+		Meta: EventKeyFailureMeta{Key: "dead-letter"},
+	})
+
+	// the signature and the auth headers are not stored
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/webhooks/dead-letter", AdminAuth: true, Code: http.StatusOK,
+		BodyNotMatch: `hook-token|sha256=|Authorization`})
+	var entries []webhookDeadLetter
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	// 4xx responses are not retried
+	if len(entries) != 1 || entries[0].Attempts != 1 || entries[0].Event != EventKeyExpired {
+		t.Fatalf("Unexpected dead-letter entries: %+v", entries)
+	}
+
+	replay := "/tyk/webhooks/dead-letter/" + entries[0].ID + "/replay"
+	ts.Run(t, test.TestCase{Method: http.MethodPost, Path: replay, AdminAuth: true, Code: http.StatusBadGateway})
+
+	atomic.StoreInt32(&failing, 0)
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: replay, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPost, Path: replay, AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/webhooks/dead-letter", AdminAuth: true, Code: http.StatusOK, BodyMatch: `^\[\]`},
+	}...)
+
+	headersMu.Lock()
+	defer headersMu.Unlock()
+	if got := replayed.Get("Authorization"); got != "Bearer hook-token" {
+		t.Errorf("Expected the replay to send the auth header, got %q", got)
+	}
+	if got, want := replayed.Get(defaultWebhookSignatureHeader), hook.Signature(entries[0].Body); got != want {
+		t.Errorf("Expected the replay to be signed with %q, got %q", want, got)
+	}
+}
+
+func TestWebhookDeadLetterTrim(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	store := webhookDeadLetterStore()
+	store.DeleteKey(webhookDeadLetterList)
+	defer store.DeleteKey(webhookDeadLetterList)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://hook.example.com", nil)
+	for i := 0; i < maxWebhookDeadLetters+2; i++ {
+		addWebhookDeadLetter("", EventKeyExpired, req, strconv.Itoa(i), errors.New("failed"), 1)
+	}
+
+	entries, _, err := webhookDeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != maxWebhookDeadLetters || entries[0].Body != "2" {
+		t.Fatalf("Expected the %d most recent entries, got %d starting with %q", maxWebhookDeadLetters, len(entries), entries[0].Body)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -34,6 +35,15 @@ const (
 	EventTokenCreated         apidef.TykEvent = "TokenCreated"
 	EventTokenUpdated         apidef.TykEvent = "TokenUpdated"
 	EventTokenDeleted         apidef.TykEvent = "TokenDeleted"
+
+	// System events about the gateway itself
+	EventAPIsReloaded            apidef.TykEvent = "ApisReloaded"
+	EventPoliciesReloaded        apidef.TykEvent = "PoliciesReloaded"
+	EventCertificateExpiringSoon apidef.TykEvent = "CertificateExpiringSoon"
+	EventCacheInvalidated        apidef.TykEvent = "CacheInvalidated"
+	EventRPCConnectionLost       apidef.TykEvent = "RPCConnectionLost"
+	EventRPCConnectionRestored   apidef.TykEvent = "RPCConnectionRestored"
+	EventPluginLoadFailure       apidef.TykEvent = "PluginLoadFailure"
 )
 
 // EventMetaDefault is a standard embedded struct to be used with custom event metadata types, gives an interface for
@@ -57,6 +67,13 @@ type EventKeyFailureMeta struct {
 	Key    string
 }
 
+// EventJWTClaimRuleFailureMeta is the metadata structure for an auth failure
+// caused by a JWT claim rule, Rule holds the name of the failing rule.
+type EventJWTClaimRuleFailureMeta struct {
+	EventKeyFailureMeta
+	Rule string
+}
+
 // EventCurcuitBreakerMeta is the event status for a circuit breaker tripping
 type EventCurcuitBreakerMeta struct {
 	EventMetaDefault
@@ -88,6 +105,84 @@ type EventTokenMeta struct {
 	Key string
 }
 
+// EventReloadMeta is the metadata of API and policy reloads, it lists the IDs
+// that were added, updated or removed by the reload.
+type EventReloadMeta struct {
+	EventMetaDefault
+	Total   int
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// EventCertificateExpiryMeta is the metadata of a certificate about to expire.
+type EventCertificateExpiryMeta struct {
+	EventMetaDefault
+	CertID     string
+	CommonName string
+	NotAfter   time.Time
+	DaysLeft   int
+}
+
+// EventCacheInvalidatedMeta is the metadata of a cache invalidation. Tokens
+// are left out.
+type EventCacheInvalidatedMeta struct {
+	EventMetaDefault
+	APIID         string
+	All           bool
+	Path          string
+	PathRegex     string
+	SurrogateKeys []string
+	IP            string
+	Removed       int
+}
+
+// EventRPCConnectionMeta is the metadata of RPC connection changes.
+type EventRPCConnectionMeta struct {
+	EventMetaDefault
+	ConnectionString string
+}
+
+// EventPluginLoadFailureMeta is the metadata of a plugin bundle or driver
+// that failed to load for an API.
+type EventPluginLoadFailureMeta struct {
+	EventMetaDefault
+	APIID  string
+	Driver apidef.MiddlewareDriver
+	Bundle string
+}
+
+// newReloadMeta compares the IDs loaded before and after a reload.
+func newReloadMeta(oldIDs, newIDs []string, changed func(id string) bool) EventReloadMeta {
+	meta := EventReloadMeta{Total: len(newIDs)}
+
+	old := make(map[string]bool, len(oldIDs))
+	for _, id := range oldIDs {
+		old[id] = true
+	}
+
+	for _, id := range newIDs {
+		switch {
+		case !old[id]:
+			meta.Added = append(meta.Added, id)
+		case changed(id):
+			meta.Updated = append(meta.Updated, id)
+		}
+		delete(old, id)
+	}
+
+	for id := range old {
+		meta.Removed = append(meta.Removed, id)
+	}
+
+	sort.Strings(meta.Added)
+	sort.Strings(meta.Updated)
+	sort.Strings(meta.Removed)
+
+	meta.Message = fmt.Sprintf("%d loaded, %d added, %d updated, %d removed", meta.Total, len(meta.Added), len(meta.Updated), len(meta.Removed))
+	return meta
+}
+
 // EncodeRequestToEvent will write the request out in wire protocol and
 // encode it to base64 and store it in an Event object
 func EncodeRequestToEvent(r *http.Request) string {
@@ -110,6 +205,10 @@ func EventHandlerByName(handlerConf apidef.EventHandlerTriggerConfig, spec *APIS
 		h := &WebHookHandler{}
 		err := h.Init(conf)
 		return h, err
+	case EH_KafkaHandler, EH_NATSHandler, EH_AMQPHandler:
+		h := &QueueEventHandler{driver: handlerConf.Handler}
+		err := h.Init(conf)
+		return h, err
 	case EH_JSVMHandler:
 		// Load the globals and file here
 		if spec != nil {
@@ -2,6 +2,10 @@ package gateway
 
 import (
 	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -10,6 +14,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
 )
 
 var (
@@ -164,3 +169,119 @@ func BenchmarkInitGenericEventHandlers(b *testing.B) {
 		initGenericEventHandlers(conf)
 	}
 }
+
+// testEventCapture collects the system events it handles.
+type testEventCapture struct {
+	events chan config.EventMessage
+}
+
+func (h *testEventCapture) Init(interface{}) error { return nil }
+
+func (h *testEventCapture) HandleEvent(em config.EventMessage) {
+	h.events <- em
+}
+
+func (h *testEventCapture) next(t *testing.T, event apidef.TykEvent) config.EventMessage {
+	t.Helper()
+	for {
+		select {
+		case em := <-h.events:
+			if em.Type == event {
+				return em
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not fired", event)
+		}
+	}
+}
+
+func captureSystemEvents(events ...apidef.TykEvent) *testEventCapture {
+	capture := &testEventCapture{events: make(chan config.EventMessage, 100)}
+	triggers := map[apidef.TykEvent][]config.TykEventHandler{}
+	for _, event := range events {
+		triggers[event] = []config.TykEventHandler{capture}
+	}
+
+	globalConf := config.Global()
+	globalConf.SetEventTriggers(triggers)
+	config.SetGlobal(globalConf)
+	return capture
+}
+
+func Test_newReloadMeta(t *testing.T) {
+	meta := newReloadMeta([]string{"a", "b", "c"}, []string{"d", "c", "b"}, func(id string) bool {
+		return id == "c"
+	})
+
+	if meta.Total != 3 || !reflect.DeepEqual(meta.Added, []string{"d"}) ||
+		!reflect.DeepEqual(meta.Updated, []string{"c"}) || !reflect.DeepEqual(meta.Removed, []string{"a"}) {
+		t.Errorf("Unexpected reload meta: %+v", meta)
+	}
+	if meta.Message != "3 loaded, 1 added, 1 updated, 1 removed" {
+		t.Error("Unexpected message:", meta.Message)
+	}
+}
+
+func TestSystemEvents(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer ResetTestConfig()
+
+	capture := captureSystemEvents(EventAPIsReloaded, EventCacheInvalidated, EventCertificateExpiringSoon)
+
+	t.Run("APIs reloaded", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "reloaded"
+			spec.Proxy.ListenPath = "/"
+		})
+
+		meta := capture.next(t, EventAPIsReloaded).Meta.(EventReloadMeta)
+		if meta.Total != 1 || !reflect.DeepEqual(meta.Added, []string{"reloaded"}) {
+			t.Errorf("Unexpected reload meta: %+v", meta)
+		}
+	})
+
+	t.Run("Cache invalidated", func(t *testing.T) {
+		ts.Run(t, test.TestCase{Method: http.MethodDelete, Path: "/tyk/cache/reloaded", AdminAuth: true, Code: http.StatusOK})
+
+		meta := capture.next(t, EventCacheInvalidated).Meta.(EventCacheInvalidatedMeta)
+		if meta.APIID != "reloaded" || !meta.All {
+			t.Errorf("Unexpected invalidation meta: %+v", meta)
+		}
+	})
+
+	t.Run("Certificate expiring soon", func(t *testing.T) {
+		_, _, combinedPEM, _ := genCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "expiring"}})
+		certID, err := CertificateManager.Add(combinedPEM, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer CertificateManager.Delete(certID, "")
+
+		spec := BuildAPI(func(spec *APISpec) {
+			spec.UpstreamCertificates = map[string]string{"*": certID}
+		})[0]
+
+		// disabled by default
+		checkCertificateExpiry([]*APISpec{spec})
+
+		globalConf := config.Global()
+		globalConf.Security.CertificateExpiryWarningDays = 30
+		config.SetGlobal(globalConf)
+
+		checkCertificateExpiry([]*APISpec{spec})
+		checkCertificateExpiry([]*APISpec{spec})
+
+		em := capture.next(t, EventCertificateExpiringSoon)
+		meta := em.Meta.(EventCertificateExpiryMeta)
+		if meta.CertID != certID || meta.CommonName != "expiring" || meta.DaysLeft != 0 {
+			t.Errorf("Unexpected expiry meta: %+v", meta)
+		}
+
+		select {
+		case em := <-capture.events:
+			t.Error("Expected a single notification, got", em.Type)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
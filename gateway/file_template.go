@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+// fileTemplateRe matches the templates expanded in the API definitions and
+// policies loaded from files: ${env:VAR}, ${kv:consul://key} and the same
+// with a default value, as in ${env:VAR:-default}. $${ escapes a template.
+var fileTemplateRe = regexp.MustCompile(`\$?\$\{(env|kv):([^}]*)\}`)
+
+// hasFileTemplates reports whether data may hold templates.
+func hasFileTemplates(data []byte) bool {
+	return bytes.Contains(data, []byte("${"))
+}
+
+// expandFileTemplates expands the templates in the string values of the JSON
+// document data. It also returns the KV references resolved by the templates
+// with their values, so that they are refreshed like the references of the
+// loaded definitions. Errors name the field holding the faulty template.
+func expandFileTemplates(data []byte) ([]byte, map[string]string, error) {
+	if !hasFileTemplates(data) {
+		return data, nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as they are written, big integers would lose precision
+	// as floats.
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	e := fileTemplateExpander{}
+	doc, err := e.expandIn(doc, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := json.Marshal(doc)
+	return out, e.refs, err
+}
+
+// fileTemplateExpander records the KV references resolved while expanding.
+type fileTemplateExpander struct {
+	refs map[string]string
+}
+
+func (e *fileTemplateExpander) expandIn(v interface{}, field string) (interface{}, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			name := k
+			if field != "" {
+				name = field + "." + k
+			}
+			expanded, err := e.expandIn(val, name)
+			if err != nil {
+				return nil, err
+			}
+			x[k] = expanded
+		}
+	case []interface{}:
+		for i, val := range x {
+			expanded, err := e.expandIn(val, field+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return nil, err
+			}
+			x[i] = expanded
+		}
+	case string:
+		expanded, err := e.expandString(x)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", field, err)
+		}
+		return expanded, nil
+	}
+	return v, nil
+}
+
+func (e *fileTemplateExpander) expandString(s string) (string, error) {
+	var out strings.Builder
+	last := 0
+	for _, m := range fileTemplateRe.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(s[last:m[0]])
+		last = m[1]
+		if strings.HasPrefix(s[m[0]:], "$$") {
+			out.WriteString(s[m[0]+1 : m[1]])
+			continue
+		}
+		value, err := e.resolve(s[m[2]:m[3]], s[m[4]:m[5]])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value)
+	}
+	out.WriteString(s[last:])
+	return out.String(), nil
+}
+
+func (e *fileTemplateExpander) resolve(kind, ref string) (string, error) {
+	ref, def := ref, ""
+	hasDefault := false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		ref, def, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	var (
+		value string
+		found bool
+	)
+	switch kind {
+	case "env":
+		value, found = os.LookupEnv(ref)
+	case "kv":
+		if !isKVRef(ref) {
+			return "", fmt.Errorf("unknown KV reference %q", ref)
+		}
+		v, err := kvStore(ref)
+		if err != nil && !hasDefault {
+			return "", fmt.Errorf("couldn't resolve %q: %v", ref, err)
+		}
+		value, found = v, err == nil && v != ref
+		if found {
+			if e.refs == nil {
+				e.refs = map[string]string{}
+			}
+			e.refs[ref] = value
+		}
+	}
+
+	if !found {
+		if !hasDefault {
+			return "", fmt.Errorf("%s %q is not set", kind, ref)
+		}
+		value = def
+	}
+	return value, nil
+}
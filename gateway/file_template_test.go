@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestExpandFileTemplates(t *testing.T) {
+	os.Setenv("TYK_TEST_UPSTREAM", "http://upstream.stage")
+	defer os.Unsetenv("TYK_TEST_UPSTREAM")
+
+	globalConf := config.Global()
+	globalConf.Secrets = map[string]string{"domain": "stage.example.com"}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	tests := []struct {
+		name, in, out, err string
+	}{
+		{"no templates", `{"a":"$tyk_context.path"}`, `{"a":"$tyk_context.path"}`, ""},
+		{"env", `{"a":"${env:TYK_TEST_UPSTREAM}/api"}`, `{"a":"http://upstream.stage/api"}`, ""},
+		{"default", `{"a":"${env:TYK_TEST_MISSING:-/default}"}`, `{"a":"/default"}`, ""},
+		{"kv", `{"a":["${kv:secrets://domain}"]}`, `{"a":["stage.example.com"]}`, ""},
+		{"kv default", `{"a":"${kv:secrets://missing:-none}"}`, `{"a":"none"}`, ""},
+		{"escaped", `{"a":"$${env:TYK_TEST_UPSTREAM}"}`, `{"a":"${env:TYK_TEST_UPSTREAM}"}`, ""},
+		{"numbers", `{"a":"${env:TYK_TEST_UPSTREAM}","n":9007199254740993}`, `{"a":"http://upstream.stage","n":9007199254740993}`, ""},
+		{"missing env", `{"proxy":{"target_url":"${env:TYK_TEST_MISSING}"}}`, "", `field proxy.target_url: env "TYK_TEST_MISSING" is not set`},
+		{"unknown kv", `{"a":[{"b":"${kv:file://x}"}]}`, "", `field a[0].b: unknown KV reference "file://x"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, _, err := expandFileTemplates([]byte(tc.in))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.out {
+				t.Errorf("expected %s, got %s", tc.out, out)
+			}
+		})
+	}
+
+	_, refs, err := expandFileTemplates([]byte(`{"a":"${kv:secrets://domain}","b":"${kv:secrets://missing:-none}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"secrets://domain": "stage.example.com"}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("expected the resolved references %v, got %v", want, refs)
+	}
+}
+
+func TestFileTemplatesLoading(t *testing.T) {
+	os.Setenv("TYK_TEST_LISTEN_PATH", "/stage/")
+	defer os.Unsetenv("TYK_TEST_LISTEN_PATH")
+
+	globalConf := config.Global()
+	globalConf.Secrets = map[string]string{"upstream": "http://secret.upstream"}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	dir, err := ioutil.TempDir("", "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("api.json", `{"api_id":"templated","proxy":{"listen_path":"${env:TYK_TEST_LISTEN_PATH}","target_url":"${kv:secrets://upstream}"}}`)
+	write("broken.json", `{"api_id":"broken","proxy":{"target_url":"${env:TYK_TEST_MISSING}"}}`)
+
+	specs := APIDefinitionLoader{}.FromDir(dir)
+	if len(specs) != 1 {
+		t.Fatalf("expected only the valid definition to load, got %d", len(specs))
+	}
+	spec := specs[0]
+	if spec.Proxy.ListenPath != "/stage/" || spec.Proxy.TargetURL != "http://secret.upstream" {
+		t.Errorf("unexpected proxy %+v", spec.Proxy)
+	}
+	if raw := spec.definition(); raw.Proxy.ListenPath != "${env:TYK_TEST_LISTEN_PATH}" || raw.Proxy.TargetURL != "${kv:secrets://upstream}" {
+		t.Errorf("expected the definition to be kept as written, got %+v", raw.Proxy)
+	}
+	if err := resolveSpecKVRefs(spec); err != nil {
+		t.Fatal(err)
+	}
+	defer setKVRefs(kvRefOwnerAPI+spec.APIID, nil)
+	if spec.definition().Proxy.TargetURL != "${kv:secrets://upstream}" {
+		t.Error("expected the definition as written to be kept after resolving")
+	}
+	kvRefs.Lock()
+	refs := kvRefs.values[kvRefOwnerAPI+spec.APIID]
+	kvRefs.Unlock()
+	if refs["secrets://upstream"] != "http://secret.upstream" {
+		t.Errorf("expected the template reference to be refreshed, got %v", refs)
+	}
+
+	pols := LoadPoliciesFromFile(write("policies.pol", `{"pol":{"org_id":"${env:TYK_TEST_ORG:-default}"}}`))
+	if pols["pol"].OrgID != "default" {
+		t.Errorf("expected the policy to be templated, got %q", pols["pol"].OrgID)
+	}
+	if pols := LoadPoliciesFromFile(write("broken.pol", `{"pol":{"org_id":"${env:TYK_TEST_MISSING}"}}`)); pols != nil {
+		t.Errorf("expected the broken policies not to load, got %v", pols)
+	}
+}
@@ -0,0 +1,518 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const defaultSyncInterval = 10
+
+const (
+	syncKindAPI         = "api"
+	syncKindPolicy      = "policy"
+	syncKindCertificate = "certificate"
+
+	syncCreate = "create"
+	syncUpdate = "update"
+	syncDelete = "delete"
+)
+
+// syncState is a snapshot of the API definitions, policies and certificates
+// of a sync directory. The directory holds the apis, policies and certs
+// directories, it may be a git checkout.
+type syncState struct {
+	APIs     map[string]*apidef.APIDefinition
+	Policies map[string]user.Policy
+	Certs    map[string][]byte
+
+	// files maps kind/id to the file the object was read from.
+	files map[string]string
+}
+
+func newSyncState() *syncState {
+	return &syncState{
+		APIs:     map[string]*apidef.APIDefinition{},
+		Policies: map[string]user.Policy{},
+		Certs:    map[string][]byte{},
+		files:    map[string]string{},
+	}
+}
+
+type syncChange struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	File   string `json:"file,omitempty"`
+}
+
+// syncPlan lists the changes needed to go from the loaded state to the
+// state of the sync directory.
+type syncPlan struct {
+	Changes []syncChange `json:"changes"`
+}
+
+// syncLoadError holds all the problems found in a sync directory, so they
+// can be fixed at once.
+type syncLoadError []string
+
+func (e syncLoadError) Error() string {
+	return strings.Join(e, "\n")
+}
+
+var (
+	// syncApplied is the last state applied, the APIs and policies are
+	// loaded from it on reload when sync is enabled. Until a sync has been
+	// applied they are loaded from the app path and policy file.
+	syncApplied struct {
+		sync.RWMutex
+		state *syncState
+	}
+	syncRunMu   sync.Mutex
+	lastSyncErr string
+)
+
+// syncFiles returns the files under dir with one of exts, in lexical order.
+func syncFiles(dir string, exts ...string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range exts {
+			if strings.EqualFold(filepath.Ext(path), ext) {
+				paths = append(paths, path)
+				break
+			}
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// readSyncFile returns the data of the file at path as written and with its
+// templates expanded. The state keeps the objects as written, their
+// templates are expanded again when they are loaded.
+func readSyncFile(path string) ([]byte, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	expanded, _, err := expandFileTemplates(data)
+	return data, expanded, err
+}
+
+// loadSyncState reads and validates the sync directory dir. The state is
+// only returned when all of its objects are valid, so it can be applied as
+// a whole.
+func loadSyncState(dir string) (*syncState, error) {
+	state := newSyncState()
+	var errs syncLoadError
+	fail := func(path string, format string, args ...interface{}) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+	// add records the file of an object and reports whether the id is new.
+	add := func(kind, id, path string) bool {
+		key := kind + "/" + id
+		if prev, ok := state.files[key]; ok {
+			fail(path, "%s %q is already defined in %s", kind, id, prev)
+			return false
+		}
+		state.files[key] = path
+		return true
+	}
+
+	paths, err := syncFiles(filepath.Join(dir, "apis"), ".json")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, expanded, err := readSyncFile(path)
+		if err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		def := &apidef.APIDefinition{}
+		if err := json.Unmarshal(expanded, def); err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		if def.APIID == "" {
+			fail(path, "api_id is not set")
+			continue
+		}
+		result := apidef.Validate(def, apidef.DefaultValidationRuleSet)
+		for _, err := range result.Errors {
+			fail(path, "%v", err)
+		}
+		if result.HasErrors() || !add(syncKindAPI, def.APIID, path) {
+			continue
+		}
+		if hasFileTemplates(data) {
+			def = &apidef.APIDefinition{}
+			if err := json.Unmarshal(data, def); err != nil {
+				fail(path, "%v", err)
+				continue
+			}
+		}
+		state.APIs[def.APIID] = def
+	}
+
+	paths, err = syncFiles(filepath.Join(dir, "policies"), ".json")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, _, err := readSyncFile(path)
+		if err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		var pols map[string]user.Policy
+		if err := json.Unmarshal(data, &pols); err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		for id, pol := range pols {
+			if add(syncKindPolicy, id, path) {
+				state.Policies[id] = pol
+			}
+		}
+	}
+
+	paths, err = syncFiles(filepath.Join(dir, "certs"), ".pem", ".crt")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		certID, _, err := certs.GetCertIDAndChainPEM(data, config.Global().Secret)
+		if err != nil {
+			fail(path, "%v", err)
+			continue
+		}
+		if add(syncKindCertificate, certID, path) {
+			state.Certs[certID] = data
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return state, nil
+}
+
+// currentSyncState returns the last applied state, or the loaded APIs and
+// policies when nothing was synced yet. Both the plan and the sync compare
+// against it.
+func currentSyncState() *syncState {
+	syncApplied.RLock()
+	state := syncApplied.state
+	syncApplied.RUnlock()
+	if state != nil {
+		return state
+	}
+
+	state = newSyncState()
+	apisMu.RLock()
+	for id, spec := range apisByID {
+		state.APIs[id] = spec.definition()
+	}
+	apisMu.RUnlock()
+	policiesMu.RLock()
+	for id := range policiesByID {
+		state.Policies[id] = loadedPolicy(policiesByID, policyKVDefs, id)
+	}
+	policiesMu.RUnlock()
+	return state
+}
+
+func syncObjectsEqual(a, b interface{}) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aData, bData)
+}
+
+// planSync compares the objects of current and desired. Certificates are
+// only deleted when they were added by a sync.
+func planSync(current, desired *syncState) syncPlan {
+	var plan syncPlan
+	change := func(kind, id, action string) {
+		plan.Changes = append(plan.Changes, syncChange{
+			Kind:   kind,
+			ID:     id,
+			Action: action,
+			File:   desired.files[kind+"/"+id],
+		})
+	}
+
+	for id, def := range desired.APIs {
+		if cur, ok := current.APIs[id]; !ok {
+			change(syncKindAPI, id, syncCreate)
+		} else if !syncObjectsEqual(cur, def) {
+			change(syncKindAPI, id, syncUpdate)
+		}
+	}
+	for id := range current.APIs {
+		if _, ok := desired.APIs[id]; !ok {
+			change(syncKindAPI, id, syncDelete)
+		}
+	}
+
+	for id, pol := range desired.Policies {
+		if cur, ok := current.Policies[id]; !ok {
+			change(syncKindPolicy, id, syncCreate)
+		} else if !syncObjectsEqual(cur, pol) {
+			change(syncKindPolicy, id, syncUpdate)
+		}
+	}
+	for id := range current.Policies {
+		if _, ok := desired.Policies[id]; !ok {
+			change(syncKindPolicy, id, syncDelete)
+		}
+	}
+
+	for id := range desired.Certs {
+		if _, ok := current.Certs[id]; ok {
+			continue
+		}
+		if _, err := CertificateManager.GetRaw(id); err != nil {
+			change(syncKindCertificate, id, syncCreate)
+		}
+	}
+	for id := range current.Certs {
+		if _, ok := desired.Certs[id]; !ok {
+			change(syncKindCertificate, id, syncDelete)
+		}
+	}
+
+	order := map[string]int{syncKindCertificate: 0, syncKindPolicy: 1, syncKindAPI: 2}
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		a, b := plan.Changes[i], plan.Changes[j]
+		if a.Kind != b.Kind {
+			return order[a.Kind] < order[b.Kind]
+		}
+		return a.ID < b.ID
+	})
+	return plan
+}
+
+// applySyncState makes desired the loaded state. New certificates are added
+// before the reload so the APIs can use them, removed ones are deleted once
+// no API refers to them anymore.
+func applySyncState(desired *syncState, reload bool) {
+	syncApplied.Lock()
+	current := syncApplied.state
+	syncApplied.state = desired
+	syncApplied.Unlock()
+
+	var removed []string
+	if current != nil {
+		for id := range current.Certs {
+			if _, ok := desired.Certs[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+	}
+	for id, data := range desired.Certs {
+		if current != nil && current.Certs[id] != nil {
+			continue
+		}
+		if _, err := CertificateManager.Add(data, ""); err != nil && !strings.Contains(err.Error(), "already exists") {
+			mainLog.WithError(err).Error("Couldn't add synced certificate: ", desired.files[syncKindCertificate+"/"+id])
+		}
+	}
+
+	deleteRemoved := func() {
+		for _, id := range removed {
+			CertificateManager.Delete(id, "")
+		}
+	}
+	if reload {
+		reloadURLStructure(deleteRemoved)
+	} else {
+		deleteRemoved()
+	}
+}
+
+func gitPull(dir string) {
+	out, err := exec.Command("git", "-C", dir, "pull", "--ff-only").CombinedOutput()
+	if err != nil {
+		mainLog.WithError(err).Error("Couldn't pull the sync git checkout: ", strings.TrimSpace(string(out)))
+	}
+}
+
+// runSync loads the sync directory and applies its state when it differs
+// from the applied one. It returns the applied changes.
+func runSync(reload bool) (syncPlan, error) {
+	syncRunMu.Lock()
+	defer syncRunMu.Unlock()
+
+	conf := config.Global().Sync
+	if conf.GitPull {
+		gitPull(conf.Path)
+	}
+	desired, err := loadSyncState(conf.Path)
+	if err != nil {
+		if err.Error() != lastSyncErr {
+			mainLog.Error("Couldn't load the sync directory, keeping the loaded state:\n", err)
+			lastSyncErr = err.Error()
+		}
+		return syncPlan{}, err
+	}
+	lastSyncErr = ""
+
+	plan := planSync(currentSyncState(), desired)
+	// the first sync is applied even without changes, so that reloads
+	// load from the sync directory instead of the app path
+	if len(plan.Changes) == 0 && syncStateApplied() {
+		return plan, nil
+	}
+	for _, c := range plan.Changes {
+		mainLog.Infof("Sync: %s %s %s", c.Action, c.Kind, c.ID)
+	}
+	applySyncState(desired, reload)
+	return plan, nil
+}
+
+// syncLoop applies the changes of the sync directory as they are made.
+func syncLoop(ctx context.Context) {
+	interval := config.Global().Sync.Interval
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runSync(true)
+		}
+	}
+}
+
+// syncStateApplied reports whether a sync has been applied yet.
+func syncStateApplied() bool {
+	syncApplied.RLock()
+	defer syncApplied.RUnlock()
+	return syncApplied.state != nil
+}
+
+// syncedAPISpecs returns the specs of the applied sync state. The
+// definitions are copied as loading a spec modifies its definition.
+func syncedAPISpecs(loader APIDefinitionLoader) []*APISpec {
+	syncApplied.RLock()
+	state := syncApplied.state
+	syncApplied.RUnlock()
+	if state == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(state.APIs))
+	for id := range state.APIs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	specs := make([]*APISpec, 0, len(ids))
+	for _, id := range ids {
+		data, err := json.Marshal(state.APIs[id])
+		if err != nil {
+			continue
+		}
+		spec, err := loader.makeSpecFromFile(data)
+		if err != nil {
+			mainLog.WithError(err).Error("Couldn't expand templates of synced API: ", id)
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// syncedPolicies returns a copy of the policies of the applied sync state
+// with their templates expanded.
+func syncedPolicies() map[string]user.Policy {
+	syncApplied.RLock()
+	state := syncApplied.state
+	syncApplied.RUnlock()
+	if state == nil {
+		return nil
+	}
+
+	var (
+		pols map[string]user.Policy
+		refs map[string]string
+	)
+	data, err := json.Marshal(state.Policies)
+	if err == nil {
+		data, refs, err = expandFileTemplates(data)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &pols)
+	}
+	setKVRefs(kvRefOwnerPolicyFile, refs)
+	if err != nil {
+		mainLog.WithError(err).Error("Couldn't copy synced policies")
+		return nil
+	}
+	return pols
+}
+
+func syncPlanHandler(w http.ResponseWriter, r *http.Request) {
+	path := config.Global().Sync.Path
+	if path == "" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Sync path is not configured"))
+		return
+	}
+	desired, err := loadSyncState(path)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, planSync(currentSyncState(), desired))
+}
+
+func syncHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.Global().Sync.Enabled {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Sync is not enabled"))
+		return
+	}
+	plan, err := runSync(true)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, plan)
+}
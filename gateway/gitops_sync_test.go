@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestGitOpsSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := func(id, listenPath string) string {
+		return `{"api_id":"` + id + `","org_id":"default","use_keyless":true,"active":true,
+			"proxy":{"listen_path":"` + listenPath + `","target_url":"` + TestHttpAny + `"},
+			"version_data":{"not_versioned":true,"versions":{"Default":{"name":"Default"}}}}`
+	}
+
+	certPem, _, _, _ := genCertificate(&x509.Certificate{})
+	certID, _, _ := certs.GetCertIDAndChainPEM(certPem, "")
+	write("apis/a.json", api("sync-a", "/sync-a/"))
+	write("apis/nested/b.json", api("sync-b", "/sync-b/"))
+	write("policies/policies.json", `{"sync-pol":{"rate":10,"per":1}}`)
+	write("certs/upstream.pem", string(certPem))
+
+	globalConf := config.Global()
+	globalConf.Sync.Enabled = true
+	globalConf.Sync.Path = dir
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+	defer func() {
+		syncApplied.Lock()
+		syncApplied.state = nil
+		syncApplied.Unlock()
+		CertificateManager.Delete(certID, "")
+	}()
+
+	resp, _ := ts.Run(t, test.TestCase{Method: "GET", Path: "/tyk/sync/plan", AdminAuth: true, Code: 200,
+		BodyMatch: `"kind":"certificate","id":"` + certID + `","action":"create"`})
+	var planned syncPlan
+	if err := json.NewDecoder(resp.Body).Decode(&planned); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := runSync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 4 {
+		t.Errorf("expected 4 changes, got %+v", plan.Changes)
+	}
+	if !reflect.DeepEqual(planned, plan) {
+		t.Errorf("expected the applied changes %+v to match the plan %+v", plan.Changes, planned.Changes)
+	}
+	DoReload()
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/sync-a/", Code: 200},
+		{Path: "/sync-b/", Code: 200},
+		{Method: "GET", Path: "/tyk/sync/plan", AdminAuth: true, Code: 200, BodyMatch: `"changes":null`},
+	}...)
+	policiesMu.RLock()
+	_, ok := policiesByID["sync-pol"]
+	policiesMu.RUnlock()
+	if !ok {
+		t.Error("expected the policy to be loaded")
+	}
+	if _, err := CertificateManager.GetRaw(certID); err != nil {
+		t.Error("expected the certificate to be added")
+	}
+
+	t.Run("invalid directory", func(t *testing.T) {
+		write("apis/c.json", `{"proxy":{"listen_path":"/sync-c/"}}`)
+		defer os.Remove(filepath.Join(dir, "apis/c.json"))
+
+		if _, err := runSync(false); err == nil {
+			t.Fatal("expected the sync to fail")
+		}
+		ts.Run(t, test.TestCase{Method: "GET", Path: "/tyk/sync/plan", AdminAuth: true, Code: 400, BodyMatch: `c.json: api_id is not set`})
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		write("apis/a.json", api("sync-a", "/sync-a-moved/"))
+		os.Remove(filepath.Join(dir, "apis/nested/b.json"))
+		os.Remove(filepath.Join(dir, "certs/upstream.pem"))
+
+		plan, err := runSync(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []syncChange{
+			{Kind: syncKindCertificate, ID: certID, Action: syncDelete},
+			{Kind: syncKindAPI, ID: "sync-a", Action: syncUpdate, File: filepath.Join(dir, "apis/a.json")},
+			{Kind: syncKindAPI, ID: "sync-b", Action: syncDelete},
+		}
+		if len(plan.Changes) != len(want) {
+			t.Fatalf("expected %+v, got %+v", want, plan.Changes)
+		}
+		for i := range want {
+			if plan.Changes[i] != want[i] {
+				t.Errorf("expected %+v, got %+v", want[i], plan.Changes[i])
+			}
+		}
+		DoReload()
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/sync-a-moved/", Code: 200},
+			{Path: "/sync-b/", Code: 404},
+		}...)
+		if _, err := CertificateManager.GetRaw(certID); err == nil {
+			t.Error("expected the certificate to be deleted")
+		}
+	})
+}
+
+func TestGitOpsSync_InvalidDirectoryFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "apis"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "apis/a.json"), []byte(`{"proxy":{"listen_path":"/sync-a/"}}`), 0644)
+
+	globalConf := config.Global()
+	globalConf.Sync.Enabled = true
+	globalConf.Sync.Path = dir
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	if _, err := runSync(false); err == nil {
+		t.Fatal("expected the sync to fail")
+	}
+	if syncStateApplied() {
+		t.Fatal("expected no sync state to be applied")
+	}
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/app-path/"
+	})
+	ts.Run(t, test.TestCase{Path: "/app-path/", Code: 200})
+}
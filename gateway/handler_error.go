@@ -65,6 +65,21 @@ func defaultTykErrors() {
 		Message: "Key not authorised. OAuth client access was revoked",
 		Code:    http.StatusForbidden,
 	}
+
+	TykErrors[ErrAuthCertificateMismatch] = config.TykError{
+		Message: "Client certificate does not match the certificate the token is bound to",
+		Code:    http.StatusUnauthorized,
+	}
+
+	TykErrors[ErrAuthzDenied] = config.TykError{
+		Message: "Access to this resource has been disallowed",
+		Code:    http.StatusForbidden,
+	}
+
+	TykErrors[ErrAuthzUnavailable] = config.TykError{
+		Message: "Authorization service unavailable",
+		Code:    http.StatusServiceUnavailable,
+	}
 }
 
 func overrideTykErrors() {
@@ -171,6 +186,8 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 		pprof.WriteHeapProfile(memProfFile)
 	}
 
+	prometheusMetrics.observeRequest(e.Spec, r, errCode, nil)
+
 	if e.Spec.DoNotTrack || ctxGetDoNotTrack(r) {
 		return
 	}
@@ -179,8 +196,10 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 	token := ctxGetAuthToken(r)
 	var alias string
 
+	sampled, weight := e.Spec.shouldRecordAnalytics(r, errCode, 0)
+
 	ip := request.RealIP(r)
-	if e.Spec.GlobalConfig.StoreAnalytics(ip) {
+	if sampled && e.Spec.GlobalConfig.StoreAnalytics(ip) {
 
 		t := time.Now()
 
@@ -222,11 +241,11 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 
 			var wireFormatReq bytes.Buffer
 			r.Write(&wireFormatReq)
-			rawRequest = base64.StdEncoding.EncodeToString(wireFormatReq.Bytes())
+			rawRequest = base64.StdEncoding.EncodeToString(e.Spec.analyticsRedactor.request(wireFormatReq.Bytes()))
 
 			var wireFormatRes bytes.Buffer
 			response.Write(&wireFormatRes)
-			rawResponse = base64.StdEncoding.EncodeToString(wireFormatRes.Bytes())
+			rawResponse = base64.StdEncoding.EncodeToString(e.Spec.analyticsRedactor.response(wireFormatRes.Bytes()))
 
 		}
 
@@ -272,6 +291,7 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			alias,
 			trackEP,
 			t,
+			weight,
 		}
 
 		if e.Spec.GlobalConfig.AnalyticsConfig.EnableGeoIP {
@@ -129,13 +129,16 @@ func getSessionTags(session *user.SessionState) []string {
 }
 
 func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, responseCopy *http.Response) {
+	prometheusMetrics.observeRequest(s.Spec, r, code, &timing)
 
 	if s.Spec.DoNotTrack || ctxGetDoNotTrack(r) {
 		return
 	}
 
+	sampled, weight := s.Spec.shouldRecordAnalytics(r, code, timing.Total)
+
 	ip := request.RealIP(r)
-	if s.Spec.GlobalConfig.StoreAnalytics(ip) {
+	if sampled && s.Spec.GlobalConfig.StoreAnalytics(ip) {
 
 		t := time.Now()
 
@@ -170,7 +173,7 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			// Get the wire format representation
 			var wireFormatReq bytes.Buffer
 			r.Write(&wireFormatReq)
-			rawRequest = base64.StdEncoding.EncodeToString(wireFormatReq.Bytes())
+			rawRequest = base64.StdEncoding.EncodeToString(s.Spec.analyticsRedactor.request(wireFormatReq.Bytes()))
 			// responseCopy, unlike requestCopy, can be nil
 			// here - if the response was cached in
 			// mw_redis_cache, RecordHit gets passed a nil
@@ -190,7 +193,7 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 				var wireFormatRes bytes.Buffer
 				responseCopy.Write(&wireFormatRes)
 				responseCopy.Body = ioutil.NopCloser(bytes.NewBuffer(contents))
-				rawResponse = base64.StdEncoding.EncodeToString(wireFormatRes.Bytes())
+				rawResponse = base64.StdEncoding.EncodeToString(s.Spec.analyticsRedactor.response(wireFormatRes.Bytes()))
 			}
 		}
 
@@ -236,6 +239,7 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			alias,
 			trackEP,
 			t,
+			weight,
 		}
 
 		if s.Spec.GlobalConfig.AnalyticsConfig.EnableGeoIP {
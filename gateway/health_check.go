@@ -104,7 +104,7 @@ type SafeHealthCheck struct {
 func gatherHealthChecks() {
 	allInfos := SafeHealthCheck{info: make(map[string]HealthCheckItem, 3)}
 
-	redisStore := storage.RedisCluster{KeyPrefix: "livenesscheck-"}
+	redisStore := storage.New("livenesscheck-", false, false)
 
 	key := "tyk-liveness-probe"
 
@@ -243,6 +243,7 @@ func (hc *HostCheckerManager) OnHostDown(ctx context.Context, report HostHealthR
 		return
 	}
 
+	prometheusMetrics.hostState(spec, report.CheckURL, false)
 	spec.FireEvent(EventHOSTDOWN, EventHostStatusMeta{
 		EventMetaDefault: EventMetaDefault{Message: "Uptime test failed"},
 		HostInfo:         report,
@@ -286,6 +287,7 @@ func (hc *HostCheckerManager) OnHostBackUp(ctx context.Context, report HostHealt
 		}).Warning("[HOST CHECKER MANAGER] Event can't fire for API that doesn't exist")
 		return
 	}
+	prometheusMetrics.hostState(spec, report.CheckURL, true)
 	spec.FireEvent(EventHOSTUP, EventHostStatusMeta{
 		EventMetaDefault: EventMetaDefault{Message: "Uptime test succeeded"},
 		HostInfo:         report,
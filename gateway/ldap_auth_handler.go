@@ -231,6 +231,11 @@ func (l LDAPStorageHandler) RemoveFromList(keyName, value string) error {
 	return nil
 }
 
+func (l LDAPStorageHandler) TrimList(keyName string, from, to int64) error {
+	log.Error("Not implemented")
+	return nil
+}
+
 func (l *LDAPStorageHandler) GetListRange(keyName string, from, to int64) ([]string, error) {
 	log.Error("Not implemented")
 	return nil, nil
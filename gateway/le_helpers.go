@@ -19,7 +19,7 @@ func StoreLEState(m *letsencrypt.Manager) {
 
 	log.Debug("[SSL] --> Connecting to DB")
 
-	store := storage.RedisCluster{KeyPrefix: LEKeyPrefix}
+	store := storage.New(LEKeyPrefix, false, false)
 	connected := store.Connect()
 
 	log.Debug("--> Connected to DB")
@@ -42,7 +42,7 @@ func StoreLEState(m *letsencrypt.Manager) {
 func GetLEState(m *letsencrypt.Manager) {
 	checkKey := "cache"
 
-	store := storage.RedisCluster{KeyPrefix: LEKeyPrefix}
+	store := storage.New(LEKeyPrefix, false, false)
 
 	connected := store.Connect()
 	log.Debug("[SSL] --> Connected to DB")
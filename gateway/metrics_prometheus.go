@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const defaultPrometheusPath = "/metrics"
+
+// prometheusMetrics holds the gateway metrics exposed on the control API.
+// Metrics are only updated when config.Prometheus.Enabled is set.
+var prometheusMetrics = newGatewayMetrics()
+
+type gatewayMetrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	upstreamLatency *prometheus.HistogramVec
+	rejections      *prometheus.CounterVec
+	cacheRequests   *prometheus.CounterVec
+	breakerOpen     *prometheus.GaugeVec
+	hostUp          *prometheus.GaugeVec
+	reloads         *prometheus.CounterVec
+}
+
+func newGatewayMetrics() *gatewayMetrics {
+	m := &gatewayMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tyk",
+			Name:      "http_requests_total",
+			Help:      "Requests handled by the gateway.",
+		}, []string{"api_id", "api_version", "status_class", "method"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "tyk",
+			Name:      "http_request_duration_seconds",
+			Help:      "Total latency of proxied requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"api_id", "api_version", "status_class", "method"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "tyk",
+			Name:      "upstream_latency_seconds",
+			Help:      "Latency of the upstream services.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"api_id"}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tyk",
+			Name:      "rejected_requests_total",
+			Help:      "Requests rejected by rate limits and quotas.",
+		}, []string{"api_id", "reason"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tyk",
+			Name:      "cache_requests_total",
+			Help:      "Cacheable requests by cache status.",
+		}, []string{"api_id", "status"}),
+		breakerOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "tyk",
+			Name:      "circuit_breaker_open",
+			Help:      "Whether the circuit breaker of a path is tripped.",
+		}, []string{"api_id", "path"}),
+		hostUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "tyk",
+			Name:      "host_up",
+			Help:      "Whether an uptime-checked host is up.",
+		}, []string{"api_id", "host"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tyk",
+			Name:      "reloads_total",
+			Help:      "API and policy reloads.",
+		}, []string{"type"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.upstreamLatency,
+		m.rejections,
+		m.cacheRequests,
+		m.breakerOpen,
+		m.hostUp,
+		m.reloads,
+		newRedisPoolCollector(),
+		newResponseCacheL1Collector(),
+	)
+
+	return m
+}
+
+func (m *gatewayMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// observeRequest records a handled request, latency is only known for the
+// requests that reached the end of the middleware chain.
+func (m *gatewayMetrics) observeRequest(spec *APISpec, r *http.Request, code int, latency *Latency) {
+	if !spec.GlobalConfig.Prometheus.Enabled {
+		return
+	}
+
+	version := spec.getVersionFromRequest(r)
+	if version == "" {
+		version = "Non Versioned"
+	}
+	class := statusClass(code)
+	m.requests.WithLabelValues(spec.APIID, version, class, r.Method).Inc()
+
+	if latency != nil {
+		m.requestDuration.WithLabelValues(spec.APIID, version, class, r.Method).Observe(float64(latency.Total) / 1e3)
+		m.upstreamLatency.WithLabelValues(spec.APIID).Observe(float64(latency.Upstream) / 1e3)
+	}
+}
+
+func (m *gatewayMetrics) rejected(spec *APISpec, reason string) {
+	if spec.GlobalConfig.Prometheus.Enabled {
+		m.rejections.WithLabelValues(spec.APIID, reason).Inc()
+	}
+}
+
+func (m *gatewayMetrics) cacheStatus(spec *APISpec, status string) {
+	if spec.GlobalConfig.Prometheus.Enabled {
+		m.cacheRequests.WithLabelValues(spec.APIID, status).Inc()
+	}
+}
+
+func (m *gatewayMetrics) breakerState(spec *APISpec, path string, open bool) {
+	if !spec.GlobalConfig.Prometheus.Enabled {
+		return
+	}
+	value := 0.0
+	if open {
+		value = 1
+	}
+	m.breakerOpen.WithLabelValues(spec.APIID, path).Set(value)
+}
+
+func (m *gatewayMetrics) hostState(spec *APISpec, host string, up bool) {
+	if !spec.GlobalConfig.Prometheus.Enabled {
+		return
+	}
+	value := 0.0
+	if up {
+		value = 1
+	}
+	m.hostUp.WithLabelValues(spec.APIID, host).Set(value)
+}
+
+func (m *gatewayMetrics) reloaded(kind string) {
+	if config.Global().Prometheus.Enabled {
+		m.reloads.WithLabelValues(kind).Inc()
+	}
+}
+
+// redisPoolCollector reports the stats of the Redis connection pools.
+type redisPoolCollector struct {
+	descs map[string]*prometheus.Desc
+}
+
+func newRedisPoolCollector() redisPoolCollector {
+	return redisPoolCollector{descs: map[string]*prometheus.Desc{
+		"hits":        prometheus.NewDesc("tyk_redis_pool_hits_total", "Free connections found in the pool.", []string{"pool"}, nil),
+		"misses":      prometheus.NewDesc("tyk_redis_pool_misses_total", "Free connections not found in the pool.", []string{"pool"}, nil),
+		"timeouts":    prometheus.NewDesc("tyk_redis_pool_timeouts_total", "Waits for a connection that timed out.", []string{"pool"}, nil),
+		"total_conns": prometheus.NewDesc("tyk_redis_pool_connections", "Connections in the pool.", []string{"pool"}, nil),
+		"idle_conns":  prometheus.NewDesc("tyk_redis_pool_idle_connections", "Idle connections in the pool.", []string{"pool"}, nil),
+		"stale_conns": prometheus.NewDesc("tyk_redis_pool_stale_connections_total", "Stale connections removed from the pool.", []string{"pool"}, nil),
+	}}
+}
+
+func (c redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for pool, cache := range map[string]bool{"main": false, "cache": true} {
+		stats := storage.PoolStats(cache)
+		if stats == nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.descs["hits"], prometheus.CounterValue, float64(stats.Hits), pool)
+		ch <- prometheus.MustNewConstMetric(c.descs["misses"], prometheus.CounterValue, float64(stats.Misses), pool)
+		ch <- prometheus.MustNewConstMetric(c.descs["timeouts"], prometheus.CounterValue, float64(stats.Timeouts), pool)
+		ch <- prometheus.MustNewConstMetric(c.descs["total_conns"], prometheus.GaugeValue, float64(stats.TotalConns), pool)
+		ch <- prometheus.MustNewConstMetric(c.descs["idle_conns"], prometheus.GaugeValue, float64(stats.IdleConns), pool)
+		ch <- prometheus.MustNewConstMetric(c.descs["stale_conns"], prometheus.CounterValue, float64(stats.StaleConns), pool)
+	}
+}
+
+// responseCacheL1Collector reports the hits and misses of the in-memory
+// response cache.
+type responseCacheL1Collector struct {
+	desc *prometheus.Desc
+}
+
+func newResponseCacheL1Collector() responseCacheL1Collector {
+	return responseCacheL1Collector{desc: prometheus.NewDesc("tyk_response_cache_l1_requests_total",
+		"Lookups in the in-memory response cache.", []string{"result"}, nil)}
+}
+
+func (c responseCacheL1Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c responseCacheL1Collector) Collect(ch chan<- prometheus.Metric) {
+	responseL1Mu.Lock()
+	l1 := responseL1
+	responseL1Mu.Unlock()
+	if l1 == nil {
+		return
+	}
+
+	hits, misses := l1.Stats()
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(hits), "hit")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(misses), "miss")
+}
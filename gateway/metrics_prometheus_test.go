@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func Test_statusClass(t *testing.T) {
+	for code, class := range map[int]string{200: "2xx", 304: "3xx", 429: "4xx", 503: "5xx", 0: "unknown"} {
+		if got := statusClass(code); got != class {
+			t.Errorf("Expected %s for %d, got %s", class, code, got)
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.Prometheus.Enabled = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "metrics"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/metrics-api/"
+	})
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"metrics": {APIID: "metrics"}}
+		s.QuotaMax = 1
+		s.QuotaRemaining = 1
+		s.QuotaRenewalRate = 3600
+	})
+	authHeaders := map[string]string{"Authorization": key}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/metrics-api/", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/metrics-api/", Headers: authHeaders, Code: http.StatusForbidden},
+		{Path: "/metrics-api/", Code: http.StatusUnauthorized},
+	}...)
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/metrics", Code: http.StatusForbidden},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_http_requests_total{api_id="metrics",api_version="Non Versioned",method="GET",status_class="2xx"} 1`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_http_requests_total{api_id="metrics",api_version="Non Versioned",method="GET",status_class="4xx"} 2`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_http_request_duration_seconds_count{api_id="metrics",api_version="Non Versioned",method="GET",status_class="2xx"} 1`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_upstream_latency_seconds_count{api_id="metrics"} 1`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_rejected_requests_total{api_id="metrics",reason="quota"} 1`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_reloads_total{type="apis"}`},
+		{Path: "/metrics", AdminAuth: true, Code: http.StatusOK, BodyMatch: `tyk_redis_pool_connections{pool="main"}`},
+	}...)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/gocraft/health"
 	"github.com/justinas/alice"
 	newrelic "github.com/newrelic/go-agent"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/paulbellamy/ratecounter"
 	cache "github.com/pmylund/go-cache"
 	"github.com/sirupsen/logrus"
@@ -68,11 +69,22 @@ func (tr TraceMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		)
 		defer span.Finish()
 		setContext(r, ctx)
-		return tr.TykMiddleware.ProcessRequest(w, r, conf)
+		err, code := tr.TykMiddleware.ProcessRequest(w, r, conf)
+		setSpanTags(span, tr.Base().Spec, r)
+		return err, code
 	}
 	return tr.TykMiddleware.ProcessRequest(w, r, conf)
 }
 
+// setSpanTags tags span with the API and, once the request is authenticated,
+// the alias of the key used.
+func setSpanTags(span opentracing.Span, spec *APISpec, r *http.Request) {
+	span.SetTag("tyk.api.id", spec.APIID)
+	if session := ctxGetSession(r); session != nil && session.Alias != "" {
+		span.SetTag("tyk.key.alias", session.Alias)
+	}
+}
+
 func createDynamicMiddleware(name string, isPre, useSession bool, baseMid BaseMiddleware) func(http.Handler) http.Handler {
 	dMiddleware := &DynamicMiddleware{
 		BaseMiddleware:      baseMid,
@@ -185,6 +197,15 @@ func mwAppendEnabled(chain *[]alice.Constructor, mw TykMiddleware) bool {
 	return false
 }
 
+// mwEnabled appends mw to list when it is enabled for its API.
+func mwEnabled(list *[]TykMiddleware, mw TykMiddleware) bool {
+	if mw.EnabledForSpec() {
+		*list = append(*list, mw)
+		return true
+	}
+	return false
+}
+
 func mwList(mws ...TykMiddleware) []alice.Constructor {
 	var list []alice.Constructor
 	for _, mw := range mws {
@@ -56,6 +56,7 @@ func (k *RateLimitForAPI) handleRateLimitFailure(r *http.Request, token string)
 
 	// Report in health check
 	reportHealthValue(k.Spec, Throttle, "-1")
+	prometheusMetrics.rejected(k.Spec, "api_rate_limit")
 
 	return errors.New("API Rate limit exceeded"), http.StatusTooManyRequests
 }
@@ -67,7 +68,7 @@ func (k *RateLimitForAPI) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return nil, http.StatusOK
 	}
 
-	storeRef := GlobalSessionManager.Store()
+	storeRef := limiterStore(r)
 	reason := sessionLimiter.ForwardMessage(r, k.apiSess,
 		k.keyName,
 		storeRef,
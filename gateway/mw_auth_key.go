@@ -92,13 +92,21 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inter
 		AuthFailed(k, r, key)
 
 		// Report in health check
-		reportHealthValue(k.Spec, KeyFailure, "1")
+		reportKeyFailure(r, k.Spec, "1")
 
 		return errorAndStatusCode(ErrAuthKeyNotFound)
 	}
 
+	if !sessionCertificateBindingValid(r, &session) {
+		k.Logger().WithField("key", obfuscateKey(key)).Info("Attempted access with a key bound to a different client certificate.")
+		AuthFailed(k, r, key)
+		reportKeyFailure(r, k.Spec, "1")
+
+		return errorAndStatusCode(ErrAuthCertificateMismatch)
+	}
+
 	// Set session state on context, we will need it later
-	switch k.Spec.BaseIdentityProvidedBy {
+	switch k.Spec.baseIdentityProvidedBy() {
 	case apidef.AuthToken, apidef.UnsetAuth:
 		ctxSetSession(r, &session, key, false)
 		k.setContextVars(r, key)
@@ -159,11 +167,33 @@ func stripBearer(token string) string {
 	return token
 }
 
+// reportAuthFailure runs report, which fires auth failure events or records
+// key failures. In any-of auth mode the reports are held back until every
+// auth method has rejected the request.
+func reportAuthFailure(r *http.Request, report func()) {
+	if failures := ctxGetAuthFailures(r); failures != nil {
+		*failures = append(*failures, report)
+		return
+	}
+	report()
+}
+
 func AuthFailed(m TykMiddleware, r *http.Request, token string) {
-	m.Base().FireEvent(EventAuthFailure, EventKeyFailureMeta{
+	meta := EventKeyFailureMeta{
 		EventMetaDefault: EventMetaDefault{Message: "Auth Failure", OriginatingRequest: EncodeRequestToEvent(r)},
 		Path:             r.URL.Path,
 		Origin:           request.RealIP(r),
 		Key:              token,
+	}
+	reportAuthFailure(r, func() {
+		m.Base().FireEvent(EventAuthFailure, meta)
+	})
+}
+
+// reportKeyFailure reports a key failure in the health check, it is held
+// back in any-of auth mode like AuthFailed.
+func reportKeyFailure(r *http.Request, spec *APISpec, value string) {
+	reportAuthFailure(r, func() {
+		reportHealthValue(spec, KeyFailure, value)
 	})
 }
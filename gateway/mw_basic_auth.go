@@ -211,7 +211,7 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Set session state on context, we will need it later
-	switch k.Spec.BaseIdentityProvidedBy {
+	switch k.Spec.baseIdentityProvidedBy() {
 	case apidef.BasicAuthUser, apidef.UnsetAuth:
 		ctxSetSession(r, &session, keyName, false)
 	}
@@ -225,7 +225,7 @@ func (k *BasicAuthKeyIsValid) handleAuthFail(w http.ResponseWriter, r *http.Requ
 	AuthFailed(k, r, token)
 
 	// Report in health check
-	reportHealthValue(k.Spec, KeyFailure, "-1")
+	reportKeyFailure(r, k.Spec, "-1")
 
 	return k.requestForBasicAuth(w, "User not authorised")
 }
@@ -0,0 +1,399 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+const (
+	ErrAuthzDenied      = "authz.denied"
+	ErrAuthzUnavailable = "authz.unavailable"
+
+	defaultAuthzTimeout    = 2 * time.Second
+	defaultAuthzGRPCMethod = "/tyk.authz.Authorizer/Check"
+)
+
+func init() {
+	TykErrors[ErrAuthzDenied] = config.TykError{
+		Message: "Access to this resource has been disallowed",
+		Code:    http.StatusForbidden,
+	}
+
+	TykErrors[ErrAuthzUnavailable] = config.TykError{
+		Message: "Authorization service unavailable",
+		Code:    http.StatusServiceUnavailable,
+	}
+}
+
+var (
+	authzGRPCConns   = map[string]*grpc.ClientConn{}
+	authzGRPCConnsMu sync.Mutex
+)
+
+// authzDecisionRequest is the input sent to the decision service. The HTTP
+// driver wraps it as {"input": ...} so that it can be posted to an OPA data
+// API endpoint as is.
+type authzDecisionRequest struct {
+	APIID    string                 `json:"api_id"`
+	OrgID    string                 `json:"org_id"`
+	Method   string                 `json:"method"`
+	Path     string                 `json:"path"`
+	Query    string                 `json:"query"`
+	RemoteIP string                 `json:"remote_ip"`
+	Headers  map[string][]string    `json:"headers"`
+	Session  *authzSession          `json:"session,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+
+type authzSession struct {
+	KeyHash  string                 `json:"key_hash"`
+	Alias    string                 `json:"alias"`
+	Policies []string               `json:"policies"`
+	Tags     []string               `json:"tags"`
+	MetaData map[string]interface{} `json:"meta_data"`
+}
+
+// authzDecision is the result returned by the decision service.
+type authzDecision struct {
+	Allow bool `json:"allow"`
+	// Optional status code and message used when the request is denied.
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Header mutations applied to the upstream request when allowed.
+	Headers struct {
+		Set    map[string]string `json:"set"`
+		Remove []string          `json:"remove"`
+	} `json:"headers"`
+}
+
+// ExternalAuthzMiddleware asks an external decision service whether an
+// authenticated request may proceed.
+type ExternalAuthzMiddleware struct {
+	BaseMiddleware
+	decisions *cache.Cache
+	client    *http.Client
+	tlsConfig *tls.Config
+}
+
+func (m *ExternalAuthzMiddleware) Name() string {
+	return "ExternalAuthzMiddleware"
+}
+
+func (m *ExternalAuthzMiddleware) EnabledForSpec() bool {
+	return m.Spec.ExternalAuthz.Enabled && m.Spec.ExternalAuthz.URL != ""
+}
+
+func (m *ExternalAuthzMiddleware) Init() {
+	m.tlsConfig = m.buildTLSConfig()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = m.tlsConfig
+	m.client = &http.Client{Timeout: m.timeout(), Transport: transport}
+
+	if m.Spec.ExternalAuthz.CacheTTL > 0 {
+		ttl := time.Duration(m.Spec.ExternalAuthz.CacheTTL) * time.Second
+		m.decisions = cache.New(ttl, 2*ttl)
+	}
+}
+
+func (m *ExternalAuthzMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if ctxGetRequestStatus(r) == StatusOkAndIgnore {
+		return nil, http.StatusOK
+	}
+
+	conf := m.Spec.ExternalAuthz
+	input := m.decisionRequest(r)
+
+	decision, err := m.decide(input)
+	if err != nil {
+		m.Logger().WithError(err).Error("External authorization request failed")
+		if conf.FailOpen {
+			return nil, http.StatusOK
+		}
+		return errorAndStatusCode(ErrAuthzUnavailable)
+	}
+
+	if !decision.Allow {
+		m.Logger().WithFields(logrus.Fields{
+			"path":   input.Path,
+			"origin": input.RemoteIP,
+		}).Info("Request denied by external authorization")
+
+		err, code := errorAndStatusCode(ErrAuthzDenied)
+		if decision.Status >= 400 && decision.Status <= 599 {
+			code = decision.Status
+		}
+		if decision.Message != "" {
+			err = errors.New(decision.Message)
+		}
+		return err, code
+	}
+
+	for _, name := range decision.Headers.Remove {
+		r.Header.Del(name)
+	}
+	for name, value := range decision.Headers.Set {
+		r.Header.Set(name, value)
+	}
+
+	return nil, http.StatusOK
+}
+
+func (m *ExternalAuthzMiddleware) decisionRequest(r *http.Request) *authzDecisionRequest {
+	input := &authzDecisionRequest{
+		APIID:    m.Spec.APIID,
+		OrgID:    m.Spec.OrgID,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		RemoteIP: request.RealIP(r),
+		Headers:  map[string][]string{},
+		Claims:   ctxGetJWTClaims(r),
+	}
+
+	if include := m.Spec.ExternalAuthz.IncludeHeaders; len(include) > 0 {
+		for _, name := range include {
+			if values := r.Header.Values(name); len(values) > 0 {
+				input.Headers[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	} else {
+		for name, values := range r.Header {
+			input.Headers[name] = values
+		}
+	}
+
+	if session := ctxGetSession(r); session != nil {
+		input.Session = &authzSession{
+			KeyHash:  session.GetKeyHash(),
+			Alias:    session.Alias,
+			Policies: session.GetPolicyIDs(),
+			Tags:     session.Tags,
+			MetaData: session.GetMetaData(),
+		}
+	}
+
+	return input
+}
+
+func (m *ExternalAuthzMiddleware) decide(input *authzDecisionRequest) (*authzDecision, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheKey string
+	if m.decisions != nil {
+		cacheKey = m.decisionCacheKey(input)
+		if cached, found := m.decisions.Get(cacheKey); found {
+			return cached.(*authzDecision), nil
+		}
+	}
+
+	var decision *authzDecision
+	if strings.ToLower(m.Spec.ExternalAuthz.Driver) == "grpc" {
+		decision, err = m.decideGRPC(input)
+	} else {
+		decision, err = m.decideHTTP(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.decisions != nil {
+		m.decisions.Set(cacheKey, decision, cache.DefaultExpiration)
+	}
+
+	return decision, nil
+}
+
+// decisionCacheKey identifies the requests sharing a cached decision. Every
+// header sent to the decision service is part of the key, so setting
+// include_headers is what makes decisions reusable across requests.
+func (m *ExternalAuthzMiddleware) decisionCacheKey(input *authzDecisionRequest) string {
+	identity := input.RemoteIP
+	if input.Session != nil {
+		identity = input.Session.KeyHash
+	}
+
+	h := sha256.New()
+	for _, part := range []string{input.Method, input.Path, input.Query, identity} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	names := make([]string, 0, len(input.Headers))
+	for name := range input.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{1})
+		for _, value := range input.Headers[name] {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *ExternalAuthzMiddleware) timeout() time.Duration {
+	if m.Spec.ExternalAuthz.Timeout > 0 {
+		return time.Duration(m.Spec.ExternalAuthz.Timeout) * time.Millisecond
+	}
+	return defaultAuthzTimeout
+}
+
+// buildTLSConfig returns the TLS configuration used to connect to the
+// decision service, with the certificates of the API definition.
+func (m *ExternalAuthzMiddleware) buildTLSConfig() *tls.Config {
+	conf := m.Spec.ExternalAuthz.TLS
+	tlsConfig := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if len(conf.CACertificates) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for _, cert := range CertificateManager.List(conf.CACertificates, certs.CertificatePublic) {
+			if cert != nil {
+				tlsConfig.RootCAs.AddCert(cert.Leaf)
+			}
+		}
+	}
+
+	if conf.Certificate != "" {
+		certList := CertificateManager.List([]string{conf.Certificate}, certs.CertificatePrivate)
+		if len(certList) == 0 || certList[0] == nil {
+			m.Logger().Error("External authz client certificate not found: ", conf.Certificate)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{*certList[0]}
+		}
+	}
+
+	return tlsConfig
+}
+
+func (m *ExternalAuthzMiddleware) decideHTTP(input []byte) (*authzDecision, error) {
+	body := bytes.NewBufferString(`{"input":`)
+	body.Write(input)
+	body.WriteString("}")
+
+	resp, err := m.client.Post(m.Spec.ExternalAuthz.URL, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("decision service returned status %d", resp.StatusCode)
+	}
+
+	// OPA wraps the policy output in "result", other services may return
+	// the decision directly.
+	var out struct {
+		Result *authzDecision `json:"result"`
+		authzDecision
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	if out.Result != nil {
+		return out.Result, nil
+	}
+
+	return &out.authzDecision, nil
+}
+
+func (m *ExternalAuthzMiddleware) decideGRPC(input *authzDecisionRequest) (*authzDecision, error) {
+	conn, err := m.grpcConn()
+	if err != nil {
+		return nil, err
+	}
+
+	method := m.Spec.ExternalAuthz.GRPCMethod
+	if method == "" {
+		method = defaultAuthzGRPCMethod
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout())
+	defer cancel()
+
+	decision := &authzDecision{}
+	if err := conn.Invoke(ctx, method, input, decision, grpc.ForceCodec(authzJSONCodec{})); err != nil {
+		return nil, err
+	}
+
+	return decision, nil
+}
+
+// grpcConn returns the connection to the grpc decision service. Connections
+// are shared by the APIs using the same target and TLS settings.
+func (m *ExternalAuthzMiddleware) grpcConn() (*grpc.ClientConn, error) {
+	target := m.Spec.ExternalAuthz.URL
+	key := target
+	creds := grpc.WithInsecure()
+	if conf := m.Spec.ExternalAuthz.TLS; conf.Enabled {
+		data, _ := json.Marshal(conf)
+		key += "|" + string(data)
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(m.tlsConfig))
+	}
+
+	authzGRPCConnsMu.Lock()
+	defer authzGRPCConnsMu.Unlock()
+
+	if conn, ok := authzGRPCConns[key]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(target, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	authzGRPCConns[key] = conn
+	return conn, nil
+}
+
+// authzJSONCodec lets decision services be implemented without sharing
+// protobuf definitions with the gateway: messages are sent as JSON using the
+// "application/grpc+json" content type. It is passed per call rather than
+// registered, so other gRPC users of the process keep the default codecs.
+type authzJSONCodec struct{}
+
+func (authzJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (authzJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (authzJSONCodec) Name() string {
+	return "json"
+}
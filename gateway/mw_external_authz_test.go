@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func testAuthzDecision(input authzDecisionRequest) authzDecision {
+	var decision authzDecision
+	if input.Headers["X-Role"] == nil || input.Headers["X-Role"][0] != "admin" {
+		decision.Message = "role " + input.Path + " denied"
+		return decision
+	}
+
+	decision.Allow = true
+	decision.Headers.Set = map[string]string{"X-Authz-Alias": input.Session.Alias}
+	decision.Headers.Remove = []string{"X-Role"}
+	return decision
+}
+
+// authzServerCodec decodes the JSON messages of the gRPC driver on the test
+// decision service.
+type authzServerCodec struct {
+	authzJSONCodec
+}
+
+func (authzServerCodec) String() string {
+	return "json"
+}
+
+func TestExternalAuthz(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var calls int32
+	decisionService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		var body struct {
+			Input authzDecisionRequest `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": testAuthzDecision(body.Input)})
+	}))
+	defer decisionService.Close()
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.Alias = "alice"
+	})
+
+	load := func(conf apidef.ExternalAuthzConfig) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+			spec.ExternalAuthz = conf
+		})
+	}
+
+	authorized := map[string]string{"Authorization": key, "X-Role": "admin"}
+	unauthorized := map[string]string{"Authorization": key, "X-Role": "guest"}
+
+	t.Run("Allow and deny", func(t *testing.T) {
+		load(apidef.ExternalAuthzConfig{Enabled: true, URL: decisionService.URL})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/get", Headers: authorized, Code: http.StatusOK, BodyMatch: `"X-Authz-Alias":"alice"`, BodyNotMatch: `X-Role`},
+			{Path: "/get", Headers: unauthorized, Code: http.StatusForbidden, BodyMatch: `role /get denied`},
+			{Path: "/get", Code: http.StatusUnauthorized},
+		}...)
+	})
+
+	t.Run("Cached decisions", func(t *testing.T) {
+		load(apidef.ExternalAuthzConfig{Enabled: true, URL: decisionService.URL, CacheTTL: 60, IncludeHeaders: []string{"X-Role"}})
+
+		atomic.StoreInt32(&calls, 0)
+		ts.Run(t, []test.TestCase{
+			{Path: "/cached", Headers: authorized, Code: http.StatusOK},
+			{Path: "/cached", Headers: map[string]string{"Authorization": key, "X-Role": "admin", "X-Request-Id": "2"}, Code: http.StatusOK},
+			{Path: "/cached", Headers: unauthorized, Code: http.StatusForbidden},
+		}...)
+
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Error("Expected 2 decision requests, got:", n)
+		}
+	})
+
+	t.Run("Cached decisions keyed by all headers", func(t *testing.T) {
+		load(apidef.ExternalAuthzConfig{Enabled: true, URL: decisionService.URL, CacheTTL: 60})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/all-headers", Headers: authorized, Code: http.StatusOK},
+			{Path: "/all-headers", Headers: unauthorized, Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("Fail closed", func(t *testing.T) {
+		load(apidef.ExternalAuthzConfig{Enabled: true, URL: "http://127.0.0.1:1/unreachable"})
+
+		ts.Run(t, test.TestCase{Path: "/get", Headers: authorized, Code: http.StatusServiceUnavailable})
+	})
+
+	t.Run("Fail open", func(t *testing.T) {
+		load(apidef.ExternalAuthzConfig{Enabled: true, URL: "http://127.0.0.1:1/unreachable", FailOpen: true})
+
+		ts.Run(t, test.TestCase{Path: "/get", Headers: authorized, Code: http.StatusOK})
+	})
+
+	t.Run("gRPC driver", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := grpc.NewServer(grpc.CustomCodec(authzServerCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			var input authzDecisionRequest
+			if err := stream.RecvMsg(&input); err != nil {
+				return err
+			}
+			decision := testAuthzDecision(input)
+			return stream.SendMsg(&decision)
+		}))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		load(apidef.ExternalAuthzConfig{Enabled: true, Driver: "grpc", URL: lis.Addr().String()})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/get", Headers: authorized, Code: http.StatusOK, BodyMatch: `"X-Authz-Alias":"alice"`},
+			{Path: "/get", Headers: unauthorized, Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("gRPC driver with TLS", func(t *testing.T) {
+		certPem, _, _, serverCert := genServerCertificate()
+		certID, err := CertificateManager.Add(certPem, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer CertificateManager.Delete(certID, "")
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&serverCert)), grpc.CustomCodec(authzServerCodec{}),
+			grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+				var input authzDecisionRequest
+				if err := stream.RecvMsg(&input); err != nil {
+					return err
+				}
+				decision := testAuthzDecision(input)
+				return stream.SendMsg(&decision)
+			}))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		load(apidef.ExternalAuthzConfig{Enabled: true, Driver: "grpc", URL: lis.Addr().String(), Timeout: 500})
+		ts.Run(t, test.TestCase{Path: "/get", Headers: authorized, Code: http.StatusServiceUnavailable})
+
+		load(apidef.ExternalAuthzConfig{Enabled: true, Driver: "grpc", URL: lis.Addr().String(),
+			TLS: apidef.ExternalAuthzTLS{Enabled: true, CACertificates: []string{certID}}})
+		ts.Run(t, []test.TestCase{
+			{Path: "/get", Headers: authorized, Code: http.StatusOK, BodyMatch: `"X-Authz-Alias":"alice"`},
+			{Path: "/get", Headers: unauthorized, Code: http.StatusForbidden},
+		}...)
+	})
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/TykTechnologies/tyk/ctx"
 	"github.com/TykTechnologies/tyk/goplugin"
-	"github.com/TykTechnologies/tyk/request"
 	"github.com/sirupsen/logrus"
 )
 
@@ -151,12 +150,7 @@ func (m *GoPluginMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reque
 		switch {
 		case rw.statusCodeSent == http.StatusForbidden:
 			m.logger.WithError(err).Error("Authentication error in Go-plugin middleware func")
-			m.Base().FireEvent(EventAuthFailure, EventKeyFailureMeta{
-				EventMetaDefault: EventMetaDefault{Message: "Auth Failure", OriginatingRequest: EncodeRequestToEvent(r)},
-				Path:             r.URL.Path,
-				Origin:           request.RealIP(r),
-				Key:              "n/a",
-			})
+			AuthFailed(m, r, "n/a")
 			fallthrough
 		case rw.statusCodeSent >= http.StatusBadRequest:
 			// base middleware will report this error to analytics if needed
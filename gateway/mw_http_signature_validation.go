@@ -199,7 +199,7 @@ func (hm *HTTPSignatureValidationMiddleware) ProcessRequest(w http.ResponseWrite
 	}
 
 	// Set session state on context, we will need it later
-	switch hm.Spec.BaseIdentityProvidedBy {
+	switch hm.Spec.baseIdentityProvidedBy() {
 	case apidef.HMACKey, apidef.UnsetAuth:
 		ctxSetSession(r, &session, fieldValues.KeyID, false)
 		hm.setContextVars(r, fieldValues.KeyID)
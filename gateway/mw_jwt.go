@@ -19,6 +19,8 @@ import (
 	jose "github.com/square/go-jose"
 
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/regexp"
+	"github.com/TykTechnologies/tyk/request"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -537,7 +539,7 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 	}
 
 	k.Logger().Debug("Key found")
-	switch k.Spec.BaseIdentityProvidedBy {
+	switch k.Spec.baseIdentityProvidedBy() {
 	case apidef.JWTClaim, apidef.UnsetAuth:
 		ctxSetSession(r, &session, sessionID, updateSession)
 
@@ -556,7 +558,7 @@ func (k *JWTMiddleware) reportLoginFailure(tykId string, r *http.Request) {
 	AuthFailed(k, r, tykId)
 
 	// Report in health check
-	reportHealthValue(k.Spec, KeyFailure, "1")
+	reportKeyFailure(r, k.Spec, "1")
 }
 
 func (k *JWTMiddleware) processOneToOneTokenMap(r *http.Request, token *jwt.Token) (error, int) {
@@ -667,6 +669,16 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 			return errors.New("Key not authorized: " + jwtErr.Error()), http.StatusUnauthorized
 		}
 
+		if err, code := k.validateClaimRules(r, token.Claims.(jwt.MapClaims)); err != nil {
+			return err, code
+		}
+
+		if k.Spec.CertificateBoundTokens && !jwtCertificateBindingValid(r, token.Claims.(jwt.MapClaims)) {
+			logger.Info("Attempted access with a JWT bound to a different client certificate.")
+			k.reportLoginFailure(tykId, r)
+			return errorAndStatusCode(ErrAuthCertificateMismatch)
+		}
+
 		// Token is valid - let's move on
 
 		// Are we mapping to a central JWT Secret?
@@ -734,7 +746,130 @@ func (k *JWTMiddleware) timeValidateJWTClaims(c jwt.MapClaims) *jwt.ValidationEr
 	return vErr
 }
 
+// validateClaimRules applies the jwt_claim_rules of the API definition to the
+// claims of a token whose signature has already been verified. A missing
+// required claim results in a 401, a claim with an unexpected value in a 403.
+func (k *JWTMiddleware) validateClaimRules(r *http.Request, claims jwt.MapClaims) (error, int) {
+	if len(k.Spec.JWTClaimRules) == 0 {
+		return nil, http.StatusOK
+	}
+
+	path := k.Spec.StripListenPath(r, r.URL.Path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	for _, rule := range k.Spec.JWTClaimRules {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+			continue
+		}
+
+		if rule.Path != "" {
+			if matched, err := regexp.MatchString(rule.Path, path); err != nil || !matched {
+				continue
+			}
+		}
+
+		value, found := nestedClaim(claims, rule.Claim)
+		if !found {
+			if !rule.Required {
+				continue
+			}
+			k.claimRuleFailed(r, rule.Name, "required claim "+rule.Claim+" is missing")
+			return errors.New("Key not authorized: claim rule " + rule.Name + " failed"), http.StatusUnauthorized
+		}
+
+		if !claimMatchesRule(value, rule) {
+			k.claimRuleFailed(r, rule.Name, "claim "+rule.Claim+" has an unexpected value")
+			return errors.New("Key not authorized: claim rule " + rule.Name + " failed"), http.StatusForbidden
+		}
+	}
+
+	return nil, http.StatusOK
+}
+
+func (k *JWTMiddleware) claimRuleFailed(r *http.Request, ruleName, reason string) {
+	k.Logger().WithField("rule", ruleName).Info("JWT claim rule failed: ", reason)
+
+	meta := EventJWTClaimRuleFailureMeta{
+		EventKeyFailureMeta: EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Auth Failure: " + reason, OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+		},
+		Rule: ruleName,
+	}
+	reportAuthFailure(r, func() {
+		k.FireEvent(EventAuthFailure, meta)
+	})
+
+	reportKeyFailure(r, k.Spec, "1")
+}
+
+// nestedClaim looks up a claim by name, falling back to dot notation for
+// nested objects when no top level claim has the full name.
+func nestedClaim(claims map[string]interface{}, name string) (interface{}, bool) {
+	if val, ok := claims[name]; ok {
+		return val, true
+	}
+
+	parts := strings.Split(name, ".")
+	var current interface{} = claims
+	for _, part := range parts {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// claimMatchesRule reports whether the claim value satisfies the value and
+// regex constraints of the rule. For list claims any element may match.
+func claimMatchesRule(value interface{}, rule apidef.JWTClaimRule) bool {
+	var candidates []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			candidates = append(candidates, fmt.Sprint(item))
+		}
+	default:
+		candidates = []string{fmt.Sprint(v)}
+	}
+
+	if len(rule.Values) > 0 {
+		if len(intersection(candidates, rule.Values)) == 0 {
+			return false
+		}
+	}
+
+	if rule.Regex != "" {
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			log.WithError(err).Error("Invalid regex in JWT claim rule ", rule.Name)
+			return false
+		}
+
+		for _, c := range candidates {
+			if re.MatchString(c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
 func ctxSetJWTContextVars(s *APISpec, r *http.Request, token *jwt.Token) {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		ctxSetJWTClaims(r, claims)
+	}
+
 	// Flatten claims and add to context
 	if !s.EnableContextVars {
 		return
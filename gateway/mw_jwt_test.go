@@ -15,6 +15,7 @@ import (
 	"github.com/lonelycode/go-uuid/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -2019,3 +2020,75 @@ func TestJWTExpOverride(t *testing.T) {
 	})
 
 }
+
+func TestJWTClaimRules(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	pID := CreatePolicy()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.EnableJWT = true
+		spec.JWTSigningMethod = RSASign
+		spec.JWTSource = base64.StdEncoding.EncodeToString([]byte(jwtRSAPubKey))
+		spec.JWTIdentityBaseField = "user_id"
+		spec.JWTPolicyFieldName = "policy_id"
+		spec.Proxy.ListenPath = "/"
+		spec.OrgID = "default"
+		spec.JWTClaimRules = []apidef.JWTClaimRule{
+			{Name: "issuer", Claim: "iss", Required: true, Values: []string{"https://idp-1", "https://idp-2"}},
+			{Name: "audience", Claim: "aud", Values: []string{"gateway"}},
+			{Name: "admin-role", Claim: "realm_access.roles", Required: true, Regex: "^admin$", Path: "^/admin"},
+			{Name: "delete-scope", Claim: "scope", Required: true, Method: http.MethodDelete},
+		}
+	})
+
+	token := func(claims jwt.MapClaims) map[string]string {
+		jwtToken := CreateJWKToken(func(t *jwt.Token) {
+			t.Header["kid"] = "12345"
+			t.Claims.(jwt.MapClaims)["user_id"] = "claim-rules-user"
+			t.Claims.(jwt.MapClaims)["policy_id"] = pID
+			t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+			for k, v := range claims {
+				t.Claims.(jwt.MapClaims)[k] = v
+			}
+		})
+		return map[string]string{"authorization": jwtToken}
+	}
+
+	admin := map[string]interface{}{"roles": []string{"user", "admin"}}
+
+	ts.Run(t, []test.TestCase{
+		{Headers: token(jwt.MapClaims{"iss": "https://idp-1"}), Code: http.StatusOK},
+		{Headers: token(jwt.MapClaims{"iss": "https://idp-1", "aud": []string{"other", "gateway"}}), Code: http.StatusOK},
+		{Headers: token(jwt.MapClaims{"iss": "https://idp-1", "aud": "other"}), Code: http.StatusForbidden, BodyMatch: "claim rule audience failed"},
+		{Headers: token(jwt.MapClaims{"iss": "https://evil"}), Code: http.StatusForbidden, BodyMatch: "claim rule issuer failed"},
+		{Headers: token(jwt.MapClaims{}), Code: http.StatusUnauthorized, BodyMatch: "claim rule issuer failed"},
+		{Path: "/admin", Headers: token(jwt.MapClaims{"iss": "https://idp-1"}), Code: http.StatusUnauthorized, BodyMatch: "claim rule admin-role failed"},
+		{Path: "/admin", Headers: token(jwt.MapClaims{"iss": "https://idp-1", "realm_access": map[string]interface{}{"roles": []string{"user"}}}), Code: http.StatusForbidden},
+		{Path: "/admin", Headers: token(jwt.MapClaims{"iss": "https://idp-1", "realm_access": admin}), Code: http.StatusOK},
+		{Method: http.MethodDelete, Headers: token(jwt.MapClaims{"iss": "https://idp-1"}), Code: http.StatusUnauthorized},
+		{Method: http.MethodDelete, Headers: token(jwt.MapClaims{"iss": "https://idp-1", "scope": "delete"}), Code: http.StatusOK},
+	}...)
+}
+
+func TestNestedClaim(t *testing.T) {
+	claims := map[string]interface{}{
+		"https://example.com/tenant": "acme",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"admin"},
+		},
+	}
+
+	val, found := nestedClaim(claims, "https://example.com/tenant")
+	assert.True(t, found)
+	assert.Equal(t, "acme", val)
+
+	val, found = nestedClaim(claims, "realm_access.roles")
+	assert.True(t, found)
+	assert.Equal(t, []interface{}{"admin"}, val)
+
+	_, found = nestedClaim(claims, "realm_access.groups")
+	assert.False(t, found)
+}
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// baseIdentityProvidedBy returns the auth method setting the session of the
+// request. In any-of auth mode the method that authenticated the request
+// provides the identity.
+func (a *APISpec) baseIdentityProvidedBy() apidef.AuthTypeEnum {
+	if a.AuthMode == apidef.AuthModeAny {
+		return apidef.UnsetAuth
+	}
+	return a.BaseIdentityProvidedBy
+}
+
+// authCredentials is implemented by auth middlewares through BaseMiddleware,
+// it is used to find out which credentials a request carries.
+type authCredentials interface {
+	getAuthType() string
+	getAuthToken(authType string, r *http.Request) (string, apidef.AuthConfig)
+}
+
+// MultiAuthMiddleware authenticates requests with the first of several auth
+// methods that accepts them. It is used instead of chaining the auth
+// middlewares when the API auth mode is "any".
+type MultiAuthMiddleware struct {
+	BaseMiddleware
+	Methods []TykMiddleware
+
+	confs []interface{}
+}
+
+func (m *MultiAuthMiddleware) Name() string {
+	return "MultiAuthMiddleware"
+}
+
+func (m *MultiAuthMiddleware) EnabledForSpec() bool {
+	return m.Spec.AuthMode == apidef.AuthModeAny && len(m.Methods) > 0
+}
+
+func (m *MultiAuthMiddleware) Init() {
+	m.confs = make([]interface{}, len(m.Methods))
+	for i, mw := range m.Methods {
+		mw.Init()
+		mw.SetName(mw.Name())
+
+		conf, err := mw.Config()
+		if err != nil {
+			m.Logger().WithError(err).Errorf("Configuration load failed for %s", mw.Name())
+		}
+		m.confs[i] = conf
+	}
+}
+
+// credentialsScore tells how likely the credentials of r are meant for mw: 0
+// when they are absent, 1 when they may be and 2 when their format is
+// specific to mw. Methods which credentials can't be inspected always get 1.
+func credentialsScore(mw TykMiddleware, r *http.Request) int {
+	a, ok := mw.(authCredentials)
+	if !ok {
+		return 1
+	}
+
+	authType := a.getAuthType()
+	switch authType {
+	case authTokenType, basicType, hmacType, jwtType, oauthType, oidcType:
+	default:
+		return 1
+	}
+
+	token, _ := a.getAuthToken(authType, r)
+	scheme := ""
+	if i := strings.IndexByte(token, ' '); i > 0 {
+		scheme = strings.ToLower(token[:i])
+	}
+	isJWT := strings.Count(stripBearer(token), ".") == 2
+
+	switch authType {
+	case basicType:
+		if scheme == "basic" {
+			return 2
+		}
+		if mw.Base().Spec.BasicAuth.ExtractFromBody {
+			return 1
+		}
+		return 0
+	case hmacType:
+		if scheme == "signature" {
+			return 2
+		}
+		return 0
+	case jwtType:
+		if isJWT {
+			return 2
+		}
+		return 0
+	}
+
+	if token == "" || scheme == "basic" || scheme == "signature" {
+		return 0
+	}
+	return 1
+}
+
+func (m *MultiAuthMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	candidates := make([]int, 0, len(m.Methods))
+	scores := make([]int, len(m.Methods))
+	for i, mw := range m.Methods {
+		if scores[i] = credentialsScore(mw, r); scores[i] > 0 {
+			candidates = append(candidates, i)
+		}
+	}
+
+	// Without credentials for any method the first one reports what is
+	// missing.
+	if len(candidates) == 0 {
+		candidates = append(candidates, 0)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i]] > scores[candidates[j]]
+	})
+
+	// The auth failures of the methods tried are only reported when none of
+	// them accepts the request.
+	var failures []func()
+	ctxSetAuthFailures(r, &failures)
+	defer func() {
+		ctxSetAuthFailures(r, nil)
+		for _, report := range failures {
+			report()
+		}
+	}()
+
+	var (
+		firstErr    error
+		firstCode   int
+		firstHeader http.Header
+	)
+	for _, i := range candidates {
+		mw := m.Methods[i]
+		mw.SetRequestLogger(r)
+
+		aw := &authResponseWriter{ResponseWriter: w, header: http.Header{}}
+		err, code := mw.ProcessRequest(aw, r, m.confs[i])
+		if err == nil || aw.wrote {
+			if !aw.wrote {
+				aw.copyHeader()
+			}
+			if err == nil {
+				failures = nil
+			}
+			m.Logger().WithField("method", mw.Name()).Debug("Request authenticated")
+			return err, code
+		}
+
+		m.Logger().WithError(err).WithField("method", mw.Name()).Debug("Auth method rejected the request")
+		if firstErr == nil {
+			firstErr, firstCode, firstHeader = err, code, aw.header
+		}
+	}
+
+	mergeHeader(w.Header(), firstHeader)
+	return firstErr, firstCode
+}
+
+func mergeHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// authResponseWriter keeps the headers set by an auth method apart, so the
+// headers of the methods that rejected a request don't leak to the response.
+type authResponseWriter struct {
+	http.ResponseWriter
+	header http.Header
+	wrote  bool
+}
+
+func (w *authResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *authResponseWriter) copyHeader() {
+	mergeHeader(w.ResponseWriter.Header(), w.header)
+}
+
+func (w *authResponseWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		w.copyHeader()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *authResponseWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestMultiAuthAnyMode(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	buildAPI := func(mode apidef.AuthModeEnum) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "multi-auth"
+			spec.Name = "multi-auth"
+			spec.UseKeylessAccess = false
+			spec.UseStandardAuth = true
+			spec.UseBasicAuth = true
+			spec.EnableJWT = true
+			spec.JWTSigningMethod = HMACSign
+			spec.AuthMode = mode
+			spec.Proxy.ListenPath = "/"
+		})
+	}
+	buildAPI(apidef.AuthModeAny)
+
+	key := CreateSession()
+
+	jwtKID := testKey(t.Name(), "token")
+	GlobalSessionManager.UpdateSession(jwtKID, createJWTSession(), 60, false)
+	jwtToken := createJWKTokenHMAC(func(t *jwt.Token) {
+		t.Header["kid"] = jwtKID
+		t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+	})
+
+	basicSession := CreateStandardSession()
+	basicSession.BasicAuthData.Password = "password"
+	basicSession.AccessRights = map[string]user.AccessDefinition{"multi-auth": {APIID: "multi-auth", Versions: []string{"v1"}}}
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/defaultuser", Data: basicSession, AdminAuth: true, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": key}, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": "Bearer " + jwtToken}, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": genAuthHeader("user", "password")}, Code: http.StatusOK,
+			HeadersNotMatch: map[string]string{"WWW-Authenticate": `Basic realm="multi-auth"`}},
+		{Path: "/", Code: http.StatusUnauthorized, BodyMatch: "Authorization field missing"},
+		{Path: "/", Headers: map[string]string{"Authorization": genAuthHeader("user", "wrong")}, Code: http.StatusUnauthorized,
+			HeadersMatch: map[string]string{"WWW-Authenticate": `Basic realm="multi-auth"`}},
+		{Path: "/", Headers: map[string]string{"Authorization": "unknown-key"}, Code: http.StatusForbidden},
+	}...)
+
+	t.Run("failures reported only when every method rejects", func(t *testing.T) {
+		buildAPI(apidef.AuthModeAny)
+
+		var failures int32
+		getApiSpec("multi-auth").EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+			EventAuthFailure: {&testEventHandler{func(config.EventMessage) {
+				atomic.AddInt32(&failures, 1)
+			}}},
+		}
+
+		// looks like a JWT, so the JWT method rejects it before the key is tried
+		jwtLikeKey := "multi.auth.key"
+		GlobalSessionManager.UpdateSession(jwtLikeKey, CreateStandardSession(), 60, false)
+
+		ts.Run(t, test.TestCase{Path: "/", Headers: map[string]string{"Authorization": jwtLikeKey}, Code: http.StatusOK})
+		time.Sleep(50 * time.Millisecond)
+		if n := atomic.LoadInt32(&failures); n != 0 {
+			t.Error("Expected no auth failure events, got:", n)
+		}
+
+		ts.Run(t, test.TestCase{Path: "/", Headers: map[string]string{"Authorization": "unknown.jwt.key"}, Code: http.StatusForbidden})
+		time.Sleep(50 * time.Millisecond)
+		if n := atomic.LoadInt32(&failures); n != 2 {
+			t.Error("Expected an auth failure event per method, got:", n)
+		}
+	})
+
+	t.Run("identity of the method used", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.UseKeylessAccess = false
+			spec.UseStandardAuth = true
+			spec.EnableJWT = true
+			spec.JWTSigningMethod = HMACSign
+			spec.BaseIdentityProvidedBy = apidef.JWTClaim
+			spec.AuthMode = apidef.AuthModeAny
+			spec.Proxy.ListenPath = "/"
+		})
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Headers: map[string]string{"Authorization": key}, Code: http.StatusOK},
+			{Path: "/", Headers: map[string]string{"Authorization": jwtToken}, Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("all mode requires every method", func(t *testing.T) {
+		buildAPI(apidef.AuthModeAll)
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Headers: map[string]string{"Authorization": key}, Code: http.StatusBadRequest},
+			{Path: "/", Headers: map[string]string{"Authorization": "Bearer " + jwtToken}, Code: http.StatusBadRequest},
+		}...)
+	})
+}
@@ -96,11 +96,19 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		// Fire Authfailed Event
 		AuthFailed(k, r, accessToken)
 		// Report in health check
-		reportHealthValue(k.Spec, KeyFailure, "-1")
+		reportKeyFailure(r, k.Spec, "-1")
 
 		return errorAndStatusCode(ErrOAuthKeyNotFound)
 	}
 
+	if !sessionCertificateBindingValid(r, &session) {
+		logger.Warning("Attempted access with a token bound to a different client certificate.")
+		AuthFailed(k, r, accessToken)
+		reportKeyFailure(r, k.Spec, "-1")
+
+		return errorAndStatusCode(ErrAuthCertificateMismatch)
+	}
+
 	// Make sure OAuth-client is still present
 	oauthClientDeletedKey := "oauth-del-" + k.Spec.APIID + session.OauthClientID
 	oauthClientDeleted := false
@@ -124,7 +132,7 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Set session state on context, we will need it later
-	switch k.Spec.BaseIdentityProvidedBy {
+	switch k.Spec.baseIdentityProvidedBy() {
 	case apidef.OAuthKey, apidef.UnsetAuth:
 		ctxSetSession(r, &session, accessToken, false)
 	}
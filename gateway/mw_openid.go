@@ -2,22 +2,29 @@ package gateway
 
 import (
 	"crypto/md5"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	cache "github.com/pmylund/go-cache"
 	"github.com/sirupsen/logrus"
 
 	"github.com/TykTechnologies/openid2go/openid"
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/user"
 )
 
 const OIDPREFIX = "openid"
 
+var oidcUserInfoCache = cache.New(60*time.Second, 5*time.Minute)
+
 type OpenIDMW struct {
 	BaseMiddleware
 	providerConfiguration     *openid.Configuration
@@ -38,6 +45,7 @@ func (k *OpenIDMW) Init() {
 	// Create an OpenID Configuration and store
 	var err error
 	k.providerConfiguration, err = openid.NewConfiguration(openid.ProvidersGetter(k.getProviders),
+		openid.TokenValidator(&oidcTokenValidator{mw: k}),
 		openid.ErrorHandler(k.dummyErrorHandler))
 
 	if err != nil {
@@ -138,8 +146,26 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 		return errors.New("Key not authorised"), http.StatusUnauthorized
 	}
 
+	claims := token.Claims.(jwt.MapClaims)
+	if err := k.validateClaims(r, claims); err != nil {
+		logger.WithError(err).Error("OpenID claim validation failed")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
+
 	policyID := ""
 	clientID := ""
+	if azp, ok := claims["azp"].(string); ok && k.Spec.OpenIDOptions.ValidateAuthorizedParty {
+		// The authorized party is the client the token was issued to, prefer it
+		// over the first matching audience.
+		k.lock.RLock()
+		_, foundPolicy := clientSet[azp]
+		k.lock.RUnlock()
+		if foundPolicy {
+			clients = azp
+		}
+	}
+
 	switch v := clients.(type) {
 	case string:
 		k.lock.RLock()
@@ -227,8 +253,16 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 		return errors.New("Key not authorized: could not apply new policy"), http.StatusForbidden
 	}
 
+	if k.Spec.OpenIDOptions.UserInfo.Enabled {
+		if err := k.mergeUserInfo(r, iss.(string), ouser.ID, sessionID, &session); err != nil {
+			logger.WithError(err).Error("Could not fetch OpenID userinfo")
+			k.reportLoginFailure(sessionID, r)
+			return errors.New("Key not authorised"), http.StatusUnauthorized
+		}
+	}
+
 	// 4. Set session state on context, we will need it later
-	switch k.Spec.BaseIdentityProvidedBy {
+	switch k.Spec.baseIdentityProvidedBy() {
 	case apidef.OIDCUser, apidef.UnsetAuth:
 		ctxSetSession(r, &session, sessionID, true)
 	}
@@ -246,5 +280,132 @@ func (k *OpenIDMW) reportLoginFailure(tykId string, r *http.Request) {
 	AuthFailed(k, r, tykId)
 
 	// Report in health check
-	reportHealthValue(k.Spec, KeyFailure, "1")
+	reportKeyFailure(r, k.Spec, "1")
+}
+
+// validateClaims checks the "azp", "nonce" and "acr" claims of a token whose
+// signature, issuer and audience have already been validated.
+func (k *OpenIDMW) validateClaims(r *http.Request, claims jwt.MapClaims) error {
+	opts := k.Spec.OpenIDOptions
+
+	if opts.ValidateAuthorizedParty {
+		azp, hasAZP := claims["azp"].(string)
+		if len(claimToStringSlice(claims["aud"])) > 1 && !hasAZP {
+			return errors.New("token has multiple audiences but no authorized party")
+		}
+
+		if hasAZP {
+			iss, _ := claims["iss"].(string)
+			k.lock.RLock()
+			_, known := k.provider_client_policymap[iss][azp]
+			k.lock.RUnlock()
+			if !known {
+				return fmt.Errorf("authorized party %q is not a configured client", azp)
+			}
+		}
+	}
+
+	if opts.NonceHeaderName != "" {
+		nonce, _ := claims["nonce"].(string)
+		expected := r.Header.Get(opts.NonceHeaderName)
+		if nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(expected)) != 1 {
+			return errors.New("token nonce does not match")
+		}
+	}
+
+	if len(opts.ACRValues) > 0 {
+		acr, _ := claims["acr"].(string)
+		if !contains(opts.ACRValues, acr) {
+			return fmt.Errorf("authentication context class %q is not accepted", acr)
+		}
+	}
+
+	return nil
+}
+
+// mergeUserInfo queries the provider's userinfo endpoint and copies the
+// configured claims into the session meta data, so they can be injected into
+// upstream headers via $tyk_meta.
+func (k *OpenIDMW) mergeUserInfo(r *http.Request, iss, sub, sessionID string, session *user.SessionState) error {
+	conf := k.Spec.OpenIDOptions.UserInfo
+
+	// The userinfo endpoint expects an access token, the ID token used to
+	// authenticate the request can't be sent in its place.
+	if conf.AccessTokenHeaderName == "" {
+		return errors.New("no access token header configured for userinfo request")
+	}
+
+	accessToken := stripBearer(r.Header.Get(conf.AccessTokenHeaderName))
+	if accessToken == "" {
+		return errors.New("no access token found for userinfo request")
+	}
+
+	cacheKey := sessionID + fmt.Sprintf("%x", md5.Sum([]byte(accessToken)))
+	var info map[string]interface{}
+	if cached, found := oidcUserInfoCache.Get(cacheKey); found {
+		info = cached.(map[string]interface{})
+	} else {
+		meta, err := getOIDCProviderMetadata(iss)
+		if err != nil {
+			return err
+		}
+
+		if meta.UserInfoEndpoint == "" {
+			return errors.New("provider does not advertise a userinfo endpoint")
+		}
+
+		info, err = fetchOIDCUserInfo(meta.UserInfoEndpoint, accessToken)
+		if err != nil {
+			return err
+		}
+
+		// The sub claim of the userinfo response must match the ID token.
+		if infoSub, _ := info["sub"].(string); infoSub != sub {
+			return errors.New("userinfo subject does not match token subject")
+		}
+
+		ttl := cache.DefaultExpiration
+		if conf.CacheTTL > 0 {
+			ttl = time.Duration(conf.CacheTTL) * time.Second
+		}
+		oidcUserInfoCache.Set(cacheKey, info, ttl)
+	}
+
+	if session.MetaData == nil {
+		session.SetMetaData(map[string]interface{}{})
+	}
+
+	for _, claim := range conf.Claims {
+		if val, ok := info[claim]; ok {
+			session.SetMetaDataKey(claim, val)
+		}
+	}
+
+	return nil
+}
+
+func fetchOIDCUserInfo(endpoint, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(headers.Authorization, "Bearer "+accessToken)
+	req.Header.Set(headers.Accept, headers.ApplicationJSON)
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned status %d", resp.StatusCode)
+	}
+
+	var info map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
 }
@@ -0,0 +1,284 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+type testOIDCProvider struct {
+	*httptest.Server
+	ecKey *ecdsa.PrivateKey
+	edKey ed25519.PrivateKey
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testOIDCProvider{ecKey: ecKey, edKey: edKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcWellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProviderMetadata{
+			Issuer:                           p.URL,
+			JWKSURI:                          p.URL + "/jwks",
+			UserInfoEndpoint:                 p.URL + "/userinfo",
+			IDTokenSigningAlgValuesSupported: []string{"ES256", "EdDSA"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &ecKey.PublicKey, KeyID: "ec", Algorithm: "ES256", Use: "sig"},
+			{Key: edPub, KeyID: "ed", Algorithm: "EdDSA", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":   "user1",
+			"email": "user1@example.com",
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+func (p *testOIDCProvider) token(method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	std := jwt.MapClaims{
+		"iss": p.URL,
+		"sub": "user1",
+		"aud": "client1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		std[k] = v
+	}
+
+	token := jwt.NewWithClaims(method, std)
+	token.Header[KID] = kid
+
+	var key interface{} = p.ecKey
+	if method == SigningMethodEdDSA {
+		key = p.edKey
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func TestOpenIDMW(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	provider := newTestOIDCProvider(t)
+	defer provider.Close()
+
+	policyID := CreatePolicy()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.UseOpenID = true
+		spec.OrgID = "default"
+		spec.Proxy.ListenPath = "/"
+		spec.OpenIDOptions = apidef.OpenIDOptions{
+			Providers: []apidef.OIDProviderConfig{{
+				Issuer: provider.URL,
+				ClientIDs: map[string]string{
+					base64.StdEncoding.EncodeToString([]byte("client1")): policyID,
+					base64.StdEncoding.EncodeToString([]byte("client2")): policyID,
+				},
+			}},
+			ValidateAuthorizedParty: true,
+			NonceHeaderName:         "X-Nonce",
+			ACRValues:               []string{"urn:mace:incommon:iap:silver"},
+			UserInfo: apidef.OIDUserInfoConfig{
+				Enabled:               true,
+				Claims:                []string{"email"},
+				AccessTokenHeaderName: "X-Access-Token",
+			},
+		}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.GlobalHeaders = map[string]string{"X-User-Email": "$tyk_meta.email"}
+		})
+	})
+
+	valid := jwt.MapClaims{
+		"nonce": "n-1",
+		"acr":   "urn:mace:incommon:iap:silver",
+	}
+	headersFor := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token, "X-Nonce": "n-1", "X-Access-Token": "access-1"}
+	}
+
+	withClaims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	t.Run("ES256", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers:   headersFor(provider.token(jwt.SigningMethodES256, "ec", valid)),
+			Code:      http.StatusOK,
+			BodyMatch: `"X-User-Email":"user1@example.com"`,
+		})
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(SigningMethodEdDSA, "ed", valid)),
+			Code:    http.StatusOK,
+		})
+	})
+
+	t.Run("Unknown audience", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "ec", withClaims(jwt.MapClaims{"aud": "other"}))),
+			Code:    http.StatusUnauthorized,
+		})
+	})
+
+	t.Run("Multiple audiences without azp", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "ec", withClaims(jwt.MapClaims{"aud": []string{"client1", "client2"}}))),
+			Code:    http.StatusUnauthorized,
+		})
+	})
+
+	t.Run("Multiple audiences with azp", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "ec", withClaims(jwt.MapClaims{
+				"aud": []string{"client1", "client2"},
+				"azp": "client2",
+			}))),
+			Code: http.StatusOK,
+		})
+	})
+
+	t.Run("Missing userinfo access token", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: map[string]string{
+				"Authorization": "Bearer " + provider.token(jwt.SigningMethodES256, "ec", valid),
+				"X-Nonce":       "n-1",
+			},
+			Code: http.StatusUnauthorized,
+		})
+	})
+
+	t.Run("Nonce mismatch", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "ec", withClaims(jwt.MapClaims{"nonce": "n-2"}))),
+			Code:    http.StatusUnauthorized,
+		})
+	})
+
+	t.Run("ACR not accepted", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "ec", withClaims(jwt.MapClaims{"acr": "0"}))),
+			Code:    http.StatusUnauthorized,
+		})
+	})
+
+	t.Run("Unknown kid", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Headers: headersFor(provider.token(jwt.SigningMethodES256, "missing", valid)),
+			Code:    http.StatusUnauthorized,
+		})
+	})
+}
+
+func TestSigningMethodEdDSA(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	sig, err := SigningMethodEdDSA.Sign("payload", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SigningMethodEdDSA.Verify("payload", sig, pub); err != nil {
+		t.Error("Expected valid signature, got:", err)
+	}
+
+	if err := SigningMethodEdDSA.Verify("tampered", sig, pub); err != jwt.ErrSignatureInvalid {
+		t.Error("Expected invalid signature, got:", err)
+	}
+
+	if _, err := SigningMethodEdDSA.Sign("payload", &user.SessionState{}); err != jwt.ErrInvalidKeyType {
+		t.Error("Expected invalid key type, got:", err)
+	}
+}
+
+func TestGetOIDCSigningKey_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer srv.Close()
+
+	meta := &oidcProviderMetadata{JWKSURI: srv.URL}
+	if _, err := getOIDCSigningKey(meta, "", false); err == nil {
+		t.Fatal("Expected error for non-2xx JWKS response")
+	}
+
+	if _, found := oidcJWKSCache.Get(meta.JWKSURI); found {
+		t.Error("Error response should not be cached")
+	}
+}
+
+func TestGetOIDCSigningKey_UnknownKidRefreshLimit(t *testing.T) {
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer srv.Close()
+
+	meta := &oidcProviderMetadata{JWKSURI: srv.URL}
+	defer oidcJWKSCache.Delete(meta.JWKSURI)
+	defer oidcJWKSRefreshes.Delete(meta.JWKSURI)
+
+	for i := 0; i < 5; i++ {
+		if _, err := getOIDCSigningKey(meta, fmt.Sprintf("random-%d", i), false); err == nil {
+			t.Fatal("Expected error for unknown kid")
+		}
+	}
+
+	// One fetch to populate the cache, one forced refresh for the first unknown kid.
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", got)
+	}
+}
@@ -40,6 +40,7 @@ func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(r *http.Request, token s
 
 	// Report in health check
 	reportHealthValue(k.Spec, Throttle, "-1")
+	prometheusMetrics.rejected(k.Spec, "rate_limit")
 
 	return errors.New("Rate limit exceeded"), http.StatusTooManyRequests
 }
@@ -57,6 +58,7 @@ func (k *RateLimitAndQuotaCheck) handleQuotaFailure(r *http.Request, token strin
 
 	// Report in health check
 	reportHealthValue(k.Spec, QuotaViolation, "-1")
+	prometheusMetrics.rejected(k.Spec, "quota")
 
 	return errors.New("Quota exceeded"), http.StatusForbidden
 }
@@ -75,7 +77,7 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 	session := ctxGetSession(r)
 	token := ctxGetAuthToken(r)
 
-	storeRef := GlobalSessionManager.Store()
+	storeRef := limiterStore(r)
 	reason := sessionLimiter.ForwardMessage(
 		r,
 		session,
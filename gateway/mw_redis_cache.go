@@ -3,6 +3,7 @@ package gateway
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
@@ -11,8 +12,10 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/sync/singleflight"
@@ -28,6 +31,12 @@ import (
 const (
 	upstreamCacheHeader    = "x-tyk-cache-action-set"
 	upstreamCacheTTLHeader = "x-tyk-cache-action-set-ttl"
+
+	cacheStatusHit   = "HIT"
+	cacheStatusMiss  = "MISS"
+	cacheStatusStale = "STALE"
+	// the expired entry was confirmed by the upstream with a 304
+	cacheStatusRevalidated = "REVALIDATED"
 )
 
 // RedisCacheMiddleware is a caching middleware that will pull data from Redis instead of the upstream proxy
@@ -36,6 +45,8 @@ type RedisCacheMiddleware struct {
 	CacheStore   storage.Handler
 	sh           SuccessHandler
 	singleFlight singleflight.Group
+	revalidating sync.Map
+	l1           *responseCacheL1
 }
 
 func (m *RedisCacheMiddleware) Name() string {
@@ -44,6 +55,7 @@ func (m *RedisCacheMiddleware) Name() string {
 
 func (m *RedisCacheMiddleware) Init() {
 	m.sh = SuccessHandler{m.BaseMiddleware}
+	m.l1 = getResponseCacheL1()
 }
 
 func (m *RedisCacheMiddleware) EnabledForSpec() bool {
@@ -148,25 +160,42 @@ func (m *RedisCacheMiddleware) isTimeStampExpired(timestamp string) bool {
 	return false
 }
 
+// secondsSince returns the number of seconds elapsed since a unix timestamp.
+func (m *RedisCacheMiddleware) secondsSince(timestamp string) int64 {
+	i, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Now().Unix() - i
+}
+
 func (m *RedisCacheMiddleware) encodePayload(payload, timestamp string) string {
 	sEnc := base64.StdEncoding.EncodeToString([]byte(payload))
-	return sEnc + "|" + timestamp
+	return sEnc + "|" + timestamp + "|" + strconv.FormatInt(time.Now().Unix(), 10)
 }
 
-func (m *RedisCacheMiddleware) decodePayload(payload string) (string, string, error) {
+// decodePayload returns the cached response, its expiry timestamp and the
+// time it was stored at. Entries written by older versions have no creation
+// time.
+func (m *RedisCacheMiddleware) decodePayload(payload string) (string, string, string, error) {
 	data := strings.Split(payload, "|")
 	switch len(data) {
 	case 1:
-		return data[0], "", nil
-	case 2:
+		return data[0], "", "", nil
+	case 2, 3:
 		sDec, err := base64.StdEncoding.DecodeString(data[0])
 		if err != nil {
-			return "", "", err
+			return "", "", "", err
+		}
+
+		created := ""
+		if len(data) == 3 {
+			created = data[2]
 		}
 
-		return string(sDec), data[1], nil
+		return string(sDec), data[1], created, nil
 	}
-	return "", "", errors.New("Decoding failed, array length wrong")
+	return "", "", "", errors.New("Decoding failed, array length wrong")
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
@@ -205,16 +234,19 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 
 	var errCreatingChecksum bool
 	var retBlob string
+	var l1Entry *l1CacheEntry
 	key, err := m.CreateCheckSum(r, token, cacheKeyRegex, m.getCacheKeyFromHeaders(r))
+	// entryKey is where the response is stored, it differs from key when the
+	// response varies on request headers
+	entryKey := key
 	if err != nil {
 		log.Debug("Error creating checksum. Skipping cache check")
 		errCreatingChecksum = true
+	} else if entry, ok := m.l1.get(key); ok {
+		// fresh in the node local tier, no need to go to Redis
+		l1Entry = entry
 	} else {
-		v, sfErr, _ := m.singleFlight.Do(key, func() (interface{}, error) {
-			return m.CacheStore.GetKey(key)
-		})
-		retBlob = v.(string)
-		err = sfErr
+		entryKey, retBlob, err = m.lookup(key, r.Header)
 	}
 
 	if err != nil {
@@ -222,104 +254,78 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 			log.Debug("Cache enabled, but record not found")
 		}
 		// Pass through to proxy AND CACHE RESULT
-
-		var resVal *http.Response
-		if isVirtual {
-			log.Debug("This is a virtual function")
-			vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
-			vp.Init()
-			resVal = vp.ServeHTTPForCache(w, r, nil)
-		} else {
-			// This passes through and will write the value to the writer, but spit out a copy for the cache
-			log.Debug("Not virtual, passing")
-			if newURL := ctxGetURLRewriteTarget(r); newURL != nil {
-				r.URL = newURL
-				ctxSetURLRewriteTarget(r, nil)
-			}
-			if newMethod := ctxGetTransformRequestMethod(r); newMethod != "" {
-				r.Method = newMethod
-				ctxSetTransformRequestMethod(r, "")
-			}
-			sr := m.sh.ServeHTTPWithCache(w, r)
-			resVal = sr.Response
-		}
-
-		cacheThisRequest := true
-		cacheTTL := m.Spec.CacheOptions.CacheTimeout
-
+		path := r.URL.Path
+		m.setCacheStatus(w, cacheStatusMiss)
+		resVal := m.fetch(w, r, isVirtual)
 		if resVal == nil {
 			log.Warning("Upstream request must have failed, response is empty")
 			return nil, mwStatusRespond
 		}
 
-		cacheOnlyResponseCodes := m.Spec.CacheOptions.CacheOnlyResponseCodes
-		// override api main CacheOnlyResponseCodes by endpoint specific if provided
-		if cacheMeta != nil && len(cacheMeta.CacheOnlyResponseCodes) > 0 {
-			cacheOnlyResponseCodes = cacheMeta.CacheOnlyResponseCodes
-		}
-
-		// make sure the status codes match if specified
-		if len(cacheOnlyResponseCodes) > 0 {
-			foundCode := false
-			for _, code := range cacheOnlyResponseCodes {
-				if code == resVal.StatusCode {
-					foundCode = true
-					break
-				}
-			}
-			cacheThisRequest = foundCode
+		if !errCreatingChecksum {
+			m.store(key, path, r.Header, resVal, cacheMeta)
 		}
 
-		// Are we using upstream cache control?
-		if m.Spec.CacheOptions.EnableUpstreamCacheControl {
-			log.Debug("Upstream control enabled")
-			// Do we cache?
-			if resVal.Header.Get(upstreamCacheHeader) == "" {
-				log.Warning("Upstream cache action not found, not caching")
-				cacheThisRequest = false
-			}
-
-			cacheTTLHeader := upstreamCacheTTLHeader
-			if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
-				cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
-			}
+		return nil, mwStatusRespond
+	}
 
-			ttl := resVal.Header.Get(cacheTTLHeader)
-			if ttl != "" {
-				log.Debug("TTL Set upstream")
-				cacheAsInt, err := strconv.Atoi(ttl)
-				if err != nil {
-					log.Error("Failed to decode TTL cache value: ", err)
-					cacheTTL = m.Spec.CacheOptions.CacheTimeout
-				} else {
-					cacheTTL = int64(cacheAsInt)
-				}
-			}
+	var cachedData, timestamp, created string
+	if l1Entry != nil {
+		cachedData, timestamp, created = l1Entry.data, l1Entry.expires, l1Entry.created
+	} else {
+		cachedData, timestamp, created, err = m.decodePayload(retBlob)
+		if err != nil {
+			// Tere was an issue with this cache entry - lets remove it:
+			m.CacheStore.DeleteKey(entryKey)
+			return nil, http.StatusOK
 		}
 
-		if cacheThisRequest && !errCreatingChecksum {
-			log.Debug("Caching request to redis")
-			var wireFormatReq bytes.Buffer
-			resVal.Write(&wireFormatReq)
-			log.Debug("Cache TTL is:", cacheTTL)
-			ts := m.getTimeTTL(cacheTTL)
-			toStore := m.encodePayload(wireFormatReq.String(), ts)
-			go m.CacheStore.SetKey(key, toStore, cacheTTL)
+		if len(cachedData) == 0 {
+			m.CacheStore.DeleteKey(entryKey)
+			return nil, http.StatusOK
 		}
-
-		return nil, mwStatusRespond
-	}
-
-	cachedData, timestamp, err := m.decodePayload(retBlob)
-	if err != nil {
-		// Tere was an issue with this cache entry - lets remove it:
-		m.CacheStore.DeleteKey(key)
-		return nil, http.StatusOK
 	}
 
-	if m.isTimeStampExpired(timestamp) || len(cachedData) == 0 {
-		m.CacheStore.DeleteKey(key)
-		return nil, http.StatusOK
+	cacheStatus := cacheStatusHit
+	if m.isTimeStampExpired(timestamp) {
+		staleFor := m.secondsSince(timestamp)
+		opts := m.Spec.CacheOptions
+
+		switch {
+		case opts.StaleWhileRevalidate > 0 && staleFor <= opts.StaleWhileRevalidate && !isBodyHashRequired(r):
+			// serve the stale copy right away, the next request will get
+			// the refreshed one
+			m.revalidate(r, key, entryKey, cachedData, isVirtual, cacheMeta)
+			cacheStatus = cacheStatusStale
+		case opts.StaleIfError > 0 && staleFor <= opts.StaleIfError:
+			// only fall back to the stale copy if the upstream fails, so the
+			// response is buffered instead of being written to the client
+			renewed, rec, resVal := m.refresh(r, key, cachedData, isVirtual, cacheMeta)
+			switch {
+			case renewed != "":
+				cachedData, created = renewed, ""
+				cacheStatus = cacheStatusRevalidated
+			case resVal != nil && resVal.StatusCode < http.StatusInternalServerError:
+				m.writeRecorded(w, rec)
+				return nil, mwStatusRespond
+			default:
+				log.Warning("Upstream request failed, serving stale cache entry")
+				cacheStatus = cacheStatusStale
+			}
+		case !isVirtual && hasCachedValidators(cachedData):
+			// ask the upstream whether the cached copy is still valid
+			renewed, rec, _ := m.refresh(r, key, cachedData, isVirtual, cacheMeta)
+			if renewed == "" {
+				m.writeRecorded(w, rec)
+				return nil, mwStatusRespond
+			}
+			cachedData, created = renewed, ""
+			cacheStatus = cacheStatusRevalidated
+		default:
+			m.CacheStore.DeleteKey(entryKey)
+			m.setCacheStatus(w, cacheStatusMiss)
+			return nil, http.StatusOK
+		}
 	}
 
 	log.Debug("Cache got: ", cachedData)
@@ -330,6 +336,21 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	}
 	nopCloseResponseBody(newRes)
 
+	// only fresh entries are kept in memory, stale ones are left to Redis so
+	// that revalidation keeps working
+	if l1Entry == nil && cacheStatus == cacheStatusHit && entryKey == key {
+		m.l1.set(&l1CacheEntry{
+			key:       key,
+			apiID:     m.Spec.APIID,
+			path:      r.URL.Path,
+			component: token,
+			tags:      strings.Fields(newRes.Header.Get(m.surrogateKeyHeader())),
+			data:      cachedData,
+			expires:   timestamp,
+			created:   created,
+		})
+	}
+
 	defer newRes.Body.Close()
 	for _, h := range hopHeaders {
 		newRes.Header.Del(h)
@@ -346,13 +367,13 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		w.Header().Set(headers.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
 	}
 	w.Header().Set("x-tyk-cached-response", "1")
+	m.setCacheStatus(w, cacheStatus)
+	if created != "" {
+		w.Header().Set(headers.Age, strconv.FormatInt(m.secondsSince(created), 10))
+	}
 
-	if reqEtag := r.Header.Get("If-None-Match"); reqEtag != "" {
-		if respEtag := newRes.Header.Get("Etag"); respEtag != "" {
-			if strings.Contains(reqEtag, respEtag) {
-				newRes.StatusCode = http.StatusNotModified
-			}
-		}
+	if notModified(r, newRes) {
+		newRes.StatusCode = http.StatusNotModified
 	}
 
 	w.WriteHeader(newRes.StatusCode)
@@ -369,6 +390,267 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	return nil, mwStatusRespond
 }
 
+// lookup returns the cache entry of a request and the key it was found at,
+// following the Vary header list stored for responses that have variants.
+func (m *RedisCacheMiddleware) lookup(key string, h http.Header) (string, string, error) {
+	blob, err := m.getEntry(key)
+	if err != nil || !strings.HasPrefix(blob, cacheVaryPrefix) {
+		return key, blob, err
+	}
+
+	names := strings.Split(strings.TrimPrefix(blob, cacheVaryPrefix), ",")
+	entryKey := varyCacheKey(key, names, h)
+	blob, err = m.getEntry(entryKey)
+	return entryKey, blob, err
+}
+
+func (m *RedisCacheMiddleware) getEntry(key string) (string, error) {
+	v, err, _ := m.singleFlight.Do(key, func() (interface{}, error) {
+		return m.CacheStore.GetKey(key)
+	})
+	return v.(string), err
+}
+
+// fetch passes the request to the upstream (or the virtual endpoint) and
+// writes the response to w, returning a copy of it for the cache.
+func (m *RedisCacheMiddleware) fetch(w http.ResponseWriter, r *http.Request, isVirtual bool) *http.Response {
+	if isVirtual {
+		log.Debug("This is a virtual function")
+		vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
+		vp.Init()
+		return vp.ServeHTTPForCache(w, r, nil)
+	}
+
+	// This passes through and will write the value to the writer, but spit out a copy for the cache
+	log.Debug("Not virtual, passing")
+	if newURL := ctxGetURLRewriteTarget(r); newURL != nil {
+		r.URL = newURL
+		ctxSetURLRewriteTarget(r, nil)
+	}
+	if newMethod := ctxGetTransformRequestMethod(r); newMethod != "" {
+		r.Method = newMethod
+		ctxSetTransformRequestMethod(r, "")
+	}
+	sr := m.sh.ServeHTTPWithCache(w, r)
+	return sr.Response
+}
+
+// store writes resVal to the cache if the API and endpoint settings allow it.
+// The entry is indexed by the request path for targeted invalidation. If the
+// response varies on request headers, the variant for reqHeader is stored.
+func (m *RedisCacheMiddleware) store(key, path string, reqHeader http.Header, resVal *http.Response, cacheMeta *EndPointCacheMeta) {
+	// a 304 only confirms what the client already has
+	if resVal.StatusCode == http.StatusNotModified {
+		return
+	}
+
+	vary := varyHeaders(resVal.Header)
+	if contains(vary, "*") {
+		log.Debug("Response varies on everything, not caching")
+		return
+	}
+
+	cacheThisRequest := true
+	cacheTTL := m.Spec.CacheOptions.CacheTimeout
+
+	cacheOnlyResponseCodes := m.Spec.CacheOptions.CacheOnlyResponseCodes
+	// override api main CacheOnlyResponseCodes by endpoint specific if provided
+	if cacheMeta != nil && len(cacheMeta.CacheOnlyResponseCodes) > 0 {
+		cacheOnlyResponseCodes = cacheMeta.CacheOnlyResponseCodes
+	}
+
+	// make sure the status codes match if specified
+	if len(cacheOnlyResponseCodes) > 0 {
+		foundCode := false
+		for _, code := range cacheOnlyResponseCodes {
+			if code == resVal.StatusCode {
+				foundCode = true
+				break
+			}
+		}
+		cacheThisRequest = foundCode
+	}
+
+	// Are we using upstream cache control?
+	if m.Spec.CacheOptions.EnableUpstreamCacheControl {
+		log.Debug("Upstream control enabled")
+		// Do we cache?
+		if resVal.Header.Get(upstreamCacheHeader) == "" {
+			log.Warning("Upstream cache action not found, not caching")
+			cacheThisRequest = false
+		}
+
+		cacheTTLHeader := upstreamCacheTTLHeader
+		if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
+			cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
+		}
+
+		ttl := resVal.Header.Get(cacheTTLHeader)
+		if ttl != "" {
+			log.Debug("TTL Set upstream")
+			cacheAsInt, err := strconv.Atoi(ttl)
+			if err != nil {
+				log.Error("Failed to decode TTL cache value: ", err)
+				cacheTTL = m.Spec.CacheOptions.CacheTimeout
+			} else {
+				cacheTTL = int64(cacheAsInt)
+			}
+		}
+	}
+
+	if !cacheThisRequest {
+		return
+	}
+
+	log.Debug("Caching request to redis")
+	var wireFormatReq bytes.Buffer
+	resVal.Write(&wireFormatReq)
+	log.Debug("Cache TTL is:", cacheTTL)
+	ts := m.getTimeTTL(cacheTTL)
+	toStore := m.encodePayload(wireFormatReq.String(), ts)
+
+	// keep the entry around for as long as it may be served stale. Entries
+	// with validators are kept for another cache timeout, so that they can be
+	// revalidated with a conditional request instead of fetched again.
+	staleTTL := m.staleWindow()
+	if hasValidators(resVal.Header) && staleTTL < cacheTTL {
+		staleTTL = cacheTTL
+	}
+	storeTTL := cacheTTL + staleTTL
+	entryKey := key
+	if len(vary) > 0 {
+		entryKey = varyCacheKey(key, vary, reqHeader)
+	}
+	go func() {
+		indexCacheEntry(m.CacheStore, entryKey, path, resVal.Header, m.surrogateKeyHeader(), storeTTL)
+		if entryKey != key {
+			m.CacheStore.SetKey(key, cacheVaryPrefix+strings.Join(vary, ","), storeTTL)
+		}
+		m.CacheStore.SetKey(entryKey, toStore, storeTTL)
+	}()
+}
+
+func (m *RedisCacheMiddleware) surrogateKeyHeader() string {
+	if m.Spec.CacheOptions.SurrogateKeyHeader != "" {
+		return m.Spec.CacheOptions.SurrogateKeyHeader
+	}
+	return defaultSurrogateKeyHeader
+}
+
+// staleWindow is the longest time an expired entry may still be served.
+func (m *RedisCacheMiddleware) staleWindow() int64 {
+	opts := m.Spec.CacheOptions
+	if opts.StaleIfError > opts.StaleWhileRevalidate {
+		return opts.StaleIfError
+	}
+	return opts.StaleWhileRevalidate
+}
+
+// revalidate refreshes a cache entry in the background. Only one refresh per
+// entry runs at a time.
+func (m *RedisCacheMiddleware) revalidate(r *http.Request, key, entryKey, cachedData string, isVirtual bool, cacheMeta *EndPointCacheMeta) {
+	if _, inFlight := m.revalidating.LoadOrStore(entryKey, struct{}{}); inFlight {
+		return
+	}
+
+	// the request is cloned before the client request finishes and its
+	// context gets cancelled
+	bgReq := r.Clone(detachedContext{r.Context()})
+	ctxSetDoNotTrack(bgReq, true)
+
+	go func() {
+		defer m.revalidating.Delete(entryKey)
+
+		if _, _, resVal := m.refresh(bgReq, key, cachedData, isVirtual, cacheMeta); resVal == nil || resVal.StatusCode >= http.StatusInternalServerError {
+			log.Warning("Failed to revalidate stale cache entry")
+		}
+	}()
+}
+
+// refresh fetches a new copy of an expired cache entry and stores it. If the
+// cached response has validators the upstream request is made conditional,
+// and a 304 answer renews the cached copy, which is returned. Otherwise the
+// upstream response is buffered in the returned recorder.
+func (m *RedisCacheMiddleware) refresh(r *http.Request, key, cachedData string, isVirtual bool, cacheMeta *EndPointCacheMeta) (string, *httptest.ResponseRecorder, *http.Response) {
+	path := r.URL.Path
+	reqHeader := r.Header
+
+	cached, err := http.ReadResponse(bufio.NewReader(strings.NewReader(cachedData)), r)
+	conditional := err == nil && !isVirtual && hasValidators(cached.Header)
+	if conditional {
+		// the client's own conditions are evaluated against the response
+		// served to it, not sent upstream
+		r = r.Clone(r.Context())
+		r.Header.Del(headers.IfNoneMatch)
+		r.Header.Del(headers.IfModifiedSince)
+		if etag := cached.Header.Get(headers.ETag); etag != "" {
+			r.Header.Set(headers.IfNoneMatch, etag)
+		}
+		if lastModified := cached.Header.Get(headers.LastModified); lastModified != "" {
+			r.Header.Set(headers.IfModifiedSince, lastModified)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	resVal := m.fetch(rec, r, isVirtual)
+	if resVal == nil || resVal.StatusCode >= http.StatusInternalServerError {
+		return "", rec, resVal
+	}
+
+	if !conditional || resVal.StatusCode != http.StatusNotModified {
+		m.store(key, path, reqHeader, resVal, cacheMeta)
+		return "", rec, resVal
+	}
+
+	// the stored headers are updated with the ones of the 304
+	for name, values := range resVal.Header {
+		if name != headers.ContentLength {
+			cached.Header[name] = values
+		}
+	}
+
+	var wireFormat bytes.Buffer
+	cached.Write(&wireFormat)
+	renewed := wireFormat.String()
+
+	if res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(renewed)), nil); err == nil {
+		m.store(key, path, reqHeader, res, cacheMeta)
+	}
+
+	return renewed, nil, resVal
+}
+
+// hasCachedValidators reports whether a cached response has an ETag or a
+// Last-Modified date it can be revalidated with.
+func hasCachedValidators(cachedData string) bool {
+	res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(cachedData)), nil)
+	return err == nil && hasValidators(res.Header)
+}
+
+// setCacheStatus reports how the response was served from the cache.
+func (m *RedisCacheMiddleware) setCacheStatus(w http.ResponseWriter, status string) {
+	w.Header().Set(headers.XTykCacheStatus, status)
+	prometheusMetrics.cacheStatus(m.Spec, status)
+}
+
+// writeRecorded writes an upstream response buffered by refresh.
+func (m *RedisCacheMiddleware) writeRecorded(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	copyHeader(w.Header(), rec.Header(), config.Global().IgnoreCanonicalMIMEHeaderKey)
+	m.setCacheStatus(w, cacheStatusMiss)
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+// detachedContext keeps the values of a request context, but is never
+// cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
 func isSafeMethod(method string) bool {
 	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
 }
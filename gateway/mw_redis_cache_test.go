@@ -5,11 +5,15 @@ import (
 	"encoding/hex"
 	"hash"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/test"
 )
@@ -151,3 +155,231 @@ func Test_addBodyHash(t *testing.T) {
 		})
 	}
 }
+
+// expireCacheEntries rewinds the expiry of all cache entries of an API, so
+// that they are considered stale without having to wait for them.
+func expireCacheEntries(t *testing.T, apiID string) {
+	m := RedisCacheMiddleware{}
+	store := storage.RedisCluster{KeyPrefix: "cache-" + apiID, IsCache: true}
+
+	// entries are stored in the background
+	for i := 0; i < 50; i++ {
+		expired := 0
+		for key, payload := range store.GetKeysAndValues() {
+			if strings.Contains(key, cacheIndexPaths) || strings.Contains(key, cacheIndexSurrogate) || strings.HasPrefix(payload, cacheVaryPrefix) {
+				continue
+			}
+			data, _, _, err := m.decodePayload(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.SetKey(key, m.encodePayload(data, m.getTimeTTL(-1)), 60)
+			expired++
+		}
+		if expired > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No cache entries to expire")
+}
+
+func TestRedisCacheMiddleware_Stale(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var body atomic.Value
+	var failing int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer upstream.Close()
+
+	createAPI := func(opts apidef.CacheOptions) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+			spec.CacheOptions = opts
+			spec.CacheOptions.EnableCache = true
+			spec.CacheOptions.CacheAllSafeRequests = true
+			spec.CacheOptions.CacheTimeout = 60
+		})
+		cacheStore := storage.RedisCluster{KeyPrefix: "cache-test", IsCache: true}
+		cacheStore.DeleteAllKeys()
+	}
+
+	status := func(s string) map[string]string {
+		return map[string]string{headers.XTykCacheStatus: s}
+	}
+
+	t.Run("Age header", func(t *testing.T) {
+		createAPI(apidef.CacheOptions{})
+		body.Store("v1")
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/age", Code: http.StatusOK, BodyMatch: "v1", HeadersMatch: status(cacheStatusMiss)},
+			{Path: "/age", Code: http.StatusOK, BodyMatch: "v1", HeadersMatch: map[string]string{
+				headers.XTykCacheStatus: cacheStatusHit,
+				headers.Age:             "0",
+			}},
+		}...)
+	})
+
+	t.Run("Expired without stale options", func(t *testing.T) {
+		createAPI(apidef.CacheOptions{})
+		body.Store("v1")
+
+		ts.Run(t, test.TestCase{Path: "/expired", BodyMatch: "v1", HeadersMatch: status(cacheStatusMiss)})
+		expireCacheEntries(t, "test")
+		body.Store("v2")
+		ts.Run(t, test.TestCase{Path: "/expired", BodyMatch: "v2", HeadersMatch: status(cacheStatusMiss)})
+	})
+
+	t.Run("Stale while revalidate", func(t *testing.T) {
+		createAPI(apidef.CacheOptions{StaleWhileRevalidate: 30})
+		body.Store("v1")
+
+		ts.Run(t, test.TestCase{Path: "/swr", BodyMatch: "v1", HeadersMatch: status(cacheStatusMiss)})
+		expireCacheEntries(t, "test")
+		body.Store("v2")
+		ts.Run(t, test.TestCase{Path: "/swr", BodyMatch: "v1", HeadersMatch: status(cacheStatusStale)})
+
+		// wait for the background refresh
+		for i := 0; i < 50; i++ {
+			resp, _ := ts.Run(t, test.TestCase{Path: "/swr"})
+			if resp.Header.Get(headers.XTykCacheStatus) == cacheStatusHit {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		ts.Run(t, test.TestCase{Path: "/swr", BodyMatch: "v2", HeadersMatch: status(cacheStatusHit)})
+	})
+
+	t.Run("Stale if error", func(t *testing.T) {
+		createAPI(apidef.CacheOptions{StaleIfError: 30})
+		body.Store("v1")
+
+		ts.Run(t, test.TestCase{Path: "/sie", BodyMatch: "v1", HeadersMatch: status(cacheStatusMiss)})
+		expireCacheEntries(t, "test")
+
+		atomic.StoreInt32(&failing, 1)
+		ts.Run(t, test.TestCase{Path: "/sie", Code: http.StatusOK, BodyMatch: "v1", HeadersMatch: status(cacheStatusStale)})
+
+		atomic.StoreInt32(&failing, 0)
+		body.Store("v3")
+		ts.Run(t, test.TestCase{Path: "/sie", Code: http.StatusOK, BodyMatch: "v3", HeadersMatch: status(cacheStatusMiss)})
+	})
+}
+
+func TestRedisCacheMiddleware_Conditional(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	var fullResponses, notModified int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.Vary, "Accept-Language")
+		w.Header().Set(headers.ETag, `"v1-`+r.Header.Get("Accept-Language")+`"`)
+		w.Header().Set(headers.LastModified, lastModified)
+		if r.Header.Get(headers.IfNoneMatch) != "" {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		w.Write([]byte("lang=" + r.Header.Get("Accept-Language")))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CacheOptions.EnableCache = true
+		spec.CacheOptions.CacheAllSafeRequests = true
+		spec.CacheOptions.CacheTimeout = 60
+	})
+	cacheStore := storage.RedisCluster{KeyPrefix: "cache-test", IsCache: true}
+	cacheStore.DeleteAllKeys()
+
+	status := func(s string) map[string]string {
+		return map[string]string{headers.XTykCacheStatus: s}
+	}
+	en := map[string]string{"Accept-Language": "en"}
+	fr := map[string]string{"Accept-Language": "fr"}
+
+	// wait for both variants to be stored
+	for _, lang := range []map[string]string{en, fr} {
+		for i := 0; i < 50; i++ {
+			resp, _ := ts.Run(t, test.TestCase{Path: "/vary", Headers: lang})
+			if resp.Header.Get(headers.XTykCacheStatus) == cacheStatusHit {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("Vary", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Path: "/vary", Headers: en, BodyMatch: "lang=en", HeadersMatch: status(cacheStatusHit)},
+			{Path: "/vary", Headers: fr, BodyMatch: "lang=fr", HeadersMatch: status(cacheStatusHit)},
+		}...)
+	})
+
+	t.Run("Conditional requests", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Path: "/vary", Headers: map[string]string{"Accept-Language": "en", "If-None-Match": `W/"v1-en"`}, Code: http.StatusNotModified},
+			{Path: "/vary", Headers: map[string]string{"Accept-Language": "en", "If-None-Match": `"v1-fr"`}, Code: http.StatusOK},
+			{Path: "/vary", Headers: map[string]string{"Accept-Language": "en", "If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)}, Code: http.StatusNotModified},
+			{Path: "/vary", Headers: map[string]string{"Accept-Language": "en", "If-Modified-Since": time.Now().Add(-2 * time.Hour).UTC().Format(http.TimeFormat)}, Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("Revalidation", func(t *testing.T) {
+		expireCacheEntries(t, "test")
+
+		full := atomic.LoadInt32(&fullResponses)
+		ts.Run(t, test.TestCase{Path: "/vary", Headers: en, BodyMatch: "lang=en", HeadersMatch: status(cacheStatusRevalidated)})
+
+		if atomic.LoadInt32(&notModified) != 1 || atomic.LoadInt32(&fullResponses) != full {
+			t.Error("Expected the expired entry to be revalidated with a conditional request")
+		}
+	})
+}
+
+func Test_notModified(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	res.Header.Set(headers.ETag, `"a"`)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost} {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set(headers.IfNoneMatch, `"a"`)
+		if got, want := notModified(r, res), method != http.MethodPost; got != want {
+			t.Errorf("%s: expected %v, got %v", method, want, got)
+		}
+	}
+}
+
+func Test_etagMatches(t *testing.T) {
+	tests := []struct {
+		list, etag string
+		want       bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`*`, `"a"`, true},
+		{`"ab"`, `"a"`, false},
+		{`"a"`, ``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.list, tt.etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.list, tt.etag, got, tt.want)
+		}
+	}
+}
@@ -20,6 +20,10 @@ func (t *TrackEndpointMiddleware) EnabledForSpec() bool {
 		return false
 	}
 
+	if t.Spec.AnalyticsSampling.Enabled {
+		return true
+	}
+
 	for _, version := range t.Spec.VersionData.Versions {
 		if len(version.ExtendedPaths.TrackEndpoints) > 0 || len(version.ExtendedPaths.DoNotTrackEndpoints) > 0 {
 			return true
@@ -33,8 +37,18 @@ func (t *TrackEndpointMiddleware) EnabledForSpec() bool {
 func (t *TrackEndpointMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 	_, versionPaths, _, _ := t.Spec.Version(r)
 	foundTracked, metaTrack := t.Spec.CheckSpecMatchesStatus(r, versionPaths, RequestTracked)
+	rate := t.Spec.AnalyticsSampling.Rate
 	if foundTracked {
-		ctxSetTrackedPath(r, metaTrack.(*apidef.TrackEndpointMeta).Path)
+		meta := metaTrack.(*apidef.TrackEndpointMeta)
+		ctxSetTrackedPath(r, meta.Path)
+		if meta.SampleRate > 0 {
+			rate = meta.SampleRate
+		}
+	}
+
+	// head-based sampling, the decision is made before the request is proxied
+	if t.Spec.AnalyticsSampling.Enabled {
+		ctxSetAnalyticsSample(r, newAnalyticsSample(rate))
 	}
 
 	foundDnTrack, _ := t.Spec.CheckSpecMatchesStatus(r, versionPaths, RequestNotTracked)
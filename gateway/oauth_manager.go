@@ -389,6 +389,12 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 	}
 	var username string
 
+	// a token that is not bound could be replayed without the certificate
+	if o.API.CertificateBoundTokens && requestCertThumbprint(r) == "" {
+		resp.SetError(osin.E_INVALID_REQUEST, "A client certificate is required to request a token")
+		return resp
+	}
+
 	if ar := o.OsinServer.HandleAccessRequest(resp, r); ar != nil {
 
 		var session *user.SessionState
@@ -451,6 +457,12 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 		log.Debug("[OAuth] Finishing access request ")
 		o.OsinServer.FinishAccessRequest(resp, r, ar)
 		new_token, foundNewToken := resp.Output["access_token"]
+		if o.API.CertificateBoundTokens && foundNewToken && !resp.IsError {
+			if !o.bindAccessToken(resp, r) {
+				return resp
+			}
+		}
+
 		if username != "" && foundNewToken {
 			log.Debug("Updating token data in key")
 			if session.OauthKeys == nil {
@@ -494,6 +506,26 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 	return resp
 }
 
+// bindAccessToken binds the access token issued in resp to the client
+// certificate of the request. The tokens are revoked and resp turned into an
+// error when the binding fails.
+func (o *OAuthManager) bindAccessToken(resp *osin.Response, r *http.Request) bool {
+	token, _ := resp.Output["access_token"].(string)
+	expiresIn, _ := resp.Output["expires_in"].(int32)
+	err := bindTokenToCertificate(r, o.API.OrgID, token, int64(expiresIn))
+	if err == nil {
+		return true
+	}
+
+	log.WithError(err).Error("Could not bind access token to client certificate")
+	o.OsinServer.Storage.RemoveAccess(token)
+	if refresh, ok := resp.Output["refresh_token"].(string); ok {
+		o.OsinServer.Storage.RemoveRefresh(refresh)
+	}
+	resp.SetError(osin.E_SERVER_ERROR, "")
+	return false
+}
+
 // These enums fix the prefix to use when storing various OAuth keys and data, since we
 // delegate everything to the osin framework
 const (
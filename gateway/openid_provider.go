@@ -0,0 +1,284 @@
+package gateway
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	cache "github.com/pmylund/go-cache"
+	jose "github.com/square/go-jose"
+)
+
+const oidcWellKnownPath = "/.well-known/openid-configuration"
+
+var (
+	oidcMetadataCache = cache.New(time.Hour, 5*time.Minute)
+	oidcJWKSCache     = cache.New(240*time.Second, 30*time.Second)
+	oidcHTTPClient    = &http.Client{Timeout: 10 * time.Second}
+
+	// oidcJWKSRefreshes records the JWKS URIs refetched because of an unknown
+	// kid, so that tokens with random kids cannot make every request call out
+	// to the provider.
+	oidcJWKSRefreshes = cache.New(oidcJWKSRefreshInterval, time.Minute)
+)
+
+// oidcJWKSRefreshInterval is the minimum time between two forced refetches of
+// the same JWK set.
+const oidcJWKSRefreshInterval = 30 * time.Second
+
+// defaultOIDCSigningAlgorithms is used when neither the API definition nor the
+// provider metadata restrict the accepted algorithms. Symmetric algorithms are
+// never accepted as the gateway only knows the provider's public keys.
+var defaultOIDCSigningAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// SigningMethodEd25519 implements the EdDSA signing method from RFC 8037.
+type SigningMethodEd25519 struct{}
+
+// SigningMethodEdDSA is registered with jwt-go under the "EdDSA" alg name.
+var SigningMethodEdDSA = &SigningMethodEd25519{}
+
+func (m *SigningMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+func (m *SigningMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+func (m *SigningMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+// oidcProviderMetadata is the subset of the discovery document served at
+// /.well-known/openid-configuration that the gateway relies on.
+type oidcProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// normaliseIssuer applies the workaround for tokens issued by google, which
+// use an issuer without a scheme.
+func normaliseIssuer(iss string) string {
+	if iss == "accounts.google.com" {
+		return "https://" + iss
+	}
+	return iss
+}
+
+func getOIDCProviderMetadata(issuer string) (*oidcProviderMetadata, error) {
+	issuer = normaliseIssuer(issuer)
+	if cached, found := oidcMetadataCache.Get(issuer); found {
+		return cached.(*oidcProviderMetadata), nil
+	}
+
+	resp, err := oidcHTTPClient.Get(strings.TrimSuffix(issuer, "/") + oidcWellKnownPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery endpoint returned status %d", resp.StatusCode)
+	}
+
+	var meta oidcProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, err
+	}
+
+	if normaliseIssuer(meta.Issuer) != issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", meta.Issuer, issuer)
+	}
+
+	if meta.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+
+	oidcMetadataCache.Set(issuer, &meta, cache.DefaultExpiration)
+	return &meta, nil
+}
+
+func getOIDCSigningKey(meta *oidcProviderMetadata, kid string, refresh bool) (interface{}, error) {
+	var jwkSet *jose.JSONWebKeySet
+
+	cached, found := oidcJWKSCache.Get(meta.JWKSURI)
+	if found && !refresh {
+		jwkSet = cached.(*jose.JSONWebKeySet)
+	} else {
+		resp, err := oidcHTTPClient.Get(meta.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+		}
+
+		buf, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if jwkSet, err = parseJWK(buf); err != nil {
+			return nil, err
+		}
+
+		oidcJWKSCache.Set(meta.JWKSURI, jwkSet, cache.DefaultExpiration)
+	}
+
+	if kid == "" {
+		for _, key := range jwkSet.Keys {
+			if key.Use == "" || key.Use == "sig" {
+				return key.Key, nil
+			}
+		}
+		return nil, errors.New("no signing keys found in provider JWK set")
+	}
+
+	if keys := jwkSet.Key(kid); len(keys) > 0 {
+		return keys[0].Key, nil
+	}
+
+	if !refresh && oidcJWKSRefreshes.Add(meta.JWKSURI, true, cache.DefaultExpiration) == nil {
+		// The provider may have rotated its keys since we cached them.
+		return getOIDCSigningKey(meta, kid, true)
+	}
+
+	return nil, fmt.Errorf("no key with kid %q found in provider JWK set", kid)
+}
+
+// oidcTokenValidator validates ID tokens against the providers configured for
+// an API, using the provider's discovery document and JWK set.
+type oidcTokenValidator struct {
+	mw *OpenIDMW
+}
+
+func (v *oidcTokenValidator) Validate(raw string) (*jwt.Token, error) {
+	opts := v.mw.Spec.OpenIDOptions
+
+	validMethods := opts.AllowedSigningAlgorithms
+	if len(validMethods) == 0 {
+		validMethods = defaultOIDCSigningAlgorithms
+	}
+
+	parser := &jwt.Parser{ValidMethods: validMethods}
+
+	return parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		claims := token.Claims.(jwt.MapClaims)
+
+		iss, _ := claims["iss"].(string)
+		if iss == "" {
+			return nil, errors.New("token has no issuer")
+		}
+
+		clientIDs, err := v.clientIDsForIssuer(iss)
+		if err != nil {
+			return nil, err
+		}
+
+		if !audienceMatches(claims["aud"], clientIDs) {
+			return nil, errors.New("token audience does not match any configured client")
+		}
+
+		if sub, _ := claims["sub"].(string); sub == "" {
+			return nil, errors.New("token has no subject")
+		}
+
+		meta, err := getOIDCProviderMetadata(iss)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(opts.AllowedSigningAlgorithms) == 0 && len(meta.IDTokenSigningAlgValuesSupported) > 0 {
+			if !contains(meta.IDTokenSigningAlgValuesSupported, token.Method.Alg()) {
+				return nil, fmt.Errorf("signing algorithm %s is not supported by the provider", token.Method.Alg())
+			}
+		}
+
+		kid, _ := token.Header[KID].(string)
+		return getOIDCSigningKey(meta, kid, false)
+	})
+}
+
+func (v *oidcTokenValidator) clientIDsForIssuer(iss string) ([]string, error) {
+	providers, err := v.mw.getProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range providers {
+		if p.Issuer == iss || p.Issuer == normaliseIssuer(iss) {
+			return p.ClientIDs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no provider was registered with issuer: %v", iss)
+}
+
+// audienceMatches reports whether the "aud" claim, either a string or a list of
+// strings, contains at least one of the given client IDs.
+func audienceMatches(aud interface{}, clientIDs []string) bool {
+	for _, a := range claimToStringSlice(aud) {
+		if contains(clientIDs, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func claimToStringSlice(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, val := range v {
+			if s, ok := val.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
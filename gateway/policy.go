@@ -5,7 +5,6 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
-	"os"
 
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 
@@ -54,17 +53,25 @@ func (d *DBPolicy) ToRegularPolicy() user.Policy {
 }
 
 func LoadPoliciesFromFile(filePath string) map[string]user.Policy {
-	f, err := os.Open(filePath)
+	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "policy",
 		}).Error("Couldn't open policy file: ", err)
 		return nil
 	}
-	defer f.Close()
+	data, refs, err := expandFileTemplates(data)
+	setKVRefs(kvRefOwnerPolicyFile, refs)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "policy",
+			"file":   filePath,
+		}).Error("Couldn't expand policy templates: ", err)
+		return nil
+	}
 
 	var policies map[string]user.Policy
-	if err := json.NewDecoder(f).Decode(&policies); err != nil {
+	if err := json.Unmarshal(data, &policies); err != nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "policy",
 		}).Error("Couldn't unmarshal policies: ", err)
@@ -232,6 +232,7 @@ func flushNetworkAnalytics(ctx context.Context) {
 					APIName:      spec.Name,
 					APIID:        spec.APIID,
 					OrgID:        spec.OrgID,
+					SampleWeight: 1,
 				}
 				record.SetExpiry(spec.ExpireAnalyticsAfter)
 				analytics.RecordHit(&record)
@@ -35,6 +35,7 @@ const (
 	NoticeGatewayDRLNotification NotificationCommand = "NoticeGatewayDRLNotification"
 	NoticeGatewayLENotification  NotificationCommand = "NoticeGatewayLENotification"
 	KeySpaceUpdateNotification   NotificationCommand = "KeySpaceUpdateNotification"
+	NoticeCacheInvalidation      NotificationCommand = "CacheInvalidation"
 )
 
 // Notification is a type that encodes a message published to a pub sub channel (shared between implementations)
@@ -52,8 +53,7 @@ func (n *Notification) Sign() {
 }
 
 func startPubSubLoop() {
-	cacheStore := storage.RedisCluster{}
-	cacheStore.Connect()
+	cacheStore := storage.NewPubSub()
 	// On message, synchronise
 	for {
 		err := cacheStore.StartPubSubHandler(RedisPubSubChannel, func(v interface{}) {
@@ -114,6 +114,8 @@ func handleRedisEvent(v interface{}, handled func(NotificationCommand), reloaded
 		reloadURLStructure(reloaded)
 	case KeySpaceUpdateNotification:
 		handleKeySpaceEventCacheFlush(notif.Payload)
+	case NoticeCacheInvalidation:
+		handleCacheInvalidationNotification(notif.Payload)
 	default:
 		pubSubLog.Warnf("Unknown notification command: %q", notif.Command)
 		return
@@ -195,7 +197,7 @@ func isPayloadSignatureValid(notification Notification) bool {
 
 // RedisNotifier will use redis pub/sub channels to send notifications
 type RedisNotifier struct {
-	store   *storage.RedisCluster
+	store   storage.PubSub
 	channel string
 }
 
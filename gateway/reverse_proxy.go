@@ -920,6 +920,7 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		span, ctx := trace.Span(req.Context(), req.URL.Path)
 		defer span.Finish()
 		ext.SpanKindRPCClient.Set(span)
+		setSpanTags(span, p.TykAPISpec, req)
 		req = req.WithContext(ctx)
 	}
 	var roundTripper *TykRoundTripper
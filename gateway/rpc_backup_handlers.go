@@ -34,7 +34,7 @@ func LoadDefinitionsFromRPCBackup() ([]*APISpec, error) {
 	tagList := getTagListAsString()
 	checkKey := BackupApiKeyBase + tagList
 
-	store := storage.RedisCluster{KeyPrefix: RPCKeyPrefix}
+	store := storage.New(RPCKeyPrefix, false, false)
 	connected := store.Connect()
 	log.Info("[RPC] --> Loading API definitions from backup")
 
@@ -64,7 +64,7 @@ func saveRPCDefinitionsBackup(list string) error {
 
 	log.Info("--> Connecting to DB")
 
-	store := storage.RedisCluster{KeyPrefix: RPCKeyPrefix}
+	store := storage.New(RPCKeyPrefix, false, false)
 	connected := store.Connect()
 
 	log.Info("--> Connected to DB")
@@ -87,7 +87,7 @@ func LoadPoliciesFromRPCBackup() (map[string]user.Policy, error) {
 	tagList := getTagListAsString()
 	checkKey := BackupPolicyKeyBase + tagList
 
-	store := storage.RedisCluster{KeyPrefix: RPCKeyPrefix}
+	store := storage.New(RPCKeyPrefix, false, false)
 
 	connected := store.Connect()
 	log.Info("[RPC] Loading Policies from backup")
@@ -124,7 +124,7 @@ func saveRPCPoliciesBackup(list string) error {
 
 	log.Info("--> Connecting to DB")
 
-	store := storage.RedisCluster{KeyPrefix: RPCKeyPrefix}
+	store := storage.New(RPCKeyPrefix, false, false)
 	connected := store.Connect()
 
 	log.Info("--> Connected to DB")
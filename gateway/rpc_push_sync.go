@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/rpc"
+)
+
+const defaultPushSyncTimeout = 30
+
+var errPushSyncUnsupported = errors.New("push sync is not supported by the RPC server")
+
+// StartRPCPushSync keeps a watch call open on the control plane and applies
+// the changes it pushes. The cursor of the last changes is kept so a broken
+// watch resumes where it stopped. It falls back to polling when the control
+// plane doesn't support push sync.
+func (r *RPCStorageHandler) StartRPCPushSync(orgId string) {
+	log.Info("[RPC] Starting push sync")
+
+	cursor := ""
+	for {
+		next, err := r.WatchChanges(orgId, cursor)
+		if err == errPushSyncUnsupported {
+			log.Warning("[RPC] Push sync is not supported by the RPC server, polling for changes")
+			go rpcReloadLoop(orgId)
+			r.StartRPCLoopCheck(orgId)
+			return
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "Cannot obtain response during") {
+				log.WithError(err).Warning("[RPC] Watch for changes failed")
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		cursor = next
+	}
+}
+
+// WatchChanges waits for the changes made after cursor, applies them and
+// returns the cursor to resume from.
+func (r *RPCStorageHandler) WatchChanges(orgId, cursor string) (string, error) {
+	timeout := config.Global().SlaveOptions.PushSyncTimeout
+	if timeout <= 0 {
+		timeout = defaultPushSyncTimeout
+	}
+	req := apidef.WatchRequest{
+		OrgID:   orgId,
+		GroupID: config.Global().SlaveOptions.GroupID,
+		Cursor:  cursor,
+		Timeout: int64(timeout),
+	}
+
+	res, err := rpc.FuncClientSingletonTimeout("Watch", req, time.Duration(timeout)*time.Second+rpc.GlobalRPCCallTimeout)
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown method") {
+			return cursor, errPushSyncUnsupported
+		}
+		rpc.EmitErrorEventKv(
+			rpc.FuncClientSingletonCall,
+			"Watch",
+			err,
+			map[string]string{
+				"orgId":  orgId,
+				"cursor": cursor,
+			},
+		)
+		if r.IsRetriableError(err) {
+			if rpc.Login() {
+				return r.WatchChanges(orgId, cursor)
+			}
+		}
+		return cursor, err
+	}
+
+	changes, ok := res.(*apidef.WatchResponse)
+	if !ok || changes == nil {
+		return cursor, nil
+	}
+	r.applyChanges(changes, orgId)
+	return changes.Cursor, nil
+}
+
+func (r *RPCStorageHandler) applyChanges(changes *apidef.WatchResponse, orgId string) {
+	reload := false
+	if changes.Reset {
+		// The changes since the cursor are lost, drop everything cached
+		// from the control plane.
+		log.Warning("[RPC] Sync cursor expired, flushing cached data")
+		RPCGlobalCache.Flush()
+		SessionCache.Flush()
+		if CertificateManager != nil {
+			CertificateManager.FlushCache()
+		}
+		reload = true
+	}
+
+	var keys []string
+	for _, e := range changes.Events {
+		switch e.Type {
+		case apidef.ChangeAPI, apidef.ChangePolicy:
+			reload = true
+		case apidef.ChangeKey:
+			if !config.Global().SlaveOptions.DisableKeySpaceSync {
+				keys = append(keys, e.Keys...)
+			}
+		case apidef.ChangeCertificate:
+			for _, certID := range e.Keys {
+				RPCGlobalCache.Delete("cert-raw-" + certID)
+			}
+			if CertificateManager != nil {
+				CertificateManager.FlushCache()
+			}
+		default:
+			log.Warning("[RPC] Unknown change type: ", e.Type)
+		}
+	}
+
+	if len(keys) > 0 {
+		log.Info("Keyspace changes pushed, updating local cache")
+		r.ProcessKeySpaceChanges(keys, orgId)
+	}
+	if reload {
+		log.Warning("[RPC STORE] Received Reload instruction!")
+		go MainNotifier.Notify(Notification{Command: NoticeGroupReload})
+	}
+}
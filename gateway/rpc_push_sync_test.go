@@ -0,0 +1,85 @@
+// +build !race
+
+package gateway
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/gorpc"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestRPCPushSync(t *testing.T) {
+	dispatcher := gorpc.NewDispatcher()
+	dispatcher.AddFunc("Login", func(clientAddr, userKey string) bool {
+		return true
+	})
+	dispatcher.AddFunc("GetApiDefinitions", func(clientAddr string, dr *apidef.DefRequest) (string, error) {
+		return "[]", nil
+	})
+	dispatcher.AddFunc("GetPolicies", func(clientAddr string, orgid string) (string, error) {
+		return "[]", nil
+	})
+
+	key := generateToken("test_org", "changed-key")
+	var gotCursor string
+	dispatcher.AddFunc("Watch", func(clientAddr string, req *apidef.WatchRequest) (*apidef.WatchResponse, error) {
+		gotCursor = req.Cursor
+		return &apidef.WatchResponse{
+			Cursor: "2",
+			Events: []apidef.ChangeEvent{
+				{Type: apidef.ChangeKey, Keys: []string{key}},
+				{Type: apidef.ChangeCertificate, Keys: []string{"cert-id"}},
+			},
+		}, nil
+	})
+
+	rpcMock := startRPCMock(dispatcher)
+	defer stopRPCMock(rpcMock)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	RPCGlobalCache.Set("apikey-"+key, "session", 0)
+	RPCGlobalCache.Set("cert-raw-cert-id", "cert", 0)
+
+	store := &RPCStorageHandler{KeyPrefix: "apikey-"}
+	cursor, err := store.WatchChanges("test_org", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCursor != "1" || cursor != "2" {
+		t.Errorf("expected to resume from cursor 1 and get cursor 2, got %q and %q", gotCursor, cursor)
+	}
+	if _, found := RPCGlobalCache.Get("apikey-" + key); found {
+		t.Error("expected the changed key to be removed from the cache")
+	}
+	if _, found := RPCGlobalCache.Get("cert-raw-cert-id"); found {
+		t.Error("expected the changed certificate to be removed from the cache")
+	}
+}
+
+func TestRPCPushSyncUnsupported(t *testing.T) {
+	dispatcher := gorpc.NewDispatcher()
+	dispatcher.AddFunc("Login", func(clientAddr, userKey string) bool {
+		return true
+	})
+	dispatcher.AddFunc("GetApiDefinitions", func(clientAddr string, dr *apidef.DefRequest) (string, error) {
+		return "[]", nil
+	})
+	dispatcher.AddFunc("GetPolicies", func(clientAddr string, orgid string) (string, error) {
+		return "[]", nil
+	})
+
+	rpcMock := startRPCMock(dispatcher)
+	defer stopRPCMock(rpcMock)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	store := &RPCStorageHandler{}
+	if cursor, err := store.WatchChanges("test_org", "1"); err != errPushSyncUnsupported || cursor != "1" {
+		t.Errorf("expected push sync to be unsupported, got %q %v", cursor, err)
+	}
+}
@@ -58,6 +58,9 @@ var (
 		"IncrememntWithExpire": func(ibd *apidef.InboundData) (int64, error) {
 			return 0, nil
 		},
+		"IncrementByWithExpire": func(req *apidef.IncrementRequest) (int64, error) {
+			return 0, nil
+		},
 		"AppendToSet": func(ibd *apidef.InboundData) error {
 			return nil
 		},
@@ -82,6 +85,9 @@ var (
 		"GetGroupKeySpaceUpdate": func(clientAddr string, groupData *apidef.GroupKeySpaceRequest) ([]string, error) {
 			return nil, nil
 		},
+		"Watch": func(req *apidef.WatchRequest) (*apidef.WatchResponse, error) {
+			return nil, nil
+		},
 		"Ping": func() bool {
 			return false
 		},
@@ -114,6 +120,20 @@ func (r *RPCStorageHandler) Connect() bool {
 		RPCPoolSize:           slaveOptions.RPCPoolSize,
 	}
 
+	rpc.SetConnectionStateCallback(func(connected bool) {
+		meta := EventRPCConnectionMeta{ConnectionString: slaveOptions.ConnectionString}
+		if connected {
+			meta.Message = "RPC connection restored"
+			FireSystemEvent(EventRPCConnectionRestored, meta)
+			if slaveOptions.WriteBack.Enabled {
+				replayRPCWriteBack()
+			}
+			return
+		}
+		meta.Message = "RPC connection lost, entering emergency mode"
+		FireSystemEvent(EventRPCConnectionLost, meta)
+	})
+
 	return rpc.Connect(
 		rpcConfig,
 		r.SuppressRegister,
@@ -166,6 +186,12 @@ func (r *RPCStorageHandler) GetKey(keyName string) (string, error) {
 }
 
 func (r *RPCStorageHandler) GetRawKey(keyName string) (string, error) {
+	if r.writeBackMode() {
+		if value, err := writeBackLog().GetRawKey(keyName); err == nil {
+			return value, nil
+		}
+	}
+
 	// Check the cache first
 	if config.Global().SlaveOptions.EnableRPCCache {
 		log.Debug("Using cache for: ", keyName)
@@ -247,6 +273,10 @@ func (r *RPCStorageHandler) SetExp(keyName string, timeout int64) error {
 
 // SetKey will create (or update) a key value in the store
 func (r *RPCStorageHandler) SetKey(keyName, session string, timeout int64) error {
+	if r.writeBackMode() {
+		return r.writeBackSetKey(keyName, session, timeout)
+	}
+
 	start := time.Now() // get current time
 	ibd := apidef.InboundData{
 		KeyName:      r.fixKey(keyName),
@@ -272,6 +302,10 @@ func (r *RPCStorageHandler) SetKey(keyName, session string, timeout int64) error
 			}
 		}
 
+		if r.writeBackMode() {
+			return r.writeBackSetKey(keyName, session, timeout)
+		}
+
 		log.Debug("Error trying to set value:", err)
 		return err
 	}
@@ -310,6 +344,9 @@ func (r *RPCStorageHandler) Decrement(keyName string) {
 
 // IncrementWithExpire will increment a key in redis
 func (r *RPCStorageHandler) IncrememntWithExpire(keyName string, expire int64) int64 {
+	if r.writeBackMode() {
+		return r.writeBackIncrement(keyName, expire)
+	}
 
 	ibd := apidef.InboundData{
 		KeyName: keyName,
@@ -333,6 +370,10 @@ func (r *RPCStorageHandler) IncrememntWithExpire(keyName string, expire int64) i
 		}
 	}
 
+	if err != nil && r.writeBackMode() {
+		return r.writeBackIncrement(keyName, expire)
+	}
+
 	if val == nil {
 		log.Warning("RPC increment returned nil value, returning 0")
 		return 0
@@ -412,6 +453,9 @@ func (r *RPCStorageHandler) GetKeysAndValues() map[string]string {
 
 // DeleteKey will remove a key from the database
 func (r *RPCStorageHandler) DeleteKey(keyName string) bool {
+	if r.writeBackMode() {
+		return r.writeBackDeleteKey(keyName)
+	}
 
 	log.Debug("DEL Key was: ", keyName)
 	log.Debug("DEL Key became: ", r.fixKey(keyName))
@@ -432,6 +476,10 @@ func (r *RPCStorageHandler) DeleteKey(keyName string) bool {
 				return r.DeleteKey(keyName)
 			}
 		}
+
+		if r.writeBackMode() {
+			return r.writeBackDeleteKey(keyName)
+		}
 	}
 
 	return ok == true
@@ -923,6 +971,11 @@ func (r *RPCStorageHandler) RemoveFromList(keyName, value string) error {
 	return nil
 }
 
+func (r *RPCStorageHandler) TrimList(keyName string, from, to int64) error {
+	log.Error("Not implemented")
+	return nil
+}
+
 func (r *RPCStorageHandler) GetListRange(keyName string, from, to int64) ([]string, error) {
 	log.Error("Not implemented")
 	return nil, nil
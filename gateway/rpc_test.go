@@ -425,6 +425,7 @@ func TestOrgSessionWithRPCDown(t *testing.T) {
 		globalConf.SlaveOptions.APIKey = ""
 		globalConf.Policies.PolicySource = ""
 		config.SetGlobal(globalConf)
+		rpc.Reset()
 	}()
 
 	ts := StartTest()
@@ -0,0 +1,284 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/rpc"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// The write-back log is kept in the local Redis while the RPC connection is
+// down. It only grows with the number of keys changed, not with the traffic:
+// rpcWriteBackLogKey is the set of the sessions changed, each holding its last
+// change under rpcWriteBackEntryPrefix, and rpcWriteBackCountersKey is the set
+// of the counters incremented, the local counters holding the sum of the
+// increments.
+const (
+	rpcWriteBackLogKey      = "rpc-write-back-log"
+	rpcWriteBackEntryPrefix = "rpc-write-back-entry-"
+	rpcWriteBackCountersKey = "rpc-write-back-counters"
+)
+
+const (
+	writeBackSet       = "set"
+	writeBackDelete    = "delete"
+	writeBackIncrement = "increment"
+)
+
+// writeBackEntry is a change made locally in emergency mode. The key prefix
+// and hashing of the handler are kept so the change can be replayed through
+// the right store.
+type writeBackEntry struct {
+	Op        string `json:"op"`
+	KeyPrefix string `json:"key_prefix"`
+	HashKeys  bool   `json:"hash_keys"`
+	KeyName   string `json:"key_name"`
+	Value     string `json:"value,omitempty"`
+	Timeout   int64  `json:"timeout,omitempty"`
+	Expire    int64  `json:"expire,omitempty"`
+	Time      int64  `json:"time"`
+}
+
+var writeBackMu sync.Mutex
+
+func writeBackLog() storage.Handler {
+	return storage.New("", false, false)
+}
+
+// writeBackMode reports whether the writes of r go to the local Redis
+// instead of the control plane.
+func (r *RPCStorageHandler) writeBackMode() bool {
+	return config.Global().SlaveOptions.WriteBack.Enabled && rpc.IsEmergencyMode()
+}
+
+// localStore returns the local Redis store holding the same keys as r, it is
+// also the store the gateway looks up sessions in before asking RPC.
+func (r *RPCStorageHandler) localStore() storage.Handler {
+	return storage.New(r.KeyPrefix, r.HashKeys, false)
+}
+
+func (r *RPCStorageHandler) logWriteBack(e writeBackEntry) {
+	e.KeyPrefix = r.KeyPrefix
+	e.HashKeys = r.HashKeys
+	if e.Op != writeBackIncrement {
+		e.Time = time.Now().Unix()
+	}
+	appendWriteBack(e)
+}
+
+func (r *RPCStorageHandler) writeBackSetKey(keyName, session string, timeout int64) error {
+	log.Debug("RPC is down, writing key locally: ", obfuscateKey(keyName))
+	if err := r.localStore().SetKey(keyName, session, timeout); err != nil {
+		return err
+	}
+	r.logWriteBack(writeBackEntry{Op: writeBackSet, KeyName: keyName, Value: session, Timeout: timeout})
+	return nil
+}
+
+func (r *RPCStorageHandler) writeBackDeleteKey(keyName string) bool {
+	log.Debug("RPC is down, deleting key locally: ", obfuscateKey(keyName))
+	r.localStore().DeleteKey(keyName)
+	r.logWriteBack(writeBackEntry{Op: writeBackDelete, KeyName: keyName})
+	return true
+}
+
+// writeBackIncrement increments a local counter. The returned value only
+// counts the increments made since the connection was lost, the counter is
+// cleared once they are replayed.
+func (r *RPCStorageHandler) writeBackIncrement(keyName string, expire int64) int64 {
+	val := writeBackLog().IncrememntWithExpire(keyName, expire)
+	if val == 1 {
+		// the counter was just created, later increments only add to it
+		r.logWriteBack(writeBackEntry{Op: writeBackIncrement, KeyName: keyName, Expire: expire})
+	}
+	return val
+}
+
+// replayRPCWriteBack sends the changes logged in emergency mode to the
+// control plane. Counters are replayed as the sum of their increments, for
+// sessions only the last change of each key is kept and conflicts with the
+// copy of the control plane are settled by the configured conflict
+// resolution rule. Changes that can't be replayed stay in the log.
+func replayRPCWriteBack() {
+	writeBackMu.Lock()
+	defer writeBackMu.Unlock()
+
+	store := writeBackLog()
+	sessions, _ := store.GetSet(rpcWriteBackLogKey)
+	counters, _ := store.GetSet(rpcWriteBackCountersKey)
+	if len(sessions) == 0 && len(counters) == 0 {
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"sessions": len(sessions),
+		"counters": len(counters),
+	}).Info("Replaying RPC write-back log")
+
+	rule := config.Global().SlaveOptions.WriteBack.ConflictResolution
+	for _, id := range sessions {
+		data, err := store.GetRawKey(rpcWriteBackEntryPrefix + id)
+		if err != nil {
+			store.RemoveFromSet(rpcWriteBackLogKey, id)
+			continue
+		}
+
+		var e writeBackEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			log.WithError(err).Error("Could not decode RPC write-back entry")
+		} else if !replayWriteBackEntry(e, rule) {
+			continue
+		}
+		store.RemoveFromSet(rpcWriteBackLogKey, id)
+		store.DeleteRawKey(rpcWriteBackEntryPrefix + id)
+	}
+
+	for _, v := range counters {
+		var e writeBackEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			log.WithError(err).Error("Could not decode RPC write-back entry")
+		} else if !replayWriteBackEntry(e, rule) {
+			continue
+		}
+		store.RemoveFromSet(rpcWriteBackCountersKey, v)
+	}
+}
+
+// replayWriteBackEntry applies e on the control plane and reports whether it
+// can be dropped from the log.
+func replayWriteBackEntry(e writeBackEntry, rule string) bool {
+	r := &RPCStorageHandler{KeyPrefix: e.KeyPrefix, HashKeys: e.HashKeys}
+	if rpc.IsEmergencyMode() {
+		return false
+	}
+
+	if e.Op != writeBackIncrement && rule != config.WriteBackLocalWins {
+		RPCGlobalCache.Delete(r.fixKey(e.KeyName))
+		remote, err := r.GetKey(e.KeyName)
+		if err == nil && !localChangeWins(e, remote, rule) {
+			// Dropping the local copy makes the gateway fetch the session
+			// of the control plane on the next request.
+			log.Info("Control plane copy of key kept: ", obfuscateKey(e.KeyName))
+			r.localStore().DeleteKey(e.KeyName)
+			return true
+		}
+	}
+
+	var err error
+	switch e.Op {
+	case writeBackSet:
+		_, err = rpc.FuncClientSingleton("SetKey", apidef.InboundData{
+			KeyName:      r.fixKey(e.KeyName),
+			SessionState: e.Value,
+			Timeout:      e.Timeout,
+		})
+	case writeBackDelete:
+		_, err = rpc.FuncClientSingleton("DeleteKey", r.fixKey(e.KeyName))
+	case writeBackIncrement:
+		err = replayIncrement(e)
+	default:
+		log.Warning("Unknown RPC write-back operation: ", e.Op)
+		return true
+	}
+	if err != nil {
+		log.WithError(err).Error("Could not replay RPC write-back entry, it will be retried on reconnect")
+		return false
+	}
+	return true
+}
+
+// replayIncrement adds the local counter of e to the counter of the control
+// plane and clears it, so the next outage counts from zero again.
+func replayIncrement(e writeBackEntry) error {
+	store := writeBackLog()
+	value, err := store.GetRawKey(e.KeyName)
+	if err != nil {
+		// the counter expired with its period, there is nothing to add
+		return nil
+	}
+	delta, _ := strconv.ParseInt(value, 10, 64)
+	if delta <= 0 {
+		store.DeleteRawKey(e.KeyName)
+		return nil
+	}
+
+	_, err = rpc.FuncClientSingleton("IncrementByWithExpire", apidef.IncrementRequest{
+		KeyName: e.KeyName,
+		Delta:   delta,
+		Expire:  e.Expire,
+	})
+	if err != nil && strings.Contains(err.Error(), "unknown method") {
+		// Control planes without IncrementByWithExpire can only increment
+		// by one.
+		for i := int64(0); i < delta; i++ {
+			_, err = rpc.FuncClientSingleton("IncrememntWithExpire", apidef.InboundData{
+				KeyName: e.KeyName,
+				Expire:  e.Expire,
+			})
+			if err != nil {
+				// keep the increments that weren't replayed
+				store.SetRawKey(e.KeyName, strconv.FormatInt(delta-i, 10), e.Expire)
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	store.DeleteRawKey(e.KeyName)
+	return nil
+}
+
+func appendWriteBack(e writeBackEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	store := writeBackLog()
+	if e.Op == writeBackIncrement {
+		store.AddToSet(rpcWriteBackCountersKey, string(data))
+		return
+	}
+
+	id := e.KeyPrefix + e.KeyName
+	store.SetRawKey(rpcWriteBackEntryPrefix+id, string(data), 0)
+	store.AddToSet(rpcWriteBackLogKey, id)
+}
+
+// localChangeWins tells if the local change e overrides the session the
+// control plane holds for the same key.
+func localChangeWins(e writeBackEntry, remote, rule string) bool {
+	switch rule {
+	case config.WriteBackLocalWins:
+		return true
+	case config.WriteBackRemoteWins:
+		return false
+	}
+
+	localUpdated := e.Time
+	if e.Op == writeBackSet {
+		if updated := sessionLastUpdated(e.Value); updated > 0 {
+			localUpdated = updated
+		}
+	}
+	return localUpdated >= sessionLastUpdated(remote)
+}
+
+func sessionLastUpdated(data string) int64 {
+	var session user.SessionState
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return 0
+	}
+	updated, _ := strconv.ParseInt(session.LastUpdated, 10, 64)
+	return updated
+}
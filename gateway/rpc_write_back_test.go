@@ -0,0 +1,158 @@
+// +build !race
+
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/TykTechnologies/gorpc"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/rpc"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestRPCWriteBack(t *testing.T) {
+	rpc.UseSyncLoginRPC = true
+
+	var (
+		mu             sync.Mutex
+		setKeys        = map[string]string{}
+		deleted        []string
+		increments     = map[string]int64{}
+		incrementCalls int
+	)
+	remote := CreateStandardSession()
+	remote.LastUpdated = "9999999999"
+
+	dispatcher := gorpc.NewDispatcher()
+	dispatcher.AddFunc("Login", func(clientAddr, userKey string) bool {
+		return true
+	})
+	dispatcher.AddFunc("GetApiDefinitions", func(clientAddr string, dr *apidef.DefRequest) (string, error) {
+		return "[]", nil
+	})
+	dispatcher.AddFunc("GetPolicies", func(clientAddr string, orgid string) (string, error) {
+		return "[]", nil
+	})
+	dispatcher.AddFunc("GetKey", func(clientAddr, key string) (string, error) {
+		if key == "apikey-conflict" {
+			return jsonMarshalString(&remote), nil
+		}
+		return "", errors.New("not found")
+	})
+	dispatcher.AddFunc("SetKey", func(clientAddr string, ibd *apidef.InboundData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		setKeys[ibd.KeyName] = ibd.SessionState
+		return nil
+	})
+	dispatcher.AddFunc("DeleteKey", func(clientAddr, key string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, key)
+		return true, nil
+	})
+	dispatcher.AddFunc("IncrememntWithExpire", func(clientAddr string, ibd *apidef.InboundData) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		incrementCalls++
+		increments[ibd.KeyName]++
+		return increments[ibd.KeyName], nil
+	})
+	dispatcher.AddFunc("IncrementByWithExpire", func(clientAddr string, req *apidef.IncrementRequest) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		incrementCalls++
+		increments[req.KeyName] += req.Delta
+		return increments[req.KeyName], nil
+	})
+
+	rpcMock := startRPCMock(dispatcher)
+	defer stopRPCMock(rpcMock)
+
+	globalConf := config.Global()
+	globalConf.SlaveOptions.WriteBack.Enabled = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	rpc.SetEmergencyMode(t, true)
+	defer rpc.SetEmergencyMode(t, false)
+
+	writeBackLog().DeleteRawKey("quota-key")
+	defer writeBackLog().DeleteRawKey("quota-key")
+
+	store := &RPCStorageHandler{KeyPrefix: "apikey-"}
+	local := CreateStandardSession()
+	local.LastUpdated = "1"
+	session := jsonMarshalString(&local)
+
+	for _, key := range []string{"created", "conflict", "deleted"} {
+		if err := store.SetKey(key, session, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.DeleteKey("deleted")
+	store.IncrememntWithExpire("quota-key", 60)
+	if val := store.IncrememntWithExpire("quota-key", 60); val != 2 {
+		t.Errorf("expected the local counter to be 2, got %d", val)
+	}
+
+	if value, err := store.GetKey("created"); err != nil || value != session {
+		t.Errorf("expected the key to be read locally, got %q %v", value, err)
+	}
+	if _, found := GlobalSessionManager.SessionDetail("", "created", false); !found {
+		t.Error("expected the session to be valid locally")
+	}
+
+	mu.Lock()
+	if len(setKeys) != 0 || len(deleted) != 0 || len(increments) != 0 {
+		t.Error("no RPC calls are expected in emergency mode")
+	}
+	mu.Unlock()
+
+	rpc.SetEmergencyMode(t, false)
+	replayRPCWriteBack()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if setKeys["apikey-created"] != session {
+		t.Error("expected the created key to be replayed")
+	}
+	if _, ok := setKeys["apikey-conflict"]; ok {
+		t.Error("the newer control plane session should be kept")
+	}
+	if _, ok := setKeys["apikey-deleted"]; ok || len(deleted) != 1 || deleted[0] != "apikey-deleted" {
+		t.Errorf("expected only the deletion to be replayed, got %v", deleted)
+	}
+	if increments["quota-key"] != 2 || incrementCalls != 1 {
+		t.Errorf("expected 2 increments to be replayed in one call, got %d in %d", increments["quota-key"], incrementCalls)
+	}
+	if _, err := writeBackLog().GetRawKey("quota-key"); err == nil {
+		t.Error("expected the local counter to be cleared after the replay")
+	}
+	if _, found := GlobalSessionManager.SessionDetail("", "conflict", false); found {
+		t.Error("the local copy of the conflicting session should be dropped")
+	}
+	for _, key := range []string{rpcWriteBackLogKey, rpcWriteBackCountersKey} {
+		if vals, _ := writeBackLog().GetSet(key); len(vals) != 0 {
+			t.Errorf("expected the log to be empty, got %v", vals)
+		}
+	}
+
+	t.Run("conflict resolution", func(t *testing.T) {
+		localSession := user.SessionState{}
+		if !localChangeWins(writeBackEntry{Op: writeBackSet, Value: jsonMarshalString(&localSession)}, jsonMarshalString(&remote), config.WriteBackLocalWins) {
+			t.Error("local change should win")
+		}
+		if localChangeWins(writeBackEntry{Op: writeBackDelete, Time: 1}, jsonMarshalString(&remote), config.WriteBackNewestWins) {
+			t.Error("newer control plane session should win")
+		}
+	})
+}
@@ -13,6 +13,7 @@ import (
 	pprof_http "net/http/pprof"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
@@ -78,6 +79,9 @@ var (
 
 	policiesMu   sync.RWMutex
 	policiesByID = map[string]user.Policy{}
+	// policyKVDefs holds the policies of policiesByID whose KV references
+	// were resolved, as they were loaded.
+	policyKVDefs = map[string]user.Policy{}
 
 	LE_MANAGER  letsencrypt.Manager
 	LE_FIRSTRUN bool
@@ -168,8 +172,14 @@ func setupGlobals(ctx context.Context) {
 			time.Duration(config.Global().DnsCache.CheckInterval)*time.Second)
 	}
 
-	if config.Global().EnableAnalytics && config.Global().Storage.Type != "redis" {
-		mainLog.Fatal("Analytics requires Redis Storage backend, please enable Redis in the tyk.conf file.")
+	if config.Global().EnableAnalytics {
+		switch t := config.Global().Storage.Type; {
+		case t == storage.EmbeddedType && !analyticsSinksBypassRedis():
+			// nothing drains the records kept in the embedded storage
+			mainLog.Fatal("Analytics on the embedded storage require analytics sinks other than Redis, please configure analytics_config.sinks in the tyk.conf file.")
+		case t != "redis" && t != storage.EmbeddedType:
+			mainLog.Fatal("Analytics requires Redis Storage backend, please enable Redis in the tyk.conf file.")
+		}
 	}
 
 	// Initialise HostCheckerManager only if uptime tests are enabled.
@@ -177,16 +187,16 @@ func setupGlobals(ctx context.Context) {
 		if config.Global().ManagementNode {
 			mainLog.Warn("Running Uptime checks in a management node.")
 		}
-		healthCheckStore := storage.RedisCluster{KeyPrefix: "host-checker:"}
-		InitHostCheckManager(ctx, &healthCheckStore)
+		healthCheckStore := storage.New("host-checker:", false, false)
+		InitHostCheckManager(ctx, healthCheckStore)
 	}
 
 	initHealthCheck(ctx)
 
-	redisStore := storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: config.Global().HashKeys}
-	GlobalSessionManager.Init(&redisStore)
+	redisStore := storage.New("apikey-", config.Global().HashKeys, false)
+	GlobalSessionManager.Init(redisStore)
 
-	versionStore := storage.RedisCluster{KeyPrefix: "version-check-"}
+	versionStore := storage.New("version-check-", false, false)
 	versionStore.Connect()
 	_ = versionStore.SetKey("gateway", VERSION, 0)
 
@@ -196,17 +206,16 @@ func setupGlobals(ctx context.Context) {
 		config.SetGlobal(globalConf)
 		mainLog.Debug("Setting up analytics DB connection")
 
-		analyticsStore := storage.RedisCluster{KeyPrefix: "analytics-"}
-		analytics.Store = &analyticsStore
+		analytics.Store = storage.NewAnalytics("analytics-")
 		analytics.Init(globalConf)
 
 		if config.Global().AnalyticsConfig.Type == "rpc" {
 			mainLog.Debug("Using RPC cache purge")
 
 			rpcPurgeOnce.Do(func() {
-				store := storage.RedisCluster{KeyPrefix: "analytics-"}
+				store := storage.New("analytics-", false, false)
 				purger := rpc.Purger{
-					Store: &store,
+					Store: store,
 				}
 				purger.Connect()
 				go purger.PurgeLoop(ctx)
@@ -223,9 +232,7 @@ func setupGlobals(ctx context.Context) {
 
 	// Get the notifier ready
 	mainLog.Debug("Notifier will not work in hybrid mode")
-	mainNotifierStore := &storage.RedisCluster{}
-	mainNotifierStore.Connect()
-	MainNotifier = RedisNotifier{mainNotifierStore, RedisPubSubChannel}
+	MainNotifier = RedisNotifier{storage.NewPubSub(), RedisPubSubChannel}
 
 	if config.Global().Monitor.EnableTriggerMonitors {
 		h := &WebHookHandler{}
@@ -294,6 +301,8 @@ func syncAPISpecs() (int, error) {
 		if err != nil {
 			return 0, err
 		}
+	} else if config.Global().Sync.Enabled && syncStateApplied() {
+		s = syncedAPISpecs(loader)
 	} else {
 		s = loader.FromDir(config.Global().AppPath)
 	}
@@ -331,6 +340,8 @@ func syncPolicies() (count int, err error) {
 
 	mainLog.Info("Loading policies")
 
+	// only set again when the policies are loaded from templated files
+	setKVRefs(kvRefOwnerPolicyFile, nil)
 	switch config.Global().Policies.PolicySource {
 	case "service":
 		if config.Global().Policies.PolicyConnectionString == "" {
@@ -346,6 +357,10 @@ func syncPolicies() (count int, err error) {
 		mainLog.Debug("Using Policies from RPC")
 		pols, err = LoadPoliciesFromRPC(config.Global().SlaveOptions.RPCKey)
 	default:
+		if config.Global().Sync.Enabled && syncStateApplied() {
+			pols = syncedPolicies()
+			break
+		}
 		// this is the only case now where we need a policy record name
 		if config.Global().Policies.PolicyRecordName == "" {
 			mainLog.Debug("No policy record name defined, skipping...")
@@ -353,6 +368,7 @@ func syncPolicies() (count int, err error) {
 		}
 		pols = LoadPoliciesFromFile(config.Global().Policies.PolicyRecordName)
 	}
+	defs := resolvePolicyKVRefs(pols)
 	mainLog.Infof("Policies found (%d total):", len(pols))
 	for id := range pols {
 		mainLog.Debugf(" - %s", id)
@@ -361,7 +377,26 @@ func syncPolicies() (count int, err error) {
 	policiesMu.Lock()
 	defer policiesMu.Unlock()
 	if len(pols) > 0 {
+		oldIDs := make([]string, 0, len(policiesByID))
+		for id := range policiesByID {
+			oldIDs = append(oldIDs, id)
+		}
+		newIDs := make([]string, 0, len(pols))
+		for id := range pols {
+			newIDs = append(newIDs, id)
+		}
+		old, oldDefs := policiesByID, policyKVDefs
+		FireSystemEvent(EventPoliciesReloaded, newReloadMeta(oldIDs, newIDs, func(id string) bool {
+			return !reflect.DeepEqual(loadedPolicy(old, oldDefs, id), loadedPolicy(pols, defs, id))
+		}))
+
 		policiesByID = pols
+		policyKVDefs = defs
+		pruneKVRefs(kvRefOwnerPolicy, func(id string) bool {
+			_, ok := pols[id]
+			return ok
+		})
+		prometheusMetrics.reloaded("policies")
 	}
 
 	return len(pols), err
@@ -425,6 +460,20 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 		mainLog.Info("Control API hostname set: ", hostname)
 	}
 
+	if conf := config.Global().Prometheus; conf.Enabled {
+		path := conf.Path
+		if path == "" {
+			path = defaultPrometheusPath
+		}
+		// without a separate control port the control router is the public
+		// gateway listener, so the metrics need the same auth as /tyk/
+		var handler http.Handler = prometheusMetrics.handler()
+		if config.Global().ControlAPIPort == 0 {
+			handler = checkIsAPIOwner(handler)
+		}
+		muxer.Handle(path, handler)
+	}
+
 	if *cli.HTTPProfile || config.Global().HTTPProfile {
 		muxer.HandleFunc("/debug/pprof/profile", pprof_http.Profile)
 		muxer.HandleFunc("/debug/pprof/{_:.*}", pprof_http.Index)
@@ -443,9 +492,12 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 		r.HandleFunc("/org/keys/{keyName:[^/]*}", orgHandler).Methods("POST", "PUT", "GET", "DELETE")
 		r.HandleFunc("/keys/policy/{keyName}", policyUpdateHandler).Methods("POST")
 		r.HandleFunc("/keys/create", createKeyHandler).Methods("POST")
+		r.HandleFunc("/keys/{keyName:[^/]*}/rotate", rotateKeyHandler).Methods("POST")
 		r.HandleFunc("/apis", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
 		r.HandleFunc("/apis/{apiID}", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
 		r.HandleFunc("/health", healthCheckhandler).Methods("GET")
+		r.HandleFunc("/sync", syncHandler).Methods("POST")
+		r.HandleFunc("/sync/plan", syncPlanHandler).Methods("GET")
 		r.HandleFunc("/oauth/clients/create", createOauthClient).Methods("POST")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", oAuthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}/rotate", rotateOauthClientHandler).Methods("PUT")
@@ -460,6 +512,10 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 
 	r.HandleFunc("/debug", traceHandler).Methods("POST")
 	r.HandleFunc("/cache/{apiID}", invalidateCacheHandler).Methods("DELETE")
+	r.HandleFunc("/cache/{apiID}/invalidate", targetedCacheInvalidationHandler).Methods("POST")
+	r.HandleFunc("/webhooks/dead-letter", webhookDeadLetterListHandler).Methods("GET")
+	r.HandleFunc("/webhooks/dead-letter/{id}", webhookDeadLetterHandler).Methods("DELETE")
+	r.HandleFunc("/webhooks/dead-letter/{id}/replay", webhookDeadLetterHandler).Methods("POST")
 	r.HandleFunc("/keys", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/keys/preview", previewKeyHandler).Methods("POST")
 	r.HandleFunc("/keys/{keyName:[^/]*}", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
@@ -523,7 +579,7 @@ func addOAuthHandlers(spec *APISpec, muxer *mux.Router) *OAuthManager {
 	prefix := generateOAuthPrefix(spec.APIID)
 	storageManager := getGlobalStorageHandler(prefix, false)
 	storageManager.Connect()
-	osinStorage := &RedisOsinStorageInterface{storageManager, GlobalSessionManager, &storage.RedisCluster{KeyPrefix: prefix, HashKeys: false}, spec.OrgID}
+	osinStorage := &RedisOsinStorageInterface{storageManager, GlobalSessionManager, storage.New(prefix, false, false), spec.OrgID}
 
 	osinServer := TykOsinNewServer(serverConfig, osinStorage)
 
@@ -968,7 +1024,13 @@ func initialiseSystem(ctx context.Context) error {
 		}
 	}
 
-	if config.Global().Storage.Type != "redis" {
+	switch config.Global().Storage.Type {
+	case "redis":
+	case storage.EmbeddedType:
+		if err := storage.OpenEmbedded(config.Global().Storage.Path); err != nil {
+			mainLog.Fatal("Could not open the embedded storage: ", err)
+		}
+	default:
 		mainLog.Fatal("Redis connection details not set, please ensure that the storage type is set to Redis and that the connection parameters are correct.")
 	}
 
@@ -1221,7 +1283,7 @@ func getGlobalStorageHandler(keyPrefix string, hashKeys bool) storage.Handler {
 			HashKeys:  hashKeys,
 		}
 	}
-	return &storage.RedisCluster{KeyPrefix: keyPrefix, HashKeys: hashKeys}
+	return storage.New(keyPrefix, hashKeys, false)
 }
 
 func Start() {
@@ -1275,9 +1337,11 @@ func Start() {
 		defer trace.Close()
 	}
 	start(ctx)
-	go storage.ConnectToRedis(ctx, func() {
-		reloadURLStructure(func() {})
-	})
+	if config.Global().Storage.Type != storage.EmbeddedType {
+		go storage.ConnectToRedis(ctx, func() {
+			reloadURLStructure(func() {})
+		})
+	}
 
 	if *cli.MemProfile {
 		mainLog.Debug("Memory profiling active")
@@ -1328,6 +1392,10 @@ func Start() {
 	// write pprof profiles
 	writeProfiles()
 
+	if err := storage.CloseEmbedded(); err != nil {
+		mainLog.Error("Closing the embedded storage: ", err)
+	}
+
 	if config.Global().UseDBAppConfigs {
 		mainLog.Info("Stopping heartbeat...")
 		DashService.StopBeating()
@@ -1385,15 +1453,30 @@ func start(ctx context.Context) {
 		}
 
 		RPCListener.Connect()
-		go rpcReloadLoop(slaveOptions.RPCKey)
 		go RPCListener.StartRPCKeepaliveWatcher()
-		go RPCListener.StartRPCLoopCheck(slaveOptions.RPCKey)
+		if slaveOptions.EnablePushSync {
+			go RPCListener.StartRPCPushSync(slaveOptions.RPCKey)
+		} else {
+			go rpcReloadLoop(slaveOptions.RPCKey)
+			go RPCListener.StartRPCLoopCheck(slaveOptions.RPCKey)
+		}
 	}
 
 	// 1s is the minimum amount of time between hot reloads. The
 	// interval counts from the start of one reload to the next.
 	go reloadLoop(ctx, time.Tick(time.Second))
 	go reloadQueueLoop(ctx)
+	go certificateExpiryLoop(ctx)
+	go rotatedKeyExpiryLoop(ctx)
+	go kvRefreshLoop(ctx)
+
+	if config.Global().Sync.Enabled {
+		// The first sync is applied by the reload that follows the start.
+		if _, err := runSync(false); err != nil {
+			mainLog.Warning("Loading APIs from ", config.Global().AppPath, " until the sync directory is valid")
+		}
+		go syncLoop(ctx)
+	}
 }
 
 func dashboardServiceInit() {
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,9 +9,11 @@ import (
 
 	"github.com/TykTechnologies/leakybucket"
 	"github.com/TykTechnologies/leakybucket/memorycache"
+	"github.com/opentracing/opentracing-go"
 
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/trace"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -37,6 +40,25 @@ type SessionLimiter struct {
 	bucketStore leakybucket.Storage
 }
 
+// limiterStore returns the store the limiter should use for r. With tracing
+// enabled it is bound to a context carrying the request span and service, but
+// not the request's cancellation: sentinel writes and quota increments may outlive
+// the request and must not fail once the client goes away.
+func limiterStore(r *http.Request) storage.Handler {
+	store := GlobalSessionManager.Store()
+	if !trace.IsEnabled() {
+		return store
+	}
+
+	span := opentracing.SpanFromContext(r.Context())
+	if span == nil {
+		return store
+	}
+
+	ctx := trace.SetServiceID(context.Background(), trace.GetServiceID(r.Context()))
+	return storage.WithContext(store, opentracing.ContextWithSpan(ctx, span))
+}
+
 func (l *SessionLimiter) doRollingWindowWrite(key, rateLimiterKey, rateLimiterSentinelKey string,
 	currentSession *user.SessionState,
 	store storage.Handler,
@@ -100,8 +122,8 @@ const (
 func (l *SessionLimiter) limitSentinel(currentSession *user.SessionState, key string, rateScope string, store storage.Handler,
 	globalConf *config.Config, apiLimit *user.APILimit, dryRun bool) bool {
 
-	rateLimiterKey := RateLimitKeyPrefix + rateScope + currentSession.GetKeyHash()
-	rateLimiterSentinelKey := RateLimitKeyPrefix + rateScope + currentSession.GetKeyHash() + ".BLOCKED"
+	rateLimiterKey := RateLimitKeyPrefix + rateScope + currentSession.GetCounterKeyHash()
+	rateLimiterSentinelKey := RateLimitKeyPrefix + rateScope + currentSession.GetCounterKeyHash() + ".BLOCKED"
 
 	go l.doRollingWindowWrite(key, rateLimiterKey, rateLimiterSentinelKey, currentSession, store, globalConf, apiLimit, dryRun)
 
@@ -117,8 +139,8 @@ func (l *SessionLimiter) limitSentinel(currentSession *user.SessionState, key st
 func (l *SessionLimiter) limitRedis(currentSession *user.SessionState, key string, rateScope string, store storage.Handler,
 	globalConf *config.Config, apiLimit *user.APILimit, dryRun bool) bool {
 
-	rateLimiterKey := RateLimitKeyPrefix + rateScope + currentSession.GetKeyHash()
-	rateLimiterSentinelKey := RateLimitKeyPrefix + rateScope + currentSession.GetKeyHash() + ".BLOCKED"
+	rateLimiterKey := RateLimitKeyPrefix + rateScope + currentSession.GetCounterKeyHash()
+	rateLimiterSentinelKey := RateLimitKeyPrefix + rateScope + currentSession.GetCounterKeyHash() + ".BLOCKED"
 
 	if l.doRollingWindowWrite(key, rateLimiterKey, rateLimiterSentinelKey, currentSession, store, globalConf, apiLimit, dryRun) {
 		return true
@@ -134,6 +156,11 @@ func (l *SessionLimiter) limitDRL(currentSession *user.SessionState, key string,
 		l.bucketStore = memorycache.New()
 	}
 
+	// keys issued by a rotation share the bucket of the key they replaced
+	if currentSession.CounterKeyHash != "" {
+		key = currentSession.CounterKeyHash
+	}
+
 	bucketKey := key + ":" + rateScope + currentSession.LastUpdated
 	currRate := apiLimit.Rate
 	per := apiLimit.Per
@@ -254,7 +281,7 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		quotaScope = scope + "-"
 	}
 
-	rawKey := QuotaKeyPrefix + quotaScope + currentSession.GetKeyHash()
+	rawKey := QuotaKeyPrefix + quotaScope + currentSession.GetCounterKeyHash()
 	quotaRenewalRate := limit.QuotaRenewalRate
 	quotaRenews := limit.QuotaRenews
 	quotaMax := limit.QuotaMax
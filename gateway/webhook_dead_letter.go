@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	webhookDeadLetterList = "dead-letter"
+	// only the most recent failed deliveries are kept
+	maxWebhookDeadLetters = 1000
+)
+
+var (
+	// webhookHandlers holds the loaded handlers keeping dead letters by id,
+	// the requests are built again by their handler when replayed.
+	webhookHandlers = struct {
+		sync.RWMutex
+		byID map[string]*WebHookHandler
+	}{byID: map[string]*WebHookHandler{}}
+
+	errWebhookHandlerNotLoaded = errors.New("webhook handler is not loaded")
+)
+
+// webhookDeadLetter is a webhook delivery that failed after all retries. It
+// keeps the body but not the headers, which hold the signature and the
+// configured auth headers. The handler sets them again on replay.
+type webhookDeadLetter struct {
+	ID       string          `json:"id"`
+	Handler  string          `json:"handler"`
+	Event    apidef.TykEvent `json:"event"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     string          `json:"body"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+func webhookDeadLetterStore() storage.Handler {
+	return storage.New("webhook.", false, false)
+}
+
+// registerWebhookHandler records w for the replay of its dead letters and
+// returns its id. Handlers sending to the same target with the same template
+// share an id, the last one loaded replays their dead letters.
+func registerWebhookHandler(w *WebHookHandler) string {
+	sum := sha256.Sum256([]byte(w.conf.Method + " " + w.conf.TargetPath + " " + w.conf.TemplatePath))
+	id := hex.EncodeToString(sum[:16])
+
+	webhookHandlers.Lock()
+	webhookHandlers.byID[id] = w
+	webhookHandlers.Unlock()
+	return id
+}
+
+func loadedWebhookHandler(id string) *WebHookHandler {
+	webhookHandlers.RLock()
+	defer webhookHandlers.RUnlock()
+	return webhookHandlers.byID[id]
+}
+
+func addWebhookDeadLetter(handlerID string, event apidef.TykEvent, req *http.Request, body string, err error, attempts int) {
+	entry := webhookDeadLetter{
+		ID:       uuid.NewV4().String(),
+		Handler:  handlerID,
+		Event:    event,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Body:     body,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "webhooks",
+		"id":     entry.ID,
+		"target": entry.URL,
+	}).Error("Webhook delivery failed, adding it to the dead-letter list")
+
+	raw, _ := json.Marshal(entry)
+	store := webhookDeadLetterStore()
+	store.AppendToSet(webhookDeadLetterList, string(raw))
+
+	// the list is trimmed from the oldest entries
+	store.TrimList(webhookDeadLetterList, -maxWebhookDeadLetters, -1)
+}
+
+// webhookDeadLetters returns the dead-letter entries, oldest first, along
+// with their raw values.
+func webhookDeadLetters() ([]webhookDeadLetter, []string, error) {
+	raw, err := webhookDeadLetterStore().GetListRange(webhookDeadLetterList, 0, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]webhookDeadLetter, 0, len(raw))
+	values := make([]string, 0, len(raw))
+	for _, value := range raw {
+		var entry webhookDeadLetter
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		values = append(values, value)
+	}
+
+	return entries, values, nil
+}
+
+func findWebhookDeadLetter(id string) (*webhookDeadLetter, string, error) {
+	entries, values, err := webhookDeadLetters()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range entries {
+		if entries[i].ID == id {
+			return &entries[i], values[i], nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// replayWebhookDeadLetter sends a failed delivery again, with the request
+// built by its handler.
+func replayWebhookDeadLetter(entry *webhookDeadLetter) error {
+	handler := loadedWebhookHandler(entry.Handler)
+	if handler == nil {
+		return errWebhookHandlerNotLoaded
+	}
+	req, err := handler.BuildRequest(entry.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = sendWebhookRequest(req)
+	return err
+}
+
+func webhookDeadLetterListHandler(w http.ResponseWriter, r *http.Request) {
+	entries, _, err := webhookDeadLetters()
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to list dead-letter entries"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, entries)
+}
+
+func webhookDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	entry, value, err := findWebhookDeadLetter(id)
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to list dead-letter entries"))
+		return
+	}
+	if entry == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("Dead-letter entry not found"))
+		return
+	}
+
+	store := webhookDeadLetterStore()
+
+	if r.Method == http.MethodDelete {
+		store.RemoveFromList(webhookDeadLetterList, value)
+		doJSONWrite(w, http.StatusOK, apiOk("deleted"))
+		return
+	}
+
+	err = replayWebhookDeadLetter(entry)
+	if err == errWebhookHandlerNotLoaded {
+		doJSONWrite(w, http.StatusConflict, apiError("Webhook handler of the entry is not loaded"))
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "webhooks",
+			"id":     id,
+			"target": entry.URL,
+		}).Error("Failed to replay webhook: ", err)
+
+		doJSONWrite(w, http.StatusBadGateway, apiError("Replay failed: "+err.Error()))
+		return
+	}
+
+	store.RemoveFromList(webhookDeadLetterList, value)
+	doJSONWrite(w, http.StatusOK, apiOk("replayed"))
+}
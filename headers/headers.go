@@ -14,6 +14,12 @@ const (
 	Expires                 = "Expires"
 	Connection              = "Connection"
 	WWWAuthenticate         = "WWW-Authenticate"
+	Age                     = "Age"
+	ETag                    = "ETag"
+	LastModified            = "Last-Modified"
+	Vary                    = "Vary"
+	IfNoneMatch             = "If-None-Match"
+	IfModifiedSince         = "If-Modified-Since"
 )
 
 const (
@@ -21,6 +27,7 @@ const (
 	ApplicationJSON = "application/json"
 	ApplicationXML  = "application/xml"
 	TextXML         = "text/xml"
+	FormURLEncoded  = "application/x-www-form-urlencoded"
 )
 
 const (
@@ -38,6 +45,7 @@ const (
 	XTykHostname        = "x-tyk-hostname"
 	XGenerator          = "X-Generator"
 	XTykAuthorization   = "X-Tyk-Authorization"
+	XTykCacheStatus     = "X-Tyk-Cache-Status"
 )
 
 // upgrade and websocket
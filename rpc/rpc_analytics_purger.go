@@ -37,6 +37,7 @@ type AnalyticsRecord struct {
 	Alias         string
 	TrackPath     bool
 	ExpireAt      time.Time `bson:"expireAt" json:"expireAt"`
+	SampleWeight  float64
 }
 type GeoData struct {
 	Country struct {
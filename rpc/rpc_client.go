@@ -35,6 +35,7 @@ var (
 	getGroupLoginCallback       func(string, string) interface{}
 	emergencyModeCallback       func()
 	emergencyModeLoadedCallback func()
+	connectionStateCallback     atomic.Value
 
 	killChan = make(chan int)
 	killed   bool
@@ -107,7 +108,12 @@ func (r *rpcOpts) GetLoadCounts() int {
 }
 
 func (r *rpcOpts) SetEmergencyMode(n bool) {
+	was := r.GetEmergencyMode()
 	r.emergencyMode.Store(n)
+
+	if fn, ok := connectionStateCallback.Load().(func(bool)); ok && fn != nil && was != n {
+		go fn(!n)
+	}
 }
 
 func (r *rpcOpts) GetEmergencyMode() bool {
@@ -151,6 +157,12 @@ func IsEmergencyMode() bool {
 	return values.GetEmergencyMode()
 }
 
+// SetConnectionStateCallback sets a function called when the connection to
+// the RPC server is lost, entering emergency mode, and when it is restored.
+func SetConnectionStateCallback(fn func(connected bool)) {
+	connectionStateCallback.Store(fn)
+}
+
 func LoadCount() int {
 	return values.GetLoadCounts()
 }
@@ -459,11 +471,17 @@ func recoverOp(fn func() error) func() error {
 // backoff ensuring indeed we can't connect to the rpc, this will eventually
 // fall into emergency mode( That is handled outside of this function call)
 func FuncClientSingleton(funcName string, request interface{}) (result interface{}, err error) {
+	return FuncClientSingletonTimeout(funcName, request, GlobalRPCCallTimeout)
+}
+
+// FuncClientSingletonTimeout is FuncClientSingleton with a custom timeout,
+// used by calls the RPC server holds until it has something to return.
+func FuncClientSingletonTimeout(funcName string, request interface{}, timeout time.Duration) (result interface{}, err error) {
 	be := backoff.Retry(func() error {
 		if !values.ClientIsConnected() {
 			return ErrRPCIsDown
 		}
-		result, err = funcClientSingleton.CallTimeout(funcName, request, GlobalRPCCallTimeout)
+		result, err = funcClientSingleton.CallTimeout(funcName, request, timeout)
 		return nil
 	}, backoff.WithMaxRetries(
 		backoff.NewConstantBackOff(10*time.Millisecond), 3,
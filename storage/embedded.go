@@ -0,0 +1,1021 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// ------------------- EMBEDDED STORAGE MANAGER -------------------------------
+
+// EmbeddedType is the storage type running the gateway against an embedded
+// database instead of Redis.
+const EmbeddedType = "embedded"
+
+const (
+	defaultEmbeddedPath   = "tyk.db"
+	embeddedSweepInterval = 10 * time.Second
+	// embeddedBatchDelay is how long the writes made on the request path
+	// wait for others to share their transaction, and its fsync, with.
+	embeddedBatchDelay = 2 * time.Millisecond
+)
+
+// ErrEmbeddedIsClosed is returned when the embedded database is not open.
+var ErrEmbeddedIsClosed = errors.New("storage: embedded database is not open")
+
+var (
+	embeddedMain  = []byte("main")
+	embeddedCache = []byte("cache")
+)
+
+const (
+	kindString = iota
+	kindList
+	kindSet
+	kindSortedSet
+)
+
+// embeddedValue is a value of the embedded database, it holds one of the
+// Redis types used by the gateway.
+type embeddedValue struct {
+	Kind    int             `json:"k"`
+	String  string          `json:"s,omitempty"`
+	List    []string        `json:"l,omitempty"`
+	Sorted  []sortedElement `json:"z,omitempty"`
+	Expires int64           `json:"e,omitempty"`
+}
+
+type sortedElement struct {
+	Member string  `json:"m"`
+	Score  float64 `json:"s"`
+}
+
+func (v *embeddedValue) expired(now time.Time) bool {
+	return v.Expires > 0 && v.Expires <= now.UnixNano()
+}
+
+func (v *embeddedValue) expire(seconds int64) {
+	v.Expires = 0
+	if seconds > 0 {
+		v.Expires = time.Now().Add(time.Duration(seconds) * time.Second).UnixNano()
+	}
+}
+
+var embedded struct {
+	sync.RWMutex
+	db   *bolt.DB
+	done chan struct{}
+}
+
+// OpenEmbedded opens the embedded database at path, the configured storage
+// path is used when path is empty.
+func OpenEmbedded(path string) error {
+	if path == "" {
+		path = config.Global().Storage.Path
+	}
+	if path == "" {
+		path = defaultEmbeddedPath
+	}
+
+	embedded.Lock()
+	defer embedded.Unlock()
+	if embedded.db != nil {
+		return nil
+	}
+
+	log.Info("--> [EMBEDDED] Opening database ", path)
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{embeddedMain, embeddedCache} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	db.MaxBatchDelay = embeddedBatchDelay
+	embedded.db = db
+	embedded.done = make(chan struct{})
+	go sweepEmbedded(db, embedded.done)
+	return nil
+}
+
+// CloseEmbedded closes the embedded database and stops its subscriptions.
+func CloseEmbedded() error {
+	embedded.Lock()
+	defer embedded.Unlock()
+	if embedded.db == nil {
+		return nil
+	}
+	close(embedded.done)
+	err := embedded.db.Close()
+	embedded.db = nil
+	broker.closeAll()
+	return err
+}
+
+func embeddedDB() *bolt.DB {
+	embedded.RLock()
+	defer embedded.RUnlock()
+	return embedded.db
+}
+
+// sweepEmbedded periodically deletes the expired keys, they are ignored by
+// reads until then.
+func sweepEmbedded(db *bolt.DB, done chan struct{}) {
+	tick := time.NewTicker(embeddedSweepInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
+		now := time.Now()
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{embeddedMain, embeddedCache} {
+				b := tx.Bucket(name)
+				var expired [][]byte
+				b.ForEach(func(k, data []byte) error {
+					var v embeddedValue
+					if json.Unmarshal(data, &v) == nil && v.expired(now) {
+						expired = append(expired, append([]byte(nil), k...))
+					}
+					return nil
+				})
+				for _, k := range expired {
+					if err := b.Delete(k); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).Error("Could not delete expired keys")
+		}
+	}
+}
+
+// EmbeddedStorage is a storage manager that uses an embedded database, so
+// the gateway can run without Redis.
+type EmbeddedStorage struct {
+	KeyPrefix string
+	HashKeys  bool
+	IsCache   bool
+}
+
+// Connect always returns true, the database is opened with OpenEmbedded.
+func (r *EmbeddedStorage) Connect() bool {
+	return true
+}
+
+func (r *EmbeddedStorage) hashKey(in string) string {
+	if !r.HashKeys {
+		return in
+	}
+	return HashStr(in)
+}
+
+func (r *EmbeddedStorage) fixKey(keyName string) string {
+	return r.KeyPrefix + r.hashKey(keyName)
+}
+
+func (r *EmbeddedStorage) cleanKey(keyName string) string {
+	return strings.Replace(keyName, r.KeyPrefix, "", 1)
+}
+
+func (r *EmbeddedStorage) bucket(tx *bolt.Tx) *bolt.Bucket {
+	if r.IsCache {
+		return tx.Bucket(embeddedCache)
+	}
+	return tx.Bucket(embeddedMain)
+}
+
+func (r *EmbeddedStorage) view(fn func(b *bolt.Bucket) error) error {
+	db := embeddedDB()
+	if db == nil {
+		return ErrEmbeddedIsClosed
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		return fn(r.bucket(tx))
+	})
+}
+
+func (r *EmbeddedStorage) update(fn func(b *bolt.Bucket) error) error {
+	db := embeddedDB()
+	if db == nil {
+		return ErrEmbeddedIsClosed
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return fn(r.bucket(tx))
+	})
+}
+
+// batch is like update for the writes made on the request path, concurrent
+// calls are committed together. fn may run more than once, so it must not
+// accumulate state across calls.
+func (r *EmbeddedStorage) batch(fn func(b *bolt.Bucket) error) error {
+	db := embeddedDB()
+	if db == nil {
+		return ErrEmbeddedIsClosed
+	}
+	return db.Batch(func(tx *bolt.Tx) error {
+		return fn(r.bucket(tx))
+	})
+}
+
+// load returns the live value of key, nil when it doesn't exist or expired.
+func load(b *bolt.Bucket, key string) *embeddedValue {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return nil
+	}
+	var v embeddedValue
+	if err := json.Unmarshal(data, &v); err != nil || v.expired(time.Now()) {
+		return nil
+	}
+	return &v
+}
+
+func store(b *bolt.Bucket, key string, v *embeddedValue) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+// loadKind returns the value of key when it is of the given kind, a new
+// value is returned when key doesn't exist.
+func loadKind(b *bolt.Bucket, key string, kind int) *embeddedValue {
+	v := load(b, key)
+	if v == nil || v.Kind != kind {
+		return &embeddedValue{Kind: kind}
+	}
+	return v
+}
+
+func (r *EmbeddedStorage) getString(key string) (string, error) {
+	var value string
+	err := r.view(func(b *bolt.Bucket) error {
+		v := load(b, key)
+		if v == nil || v.Kind != kindString {
+			return ErrKeyNotFound
+		}
+		value = v.String
+		return nil
+	})
+	if err != nil && err != ErrEmbeddedIsClosed {
+		return "", ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (r *EmbeddedStorage) setString(key, value string, timeout int64) error {
+	err := r.update(func(b *bolt.Bucket) error {
+		v := &embeddedValue{Kind: kindString, String: value}
+		v.expire(timeout)
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.Error("Error trying to set value: ", err)
+	}
+	return err
+}
+
+func (r *EmbeddedStorage) deleteRaw(keys ...string) bool {
+	deleted := false
+	err := r.update(func(b *bolt.Bucket) error {
+		for _, key := range keys {
+			if b.Get([]byte(key)) != nil {
+				deleted = true
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Error trying to delete key")
+		return false
+	}
+	return deleted
+}
+
+// scan returns the live keys and values matching match.
+func (r *EmbeddedStorage) scan(prefix string, match func(key string) bool) (keys, values []string) {
+	r.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		now := time.Now()
+		for k, data := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, data = c.Next() {
+			if match != nil && !match(string(k)) {
+				continue
+			}
+			var v embeddedValue
+			if json.Unmarshal(data, &v) != nil || v.expired(now) {
+				continue
+			}
+			keys = append(keys, string(k))
+			values = append(values, v.String)
+		}
+		return nil
+	})
+	return keys, values
+}
+
+// GetKey will retrieve a key from the database
+func (r *EmbeddedStorage) GetKey(keyName string) (string, error) {
+	return r.getString(r.fixKey(keyName))
+}
+
+// GetMultiKey returns the values of keys when one of them exists
+func (r *EmbeddedStorage) GetMultiKey(keys []string) ([]string, error) {
+	result := make([]string, len(keys))
+	found := false
+	for i, key := range keys {
+		if value, err := r.GetKey(key); err == nil {
+			result[i] = value
+			found = true
+		}
+	}
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	return result, nil
+}
+
+func (r *EmbeddedStorage) GetRawKey(keyName string) (string, error) {
+	return r.getString(keyName)
+}
+
+// GetExp returns the remaining time to live of a key in seconds, -1 when
+// the key doesn't expire and -2 when it doesn't exist.
+func (r *EmbeddedStorage) GetExp(keyName string) (int64, error) {
+	ttl := int64(-2)
+	err := r.view(func(b *bolt.Bucket) error {
+		v := load(b, r.fixKey(keyName))
+		switch {
+		case v == nil:
+		case v.Expires == 0:
+			ttl = -1
+		default:
+			ttl = int64(time.Until(time.Unix(0, v.Expires)).Seconds())
+		}
+		return nil
+	})
+	return ttl, err
+}
+
+func (r *EmbeddedStorage) SetExp(keyName string, timeout int64) error {
+	err := r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := load(b, key)
+		if v == nil {
+			return nil
+		}
+		v.expire(timeout)
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.Error("Could not EXPIRE key: ", err)
+	}
+	return err
+}
+
+// SetKey will create (or update) a key value in the store
+func (r *EmbeddedStorage) SetKey(keyName, session string, timeout int64) error {
+	return r.setString(r.fixKey(keyName), session, timeout)
+}
+
+func (r *EmbeddedStorage) SetRawKey(keyName, session string, timeout int64) error {
+	return r.setString(keyName, session, timeout)
+}
+
+func (r *EmbeddedStorage) incr(key string, by int64, expire int64) int64 {
+	var val int64
+	err := r.batch(func(b *bolt.Bucket) error {
+		v := loadKind(b, key, kindString)
+		current, _ := strconv.ParseInt(v.String, 10, 64)
+		val = current + by
+		v.String = strconv.FormatInt(val, 10)
+		if val == 1 && expire > 0 {
+			v.expire(expire)
+		}
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.Error("Error trying to increment value:", err)
+		return 0
+	}
+	return val
+}
+
+// Decrement will decrement a key
+func (r *EmbeddedStorage) Decrement(keyName string) {
+	r.incr(r.fixKey(keyName), -1, 0)
+}
+
+// IncrememntWithExpire will increment a raw key, the expiry is set when the
+// key is created
+func (r *EmbeddedStorage) IncrememntWithExpire(keyName string, expire int64) int64 {
+	return r.incr(keyName, 1, expire)
+}
+
+// GetKeys will return all keys according to the filter (filter is a prefix - e.g. tyk.keys.*)
+func (r *EmbeddedStorage) GetKeys(filter string) []string {
+	filterHash := ""
+	if filter != "" {
+		filterHash = r.hashKey(filter)
+	}
+	keys, _ := r.scan(r.KeyPrefix+filterHash, nil)
+	for i, v := range keys {
+		keys[i] = r.cleanKey(v)
+	}
+	return keys
+}
+
+// GetKeysAndValuesWithFilter will return all keys and their values with a filter
+func (r *EmbeddedStorage) GetKeysAndValuesWithFilter(filter string) map[string]string {
+	filterHash := ""
+	if filter != "" {
+		filterHash = r.hashKey(filter)
+	}
+	keys, values := r.scan(r.KeyPrefix+filterHash, nil)
+	if len(keys) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(keys))
+	for i, k := range keys {
+		m[r.cleanKey(k)] = values[i]
+	}
+	return m
+}
+
+// GetKeysAndValues will return all keys and their values - not to be used lightly
+func (r *EmbeddedStorage) GetKeysAndValues() map[string]string {
+	return r.GetKeysAndValuesWithFilter("")
+}
+
+// DeleteKey will remove a key from the database
+func (r *EmbeddedStorage) DeleteKey(keyName string) bool {
+	return r.deleteRaw(r.fixKey(keyName))
+}
+
+// DeleteAllKeys will remove all keys from the database.
+func (r *EmbeddedStorage) DeleteAllKeys() bool {
+	db := embeddedDB()
+	if db == nil {
+		return false
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{embeddedMain, embeddedCache} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("Error trying to delete keys")
+		return false
+	}
+	return true
+}
+
+// DeleteRawKey will remove a key from the database without prefixing, assumes user knows what they are doing
+func (r *EmbeddedStorage) DeleteRawKey(keyName string) bool {
+	return r.deleteRaw(keyName)
+}
+
+// DeleteScanMatch will remove the keys matching a glob pattern
+func (r *EmbeddedStorage) DeleteScanMatch(pattern string) bool {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		log.WithError(err).Error("Invalid pattern: ", pattern)
+		return false
+	}
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
+	}
+	keys, _ := r.scan(prefix, re.MatchString)
+	if len(keys) > 0 {
+		r.deleteRaw(keys...)
+		log.Info("Deleted: ", len(keys), " records")
+	}
+	return true
+}
+
+// globToRegexp converts a Redis glob pattern to a regular expression.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			if j < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+j]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			sb.WriteString("[" + strings.Replace(class, `\-`, "-", -1) + "]")
+			i += j
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// DeleteKeys will remove a group of keys in bulk
+func (r *EmbeddedStorage) DeleteKeys(keys []string) bool {
+	fixed := make([]string, len(keys))
+	for i, v := range keys {
+		fixed[i] = r.fixKey(v)
+	}
+	r.deleteRaw(fixed...)
+	return true
+}
+
+// StartPubSubHandler will listen for a signal and run the callback for
+// every subscription and message event, as the Redis storage does.
+func (r *EmbeddedStorage) StartPubSubHandler(channel string, callback func(interface{})) error {
+	if embeddedDB() == nil {
+		return ErrEmbeddedIsClosed
+	}
+	messages := broker.subscribe(channel)
+	defer broker.unsubscribe(channel, messages)
+
+	callback(&redis.Subscription{Kind: "subscribe", Channel: channel, Count: 1})
+	for msg := range messages {
+		callback(msg)
+	}
+	return ErrEmbeddedIsClosed
+}
+
+func (r *EmbeddedStorage) Publish(channel, message string) error {
+	if embeddedDB() == nil {
+		return ErrEmbeddedIsClosed
+	}
+	broker.publish(channel, message)
+	return nil
+}
+
+func (r *EmbeddedStorage) GetAndDeleteSet(keyName string) []interface{} {
+	var vals []string
+	err := r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		if v := load(b, key); v != nil && v.Kind == kindList {
+			vals = v.List
+		}
+		return b.Delete([]byte(key))
+	})
+	if err != nil {
+		log.Error("Multi command failed: ", err)
+		return nil
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	result := make([]interface{}, len(vals))
+	for i, v := range vals {
+		result[i] = v
+	}
+	return result
+}
+
+func (r *EmbeddedStorage) appendToList(keyName string, values ...string) error {
+	return r.batch(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := loadKind(b, key, kindList)
+		v.List = append(v.List, values...)
+		return store(b, key, v)
+	})
+}
+
+func (r *EmbeddedStorage) AppendToSet(keyName, value string) {
+	if err := r.appendToList(keyName, value); err != nil {
+		log.WithError(err).Error("Error trying to append to set keys")
+	}
+}
+
+// Exists check if keyName exists
+func (r *EmbeddedStorage) Exists(keyName string) (bool, error) {
+	exists := false
+	err := r.view(func(b *bolt.Bucket) error {
+		exists = load(b, r.fixKey(keyName)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// RemoveFromList delete an value from a list idetinfied with the keyName
+func (r *EmbeddedStorage) RemoveFromList(keyName, value string) error {
+	return r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := load(b, key)
+		if v == nil || v.Kind != kindList {
+			return nil
+		}
+		list := v.List[:0]
+		for _, item := range v.List {
+			if item != value {
+				list = append(list, item)
+			}
+		}
+		v.List = list
+		return store(b, key, v)
+	})
+}
+
+// listRange returns the bounds of the range from, to of a list of n
+// elements, negative indexes count from the end of the list.
+func listRange(n, from, to int64) (int64, int64) {
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to >= n {
+		to = n - 1
+	}
+	if from > to {
+		return 0, 0
+	}
+	return from, to + 1
+}
+
+// GetListRange gets range of elements of list identified by keyName, negative
+// indexes count from the end of the list
+func (r *EmbeddedStorage) GetListRange(keyName string, from, to int64) ([]string, error) {
+	var elements []string
+	err := r.view(func(b *bolt.Bucket) error {
+		v := load(b, r.fixKey(keyName))
+		if v == nil || v.Kind != kindList {
+			return nil
+		}
+		start, end := listRange(int64(len(v.List)), from, to)
+		elements = append(elements, v.List[start:end]...)
+		return nil
+	})
+	return elements, err
+}
+
+// TrimList keeps only the range of elements of the list identified by
+// keyName, the list is deleted when the range is empty
+func (r *EmbeddedStorage) TrimList(keyName string, from, to int64) error {
+	return r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := load(b, key)
+		if v == nil || v.Kind != kindList {
+			return nil
+		}
+		start, end := listRange(int64(len(v.List)), from, to)
+		if start == end {
+			return b.Delete([]byte(key))
+		}
+		v.List = v.List[start:end]
+		return store(b, key, v)
+	})
+}
+
+func (r *EmbeddedStorage) AppendToSetPipelined(key string, values [][]byte) {
+	if len(values) == 0 {
+		return
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = string(v)
+	}
+	if err := r.appendToList(key, strs...); err != nil {
+		log.WithError(err).Error("Error trying to append to set keys")
+		return
+	}
+
+	// if we need to set an expiration time
+	if storageExpTime := int64(config.Global().AnalyticsConfig.StorageExpirationTime); storageExpTime != int64(-1) {
+		if exp, _ := r.GetExp(key); exp == -1 {
+			r.SetExp(key, storageExpTime)
+		}
+	}
+}
+
+func (r *EmbeddedStorage) GetSet(keyName string) (map[string]string, error) {
+	result := make(map[string]string)
+	err := r.view(func(b *bolt.Bucket) error {
+		if v := load(b, r.fixKey(keyName)); v != nil && v.Kind == kindSet {
+			for i, member := range v.List {
+				result[strconv.Itoa(i)] = member
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *EmbeddedStorage) AddToSet(keyName, value string) {
+	err := r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := loadKind(b, key, kindSet)
+		i := sort.SearchStrings(v.List, value)
+		if i < len(v.List) && v.List[i] == value {
+			return nil
+		}
+		v.List = append(v.List, "")
+		copy(v.List[i+1:], v.List[i:])
+		v.List[i] = value
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.Error("Error trying to append keys: ", err)
+	}
+}
+
+func (r *EmbeddedStorage) RemoveFromSet(keyName, value string) {
+	err := r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := load(b, key)
+		if v == nil || v.Kind != kindSet {
+			return nil
+		}
+		i := sort.SearchStrings(v.List, value)
+		if i == len(v.List) || v.List[i] != value {
+			return nil
+		}
+		v.List = append(v.List[:i], v.List[i+1:]...)
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.Error("Error trying to remove keys: ", err)
+	}
+}
+
+func (r *EmbeddedStorage) IsMemberOfSet(keyName, value string) bool {
+	member := false
+	r.view(func(b *bolt.Bucket) error {
+		if v := load(b, r.fixKey(keyName)); v != nil && v.Kind == kindSet {
+			i := sort.SearchStrings(v.List, value)
+			member = i < len(v.List) && v.List[i] == value
+		}
+		return nil
+	})
+	return member
+}
+
+// rollingWindow drops the elements of the raw key older than per seconds and
+// returns the remaining ones, value is then added when it isn't empty.
+func (r *EmbeddedStorage) rollingWindow(keyName string, per int64, value string) (int, []interface{}) {
+	var result []interface{}
+	err := r.batch(func(b *bolt.Bucket) error {
+		result = result[:0]
+		now := time.Now()
+		v := loadKind(b, keyName, kindSortedSet)
+		v.Sorted = removeScoreRange(v.Sorted, math.Inf(-1), false, float64(now.Add(time.Duration(-per)*time.Second).UnixNano()), false)
+		for _, e := range v.Sorted {
+			result = append(result, e.Member)
+		}
+		if value == "" {
+			return store(b, keyName, v)
+		}
+		if value == "-1" {
+			value = strconv.Itoa(int(now.UnixNano()))
+		}
+		v.Sorted = addSorted(v.Sorted, value, float64(now.UnixNano()))
+		v.expire(per)
+		return store(b, keyName, v)
+	})
+	if err != nil {
+		log.Error("Multi command failed: ", err)
+		return 0, nil
+	}
+	return len(result), result
+}
+
+// SetRollingWindow will append to a sorted set and extract a timed window of values
+func (r *EmbeddedStorage) SetRollingWindow(keyName string, per int64, value_override string, pipeline bool) (int, []interface{}) {
+	return r.rollingWindow(keyName, per, value_override)
+}
+
+func (r *EmbeddedStorage) GetRollingWindow(keyName string, per int64, pipeline bool) (int, []interface{}) {
+	return r.rollingWindow(keyName, per, "")
+}
+
+// GetKeyPrefix returns storage key prefix
+func (r *EmbeddedStorage) GetKeyPrefix() string {
+	return r.KeyPrefix
+}
+
+// AddToSortedSet adds value with given score to sorted set identified by keyName
+func (r *EmbeddedStorage) AddToSortedSet(keyName, value string, score float64) {
+	err := r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := loadKind(b, key, kindSortedSet)
+		v.Sorted = addSorted(v.Sorted, value, score)
+		return store(b, key, v)
+	})
+	if err != nil {
+		log.WithError(err).Error("ZADD command failed")
+	}
+}
+
+// GetSortedSetRange gets range of elements of sorted set identified by keyName
+func (r *EmbeddedStorage) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]string, []float64, error) {
+	min, minExcl, err := parseScore(scoreFrom)
+	if err != nil {
+		return nil, nil, err
+	}
+	max, maxExcl, err := parseScore(scoreTo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		elements []string
+		scores   []float64
+	)
+	err = r.view(func(b *bolt.Bucket) error {
+		v := load(b, r.fixKey(keyName))
+		if v == nil || v.Kind != kindSortedSet {
+			return nil
+		}
+		for _, e := range v.Sorted {
+			if inScoreRange(e.Score, min, minExcl, max, maxExcl) {
+				elements = append(elements, e.Member)
+				scores = append(scores, e.Score)
+			}
+		}
+		return nil
+	})
+	return elements, scores, err
+}
+
+// RemoveSortedSetRange removes range of elements from sorted set identified by keyName
+func (r *EmbeddedStorage) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string) error {
+	min, minExcl, err := parseScore(scoreFrom)
+	if err != nil {
+		return err
+	}
+	max, maxExcl, err := parseScore(scoreTo)
+	if err != nil {
+		return err
+	}
+	return r.update(func(b *bolt.Bucket) error {
+		key := r.fixKey(keyName)
+		v := load(b, key)
+		if v == nil || v.Kind != kindSortedSet {
+			return nil
+		}
+		v.Sorted = removeScoreRange(v.Sorted, min, minExcl, max, maxExcl)
+		return store(b, key, v)
+	})
+}
+
+// addSorted sets the score of member, elements are ordered by score then
+// member like in Redis.
+func addSorted(set []sortedElement, member string, score float64) []sortedElement {
+	for i, e := range set {
+		if e.Member == member {
+			set = append(set[:i], set[i+1:]...)
+			break
+		}
+	}
+	i := sort.Search(len(set), func(i int) bool {
+		return set[i].Score > score || (set[i].Score == score && set[i].Member >= member)
+	})
+	set = append(set, sortedElement{})
+	copy(set[i+1:], set[i:])
+	set[i] = sortedElement{Member: member, Score: score}
+	return set
+}
+
+func removeScoreRange(set []sortedElement, min float64, minExcl bool, max float64, maxExcl bool) []sortedElement {
+	kept := set[:0]
+	for _, e := range set {
+		if !inScoreRange(e.Score, min, minExcl, max, maxExcl) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+func inScoreRange(score, min float64, minExcl bool, max float64, maxExcl bool) bool {
+	if score < min || (minExcl && score == min) {
+		return false
+	}
+	return score < max || (!maxExcl && score == max)
+}
+
+// parseScore parses a score bound of a sorted set range: a number, -inf or
+// +inf, prefixed with ( when the bound is exclusive.
+func parseScore(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch s {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err := strconv.ParseFloat(s, 64)
+	return score, exclusive, err
+}
+
+// embeddedBroker delivers the messages published on the embedded storage to
+// the subscribers of the same process.
+type embeddedBroker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan *redis.Message]struct{}
+}
+
+var broker = &embeddedBroker{subs: map[string]map[chan *redis.Message]struct{}{}}
+
+func (b *embeddedBroker) subscribe(channel string) chan *redis.Message {
+	ch := make(chan *redis.Message, 100)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[channel] == nil {
+		b.subs[channel] = map[chan *redis.Message]struct{}{}
+	}
+	b.subs[channel][ch] = struct{}{}
+	return ch
+}
+
+func (b *embeddedBroker) unsubscribe(channel string, ch chan *redis.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[channel][ch]; ok {
+		delete(b.subs[channel], ch)
+		close(ch)
+	}
+}
+
+func (b *embeddedBroker) publish(channel, payload string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[channel] {
+		select {
+		case ch <- &redis.Message{Channel: channel, Payload: payload}:
+		default:
+			log.Warning("Subscriber of ", channel, " is too slow, message dropped")
+		}
+	}
+}
+
+func (b *embeddedBroker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for channel, subs := range b.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(b.subs, channel)
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func openTestEmbedded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-embedded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := OpenEmbedded(filepath.Join(dir, "tyk.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseEmbedded()
+		os.RemoveAll(dir)
+	})
+}
+
+func TestEmbeddedKeys(t *testing.T) {
+	openTestEmbedded(t)
+
+	r := &EmbeddedStorage{KeyPrefix: "apikey-"}
+	if _, err := r.GetKey("first"); err != ErrKeyNotFound {
+		t.Errorf("expected %v got %v", ErrKeyNotFound, err)
+	}
+	if err := r.SetKey("first", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.GetKey("first"); err != nil || v != "value" {
+		t.Errorf("expected value got %q %v", v, err)
+	}
+	if v, err := r.GetRawKey("apikey-first"); err != nil || v != "value" {
+		t.Errorf("expected value got %q %v", v, err)
+	}
+	if _, err := r.GetMultiKey([]string{"missing", "first"}); err != nil {
+		t.Error(err)
+	}
+
+	if err := r.SetExp("first", 100); err != nil {
+		t.Fatal(err)
+	}
+	if exp, _ := r.GetExp("first"); exp <= 0 || exp > 100 {
+		t.Errorf("expected the key to expire in 100s, got %d", exp)
+	}
+
+	cache := &EmbeddedStorage{KeyPrefix: "apikey-", IsCache: true}
+	if _, err := cache.GetKey("first"); err != ErrKeyNotFound {
+		t.Error("the cache should not share keys with the main store")
+	}
+
+	if keys := r.GetKeys("fi"); len(keys) != 1 || keys[0] != "first" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if !r.DeleteScanMatch("apikey-f*") {
+		t.Error("expected keys to be deleted")
+	}
+	if ok, _ := r.Exists("first"); ok {
+		t.Error("expected the key to be deleted")
+	}
+
+	if v := r.IncrememntWithExpire("counter", 60); v != 1 {
+		t.Errorf("expected 1 got %d", v)
+	}
+	if v := r.IncrememntWithExpire("counter", 60); v != 2 {
+		t.Errorf("expected 2 got %d", v)
+	}
+	if exp, _ := r.GetExp("counter"); exp != -2 {
+		t.Error("raw keys should not be prefixed")
+	}
+	r.Decrement("counter")
+	if v, _ := r.GetKey("counter"); v != "-1" {
+		t.Errorf("expected -1 got %q", v)
+	}
+}
+
+func TestEmbeddedCollections(t *testing.T) {
+	openTestEmbedded(t)
+
+	r := &EmbeddedStorage{}
+	r.AppendToSet("list", "a")
+	r.AppendToSetPipelined("list", [][]byte{[]byte("b"), []byte("c")})
+	if vals, _ := r.GetListRange("list", 0, -1); len(vals) != 3 || vals[2] != "c" {
+		t.Errorf("unexpected list %v", vals)
+	}
+	if err := r.RemoveFromList("list", "b"); err != nil {
+		t.Fatal(err)
+	}
+	r.AppendToSet("list", "d")
+	if err := r.TrimList("list", -2, -1); err != nil {
+		t.Fatal(err)
+	}
+	if vals := r.GetAndDeleteSet("list"); len(vals) != 2 || vals[0].(string) != "c" || vals[1].(string) != "d" {
+		t.Errorf("unexpected list %v", vals)
+	}
+	if vals := r.GetAndDeleteSet("list"); len(vals) != 0 {
+		t.Errorf("expected the list to be deleted, got %v", vals)
+	}
+
+	r.AddToSet("set", "a")
+	r.AddToSet("set", "a")
+	r.AddToSet("set", "b")
+	r.RemoveFromSet("set", "b")
+	if set, _ := r.GetSet("set"); len(set) != 1 || !r.IsMemberOfSet("set", "a") {
+		t.Errorf("unexpected set %v", set)
+	}
+
+	r.AddToSortedSet("sorted", "b", 2)
+	r.AddToSortedSet("sorted", "a", 1)
+	r.AddToSortedSet("sorted", "c", 3)
+	values, scores, err := r.GetSortedSetRange("sorted", "(1", "+inf")
+	if err != nil || len(values) != 2 || values[0] != "b" || scores[1] != 3 {
+		t.Errorf("unexpected range %v %v %v", values, scores, err)
+	}
+	if err := r.RemoveSortedSetRange("sorted", "-inf", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if values, _, _ := r.GetSortedSetRange("sorted", "-inf", "+inf"); len(values) != 1 || values[0] != "c" {
+		t.Errorf("unexpected range %v", values)
+	}
+
+	for i := 0; i < 3; i++ {
+		r.SetRollingWindow("window", 10, strconv.Itoa(i), false)
+	}
+	if count, _ := r.GetRollingWindow("window", 10, false); count != 3 {
+		t.Errorf("expected 3 requests in the window, got %d", count)
+	}
+}
+
+func TestEmbeddedPubSub(t *testing.T) {
+	openTestEmbedded(t)
+
+	r := &EmbeddedStorage{}
+	received := make(chan interface{}, 2)
+	go r.StartPubSubHandler("channel", func(v interface{}) {
+		received <- v
+	})
+
+	select {
+	case v := <-received:
+		if _, ok := v.(*redis.Subscription); !ok {
+			t.Fatalf("expected a subscription, got %T", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription timed out")
+	}
+
+	if err := r.Publish("channel", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-received:
+		if msg, ok := v.(*redis.Message); !ok || msg.Payload != "hello" {
+			t.Errorf("unexpected message %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message timed out")
+	}
+}
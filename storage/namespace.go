@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var errSameNamespace = errors.New("storage: source and target namespaces are the same")
+
+// tykKeyPrefixes are the prefixes of the keys the gateway writes. Keys
+// written without a namespace are only moved when they have one of them, so
+// the keys of other namespaces and of other applications sharing the Redis
+// are left alone.
+var tykKeyPrefixes = []string{
+	"apikey-",
+	"orgkey.",
+	"quota-",
+	"rate-limit-",
+	"cache-",
+	"cert-",
+	"oauth-",
+	"apihealth.",
+	"analytics-",
+	"tyk-system-analytics",
+	"tyk-uptime-analytics",
+	"host-checker:",
+	"livenesscheck-",
+	"version-check-",
+	"webhook.",
+	"coprocess-data:",
+	"le_ssl:",
+	"rpc:",
+	"rpc.listener.",
+	"rpc-write-back-",
+	"rotated-keys",
+}
+
+func isTykKey(key string) bool {
+	for _, prefix := range tykKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateNamespace moves the Redis keys of the namespace from into the
+// namespace to, for the main storage and the separate cache storage when it
+// is enabled. An empty namespace stands for the keys written without one,
+// in that case only the keys with a Tyk key prefix are moved. Keys already
+// existing in the target namespace are not overwritten. It returns the
+// number of keys moved, or to be moved when dryRun is set.
+func MigrateNamespace(ctx context.Context, from, to string, dryRun bool) (int, error) {
+	if from == to {
+		return 0, errSameNamespace
+	}
+
+	moved, err := migrateNamespace(ctx, NewRedisClusterPool(false), from, to, dryRun)
+	if err != nil || !config.Global().EnableSeperateCacheStore {
+		return moved, err
+	}
+	n, err := migrateNamespace(ctx, NewRedisClusterPool(true), from, to, dryRun)
+	return moved + n, err
+}
+
+func migrateNamespace(ctx context.Context, client redis.UniversalClient, from, to string, dryRun bool) (int, error) {
+	defer client.Close()
+
+	pattern := "*"
+	if from != "" {
+		pattern = from + ":*"
+	}
+	keys, err := scanKeys(ctx, client, pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, key := range keys {
+		name := key
+		if from != "" {
+			name = strings.TrimPrefix(key, from+":")
+		} else if !isTykKey(key) {
+			continue
+		}
+		if to != "" {
+			name = to + ":" + name
+		}
+
+		log.WithField("key", key).Debug("Moving key to ", name)
+		if !dryRun {
+			ok, err := moveKey(ctx, client, key, name)
+			if err != nil {
+				return moved, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// moveKey renames a key with DUMP and RESTORE, as RENAME fails in cluster
+// mode when the names hash to different slots. It reports false when the key
+// expired since the scan or name already exists.
+func moveKey(ctx context.Context, client redis.UniversalClient, key, name string) (bool, error) {
+	value, err := client.Dump(ctx, key).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	ttl, err := client.PTTL(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case ttl == -2:
+		// expired between DUMP and PTTL
+		return false, nil
+	case ttl == -1:
+		// no expiry
+		ttl = 0
+	}
+	if err := client.Restore(ctx, name, ttl, value).Err(); err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			log.WithField("key", key).Warning("Not moved, the key already exists in the target namespace: ", name)
+			return false, nil
+		}
+		return false, err
+	}
+	return true, client.Del(ctx, key).Err()
+}
+
+func scanKeys(ctx context.Context, client redis.UniversalClient, pattern string) ([]string, error) {
+	fnScan := func(ctx context.Context, client *redis.Client) ([]string, error) {
+		var keys []string
+		iter := client.Scan(ctx, 0, pattern, 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		return keys, iter.Err()
+	}
+
+	switch v := client.(type) {
+	case *redis.ClusterClient:
+		var (
+			keys []string
+			mu   sync.Mutex
+		)
+		err := v.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			values, err := fnScan(ctx, client)
+			mu.Lock()
+			keys = append(keys, values...)
+			mu.Unlock()
+			return err
+		})
+		return keys, err
+	case *redis.Client:
+		return fnScan(ctx, v)
+	}
+	return nil, errors.New("storage: unsupported Redis client")
+}
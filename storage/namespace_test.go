@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestNamespaced(t *testing.T) {
+	defer config.SetGlobal(config.Global())
+
+	r := &RedisCluster{KeyPrefix: "apikey-"}
+	if key := r.fixKey("key"); key != "apikey-key" {
+		t.Errorf("expected no namespace, got %s", key)
+	}
+
+	globalConf := config.Global()
+	globalConf.Storage.Namespace = "staging"
+	config.SetGlobal(globalConf)
+
+	if key := r.fixKey("key"); key != "staging:apikey-key" {
+		t.Errorf("expected the key to be namespaced, got %s", key)
+	}
+	if key := r.cleanKey("staging:apikey-key"); key != "key" {
+		t.Errorf("expected the namespace to be removed, got %s", key)
+	}
+	if channel := Namespaced("tyk.cluster.notifications"); channel != "staging:tyk.cluster.notifications" {
+		t.Errorf("expected the channel to be namespaced, got %s", channel)
+	}
+}
+
+func TestMigrateNamespace(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisClusterPool(false)
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis is not available: ", err)
+	}
+
+	client.Set(ctx, "migrate-old:apikey-a", "a", 0)
+	client.Set(ctx, "migrate-old:quota-b", "b", time.Minute)
+	client.Set(ctx, "migrate-old:apikey-c", "old", 0)
+	client.Set(ctx, "migrate-new:apikey-c", "new", 0)
+	defer client.Del(ctx, "migrate-new:apikey-a", "migrate-new:quota-b", "migrate-old:apikey-a", "migrate-old:quota-b",
+		"migrate-old:apikey-c", "migrate-new:apikey-c")
+
+	if _, err := MigrateNamespace(ctx, "migrate", "migrate", false); err != errSameNamespace {
+		t.Errorf("expected %v got %v", errSameNamespace, err)
+	}
+
+	moved, err := MigrateNamespace(ctx, "migrate-old", "migrate-new", true)
+	if err != nil || moved != 3 {
+		t.Fatalf("expected 3 keys to move, got %d %v", moved, err)
+	}
+	if n := client.Exists(ctx, "migrate-new:apikey-a").Val(); n != 0 {
+		t.Error("no key should be moved in dry run")
+	}
+
+	moved, err = MigrateNamespace(ctx, "migrate-old", "migrate-new", false)
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 keys to be moved, got %d %v", moved, err)
+	}
+	if v := client.Get(ctx, "migrate-new:apikey-a").Val(); v != "a" {
+		t.Errorf("expected the key to be moved, got %q", v)
+	}
+	if ttl := client.TTL(ctx, "migrate-new:quota-b").Val(); ttl <= 0 {
+		t.Errorf("expected the expiry to be kept, got %v", ttl)
+	}
+	if n := client.Exists(ctx, "migrate-old:apikey-a", "migrate-old:quota-b").Val(); n != 0 {
+		t.Error("expected the old keys to be deleted")
+	}
+	if v := client.Get(ctx, "migrate-new:apikey-c").Val(); v != "new" {
+		t.Errorf("expected the existing key to be kept, got %q", v)
+	}
+	if v := client.Get(ctx, "migrate-old:apikey-c").Val(); v != "old" {
+		t.Errorf("expected the conflicting key to be left in place, got %q", v)
+	}
+}
+
+func TestIsTykKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"apikey-abc":                true,
+		"quota-abc":                 true,
+		"oauth-clientset.default":   true,
+		"tyk-system-analytics":      true,
+		"staging:apikey-abc":        false,
+		"sessions:abc":              false,
+		"rate-limit-abc":            true,
+		"some-other-application-id": false,
+	} {
+		if got := isTykKey(key); got != want {
+			t.Errorf("%s: expected %v got %v", key, want, got)
+		}
+	}
+}
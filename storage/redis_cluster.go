@@ -95,6 +95,15 @@ func singleton(cache bool) redis.UniversalClient {
 	return nil
 }
 
+// PoolStats returns the connection pool stats of the main or the cache Redis
+// client, nil when it is not connected.
+func PoolStats(cache bool) *redis.PoolStats {
+	if client := singleton(cache); client != nil {
+		return client.PoolStats()
+	}
+	return nil
+}
+
 func connectSingleton(cache bool) bool {
 	d := singleton(cache) == nil
 	if d {
@@ -114,6 +123,34 @@ type RedisCluster struct {
 	KeyPrefix string
 	HashKeys  bool
 	IsCache   bool
+
+	// ctx is passed to the redis commands, it carries the tracing span of
+	// the request when set with WithContext.
+	ctx context.Context
+}
+
+// WithContext returns a copy of r issuing its commands with ctx, so they are
+// traced as part of the request ctx belongs to.
+func (r *RedisCluster) WithContext(ctx context.Context) *RedisCluster {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+func (r *RedisCluster) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return ctx
+}
+
+// WithContext returns a copy of h bound to ctx when h supports it, h is
+// returned as is otherwise.
+func WithContext(h Handler, ctx context.Context) Handler {
+	if r, ok := h.(*RedisCluster); ok {
+		return r.WithContext(ctx)
+	}
+	return h
 }
 
 func clusterConnectionIsOpen(cluster *RedisCluster) bool {
@@ -244,6 +281,8 @@ func NewRedisClusterPool(isCache bool) redis.UniversalClient {
 		client = redis.NewClient(opts.Simple())
 	}
 
+	client.AddHook(tracingHook{})
+
 	return client
 }
 
@@ -285,11 +324,19 @@ func (r *RedisCluster) hashKey(in string) string {
 }
 
 func (r *RedisCluster) fixKey(keyName string) string {
-	return r.KeyPrefix + r.hashKey(keyName)
+	return Namespaced(r.KeyPrefix + r.hashKey(keyName))
 }
 
 func (r *RedisCluster) cleanKey(keyName string) string {
-	return strings.Replace(keyName, r.KeyPrefix, "", 1)
+	return strings.Replace(keyName, Namespaced(r.KeyPrefix), "", 1)
+}
+
+// Namespaced prefixes a raw key or channel with the global key namespace.
+func Namespaced(key string) string {
+	if ns := config.Global().Storage.Namespace; ns != "" {
+		return ns + ":" + key
+	}
+	return key
 }
 
 func (r *RedisCluster) up() error {
@@ -306,7 +353,7 @@ func (r *RedisCluster) GetKey(keyName string) (string, error) {
 	}
 	cluster := r.singleton()
 
-	value, err := cluster.Get(ctx, r.fixKey(keyName)).Result()
+	value, err := cluster.Get(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
 		return "", ErrKeyNotFound
@@ -335,9 +382,9 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 			getCmds := make([]*redis.StringCmd, 0)
 			pipe := v.Pipeline()
 			for _, key := range keyNames {
-				getCmds = append(getCmds, pipe.Get(ctx, key))
+				getCmds = append(getCmds, pipe.Get(r.context(), key))
 			}
-			_, err := pipe.Exec(ctx)
+			_, err := pipe.Exec(r.context())
 			if err != nil && err != redis.Nil {
 				log.WithError(err).Debug("Error trying to get value")
 				return nil, ErrKeyNotFound
@@ -348,7 +395,7 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 		}
 	case *redis.Client:
 		{
-			values, err := cluster.MGet(ctx, keyNames...).Result()
+			values, err := cluster.MGet(r.context(), keyNames...).Result()
 			if err != nil {
 				log.WithError(err).Debug("Error trying to get value")
 				return nil, ErrKeyNotFound
@@ -376,7 +423,7 @@ func (r *RedisCluster) GetKeyTTL(keyName string) (ttl int64, err error) {
 	if err = r.up(); err != nil {
 		return 0, err
 	}
-	duration, err := r.singleton().TTL(ctx, r.fixKey(keyName)).Result()
+	duration, err := r.singleton().TTL(r.context(), r.fixKey(keyName)).Result()
 	return int64(duration.Seconds()), err
 }
 
@@ -384,7 +431,7 @@ func (r *RedisCluster) GetRawKey(keyName string) (string, error) {
 	if err := r.up(); err != nil {
 		return "", err
 	}
-	value, err := r.singleton().Get(ctx, keyName).Result()
+	value, err := r.singleton().Get(r.context(), Namespaced(keyName)).Result()
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
 		return "", ErrKeyNotFound
@@ -399,7 +446,7 @@ func (r *RedisCluster) GetExp(keyName string) (int64, error) {
 		return 0, err
 	}
 
-	value, err := r.singleton().TTL(ctx, r.fixKey(keyName)).Result()
+	value, err := r.singleton().TTL(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Error("Error trying to get TTL: ", err)
 		return 0, ErrKeyNotFound
@@ -411,7 +458,7 @@ func (r *RedisCluster) SetExp(keyName string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Expire(ctx, r.fixKey(keyName), time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Expire(r.context(), r.fixKey(keyName), time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Could not EXPIRE key: ", err)
 	}
@@ -426,7 +473,7 @@ func (r *RedisCluster) SetKey(keyName, session string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Set(ctx, r.fixKey(keyName), session, time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Set(r.context(), r.fixKey(keyName), session, time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Error trying to set value: ", err)
 		return err
@@ -438,7 +485,7 @@ func (r *RedisCluster) SetRawKey(keyName, session string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Set(ctx, keyName, session, time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Set(r.context(), Namespaced(keyName), session, time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Error trying to set value: ", err)
 		return err
@@ -454,7 +501,7 @@ func (r *RedisCluster) Decrement(keyName string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().Decr(ctx, keyName).Err()
+	err := r.singleton().Decr(r.context(), keyName).Err()
 	if err != nil {
 		log.Error("Error trying to decrement value:", err)
 	}
@@ -468,8 +515,8 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 		return 0
 	}
 	// This function uses a raw key, so we shouldn't call fixKey
-	fixedKey := keyName
-	val, err := r.singleton().Incr(ctx, fixedKey).Result()
+	fixedKey := Namespaced(keyName)
+	val, err := r.singleton().Incr(r.context(), fixedKey).Result()
 
 	if err != nil {
 		log.Error("Error trying to increment value:", err)
@@ -479,7 +526,7 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 
 	if val == 1 && expire > 0 {
 		log.Debug("--> Setting Expire")
-		r.singleton().Expire(ctx, fixedKey, time.Duration(expire)*time.Second)
+		r.singleton().Expire(r.context(), fixedKey, time.Duration(expire)*time.Second)
 	}
 
 	return val
@@ -497,14 +544,14 @@ func (r *RedisCluster) GetKeys(filter string) []string {
 	if filter != "" {
 		filterHash = r.hashKey(filter)
 	}
-	searchStr := r.KeyPrefix + filterHash + "*"
+	searchStr := Namespaced(r.KeyPrefix + filterHash + "*")
 	log.Debug("[STORE] Getting list by: ", searchStr)
 
 	fnFetchKeys := func(client *redis.Client) ([]string, error) {
 		values := make([]string, 0)
 
-		iter := client.Scan(ctx, 0, searchStr, 0).Iterator()
-		for iter.Next(ctx) {
+		iter := client.Scan(r.context(), 0, searchStr, 0).Iterator()
+		for iter.Next(r.context()) {
 			values = append(values, iter.Val())
 		}
 
@@ -571,7 +618,7 @@ func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]stri
 	}
 
 	for i, v := range keys {
-		keys[i] = r.KeyPrefix + v
+		keys[i] = Namespaced(r.KeyPrefix + v)
 	}
 
 	client := r.singleton()
@@ -583,9 +630,9 @@ func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]stri
 			getCmds := make([]*redis.StringCmd, 0)
 			pipe := v.Pipeline()
 			for _, key := range keys {
-				getCmds = append(getCmds, pipe.Get(ctx, key))
+				getCmds = append(getCmds, pipe.Get(r.context(), key))
 			}
-			_, err := pipe.Exec(ctx)
+			_, err := pipe.Exec(r.context())
 			if err != nil && err != redis.Nil {
 				log.Error("Error trying to get client keys: ", err)
 				return nil
@@ -597,7 +644,7 @@ func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]stri
 		}
 	case *redis.Client:
 		{
-			result, err := v.MGet(ctx, keys...).Result()
+			result, err := v.MGet(r.context(), keys...).Result()
 			if err != nil {
 				log.Error("Error trying to get client keys: ", err)
 				return nil
@@ -635,7 +682,7 @@ func (r *RedisCluster) DeleteKey(keyName string) bool {
 	}
 	log.Debug("DEL Key was: ", keyName)
 	log.Debug("DEL Key became: ", r.fixKey(keyName))
-	n, err := r.singleton().Del(ctx, r.fixKey(keyName)).Result()
+	n, err := r.singleton().Del(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete key")
 	}
@@ -649,7 +696,11 @@ func (r *RedisCluster) DeleteAllKeys() bool {
 		log.Debug(err)
 		return false
 	}
-	n, err := r.singleton().FlushAll(ctx).Result()
+	if config.Global().Storage.Namespace != "" {
+		// Other clusters may share the database, only drop our keys.
+		return r.DeleteScanMatch("*")
+	}
+	n, err := r.singleton().FlushAll(r.context()).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete keys")
 	}
@@ -667,7 +718,7 @@ func (r *RedisCluster) DeleteRawKey(keyName string) bool {
 		log.Debug(err)
 		return false
 	}
-	n, err := r.singleton().Del(ctx, keyName).Result()
+	n, err := r.singleton().Del(r.context(), Namespaced(keyName)).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete key")
 	}
@@ -682,13 +733,14 @@ func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 		return false
 	}
 	client := r.singleton()
+	pattern = Namespaced(pattern)
 	log.Debug("Deleting: ", pattern)
 
 	fnScan := func(client *redis.Client) ([]string, error) {
 		values := make([]string, 0)
 
-		iter := client.Scan(ctx, 0, pattern, 0).Iterator()
-		for iter.Next(ctx) {
+		iter := client.Scan(r.context(), 0, pattern, 0).Iterator()
+		for iter.Next(r.context()) {
 			values = append(values, iter.Val())
 		}
 
@@ -733,7 +785,7 @@ func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 	if len(keys) > 0 {
 		for _, name := range keys {
 			log.Info("Deleting: ", name)
-			err := client.Del(ctx, name).Err()
+			err := client.Del(r.context(), name).Err()
 			if err != nil {
 				log.Error("Error trying to delete key: ", name, " - ", err)
 			}
@@ -764,16 +816,16 @@ func (r *RedisCluster) DeleteKeys(keys []string) bool {
 			{
 				pipe := v.Pipeline()
 				for _, k := range keys {
-					pipe.Del(ctx, k)
+					pipe.Del(r.context(), k)
 				}
 
-				if _, err := pipe.Exec(ctx); err != nil {
+				if _, err := pipe.Exec(r.context()); err != nil {
 					log.Error("Error trying to delete keys:", err)
 				}
 			}
 		case *redis.Client:
 			{
-				_, err := v.Del(ctx, keys...).Result()
+				_, err := v.Del(r.context(), keys...).Result()
 				if err != nil {
 					log.Error("Error trying to delete keys: ", err)
 				}
@@ -797,20 +849,22 @@ func (r *RedisCluster) StartPubSubHandler(channel string, callback func(interfac
 		return errors.New("Redis connection failed")
 	}
 
-	pubsub := client.Subscribe(ctx, channel)
+	pubsub := client.Subscribe(r.context(), Namespaced(channel))
 	defer pubsub.Close()
 
 	for {
-		msg, err := pubsub.Receive(ctx)
+		msg, err := pubsub.Receive(r.context())
 		if err != nil {
 			log.Error("Error while receiving pubsub message:", err)
 			return err
 		}
 		switch v := msg.(type) {
 		case *redis.Message:
+			v.Channel = channel
 			callback(v)
 
 		case *redis.Subscription:
+			v.Channel = channel
 			callback(v)
 
 		case error:
@@ -824,7 +878,7 @@ func (r *RedisCluster) Publish(channel, message string) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Publish(ctx, channel, message).Err()
+	err := r.singleton().Publish(r.context(), Namespaced(channel), message).Err()
 	if err != nil {
 		log.Error("Error trying to set value: ", err)
 		return err
@@ -845,9 +899,9 @@ func (r *RedisCluster) GetAndDeleteSet(keyName string) []interface{} {
 	client := r.singleton()
 
 	var lrange *redis.StringSliceCmd
-	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-		lrange = pipe.LRange(ctx, fixedKey, 0, -1)
-		pipe.Del(ctx, fixedKey)
+	_, err := client.TxPipelined(r.context(), func(pipe redis.Pipeliner) error {
+		lrange = pipe.LRange(r.context(), fixedKey, 0, -1)
+		pipe.Del(r.context(), fixedKey)
 		return nil
 	})
 	if err != nil {
@@ -878,7 +932,7 @@ func (r *RedisCluster) AppendToSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	if err := r.singleton().RPush(ctx, fixedKey, value).Err(); err != nil {
+	if err := r.singleton().RPush(r.context(), fixedKey, value).Err(); err != nil {
 		log.WithError(err).Error("Error trying to append to set keys")
 	}
 }
@@ -888,7 +942,7 @@ func (r *RedisCluster) Exists(keyName string) (bool, error) {
 	fixedKey := r.fixKey(keyName)
 	log.WithField("keyName", fixedKey).Debug("Checking if exists")
 
-	exists, err := r.singleton().Exists(ctx, fixedKey).Result()
+	exists, err := r.singleton().Exists(r.context(), fixedKey).Result()
 	if err != nil {
 		log.Error("Error trying to check if key exists: ", err)
 		return false, err
@@ -909,7 +963,7 @@ func (r *RedisCluster) RemoveFromList(keyName, value string) error {
 	}
 	log.WithFields(logEntry).Debug("Removing value from list")
 
-	if err := r.singleton().LRem(ctx, fixedKey, 0, value).Err(); err != nil {
+	if err := r.singleton().LRem(r.context(), fixedKey, 0, value).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("LREM command failed")
 		return err
 	}
@@ -917,6 +971,25 @@ func (r *RedisCluster) RemoveFromList(keyName, value string) error {
 	return nil
 }
 
+// TrimList keeps only the range of elements of the list identified by keyName
+func (r *RedisCluster) TrimList(keyName string, from, to int64) error {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"from":     from,
+		"to":       to,
+	}
+	log.WithFields(logEntry).Debug("Trimming list")
+
+	if err := r.singleton().LTrim(r.context(), fixedKey, from, to).Err(); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("LTRIM command failed")
+		return err
+	}
+
+	return nil
+}
+
 // GetListRange gets range of elements of list identified by keyName
 func (r *RedisCluster) GetListRange(keyName string, from, to int64) ([]string, error) {
 	fixedKey := r.fixKey(keyName)
@@ -928,7 +1001,7 @@ func (r *RedisCluster) GetListRange(keyName string, from, to int64) ([]string, e
 	}
 	log.WithFields(logEntry).Debug("Getting list range")
 
-	elements, err := r.singleton().LRange(ctx, fixedKey, from, to).Result()
+	elements, err := r.singleton().LRange(r.context(), fixedKey, from, to).Result()
 	if err != nil {
 		log.WithFields(logEntry).WithError(err).Error("LRANGE command failed")
 		return nil, err
@@ -951,10 +1024,10 @@ func (r *RedisCluster) AppendToSetPipelined(key string, values [][]byte) {
 
 	pipe := client.Pipeline()
 	for _, val := range values {
-		pipe.RPush(ctx, fixedKey, val)
+		pipe.RPush(r.context(), fixedKey, val)
 	}
 
-	if _, err := pipe.Exec(ctx); err != nil {
+	if _, err := pipe.Exec(r.context()); err != nil {
 		log.WithError(err).Error("Error trying to append to set keys")
 	}
 
@@ -974,7 +1047,7 @@ func (r *RedisCluster) GetSet(keyName string) (map[string]string, error) {
 	if err := r.up(); err != nil {
 		return nil, err
 	}
-	val, err := r.singleton().SMembers(ctx, r.fixKey(keyName)).Result()
+	val, err := r.singleton().SMembers(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Error("Error trying to get key set:", err)
 		return nil, err
@@ -995,7 +1068,7 @@ func (r *RedisCluster) AddToSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().SAdd(ctx, r.fixKey(keyName), value).Err()
+	err := r.singleton().SAdd(r.context(), r.fixKey(keyName), value).Err()
 	if err != nil {
 		log.Error("Error trying to append keys: ", err)
 	}
@@ -1008,7 +1081,7 @@ func (r *RedisCluster) RemoveFromSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().SRem(ctx, r.fixKey(keyName), value).Err()
+	err := r.singleton().SRem(r.context(), r.fixKey(keyName), value).Err()
 	if err != nil {
 		log.Error("Error trying to remove keys: ", err)
 	}
@@ -1019,7 +1092,7 @@ func (r *RedisCluster) IsMemberOfSet(keyName, value string) bool {
 		log.Debug(err)
 		return false
 	}
-	val, err := r.singleton().SIsMember(ctx, r.fixKey(keyName), value).Result()
+	val, err := r.singleton().SIsMember(r.context(), r.fixKey(keyName), value).Result()
 
 	if err != nil {
 		log.Error("Error trying to check set memeber: ", err)
@@ -1038,6 +1111,7 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 		log.Debug(err)
 		return 0, nil
 	}
+	keyName = Namespaced(keyName)
 	log.Debug("keyName is: ", keyName)
 	now := time.Now()
 	log.Debug("Now is:", now)
@@ -1048,8 +1122,8 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 	var zrange *redis.StringSliceCmd
 
 	pipeFn := func(pipe redis.Pipeliner) error {
-		pipe.ZRemRangeByScore(ctx, keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
-		zrange = pipe.ZRange(ctx, keyName, 0, -1)
+		pipe.ZRemRangeByScore(r.context(), keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
+		zrange = pipe.ZRange(r.context(), keyName, 0, -1)
 
 		element := redis.Z{
 			Score: float64(now.UnixNano()),
@@ -1061,17 +1135,17 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 			element.Member = strconv.Itoa(int(now.UnixNano()))
 		}
 
-		pipe.ZAdd(ctx, keyName, &element)
-		pipe.Expire(ctx, keyName, time.Duration(per)*time.Second)
+		pipe.ZAdd(r.context(), keyName, &element)
+		pipe.Expire(r.context(), keyName, time.Duration(per)*time.Second)
 
 		return nil
 	}
 
 	var err error
 	if pipeline {
-		_, err = client.Pipelined(ctx, pipeFn)
+		_, err = client.Pipelined(r.context(), pipeFn)
 	} else {
-		_, err = client.TxPipelined(ctx, pipeFn)
+		_, err = client.TxPipelined(r.context(), pipeFn)
 	}
 
 	if err != nil {
@@ -1103,6 +1177,7 @@ func (r RedisCluster) GetRollingWindow(keyName string, per int64, pipeline bool)
 		log.Debug(err)
 		return 0, nil
 	}
+	keyName = Namespaced(keyName)
 	now := time.Now()
 	onePeriodAgo := now.Add(time.Duration(-1*per) * time.Second)
 
@@ -1110,17 +1185,17 @@ func (r RedisCluster) GetRollingWindow(keyName string, per int64, pipeline bool)
 	var zrange *redis.StringSliceCmd
 
 	pipeFn := func(pipe redis.Pipeliner) error {
-		pipe.ZRemRangeByScore(ctx, keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
-		zrange = pipe.ZRange(ctx, keyName, 0, -1)
+		pipe.ZRemRangeByScore(r.context(), keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
+		zrange = pipe.ZRange(r.context(), keyName, 0, -1)
 
 		return nil
 	}
 
 	var err error
 	if pipeline {
-		_, err = client.Pipelined(ctx, pipeFn)
+		_, err = client.Pipelined(r.context(), pipeFn)
 	} else {
-		_, err = client.TxPipelined(ctx, pipeFn)
+		_, err = client.TxPipelined(r.context(), pipeFn)
 	}
 	if err != nil {
 		log.Error("Multi command failed: ", err)
@@ -1164,7 +1239,7 @@ func (r *RedisCluster) AddToSortedSet(keyName, value string, score float64) {
 		return
 	}
 	member := redis.Z{Score: score, Member: value}
-	if err := r.singleton().ZAdd(ctx, fixedKey, &member).Err(); err != nil {
+	if err := r.singleton().ZAdd(r.context(), fixedKey, &member).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZADD command failed")
 	}
 }
@@ -1181,7 +1256,7 @@ func (r *RedisCluster) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]
 	log.WithFields(logEntry).Debug("Getting sorted set range")
 
 	args := redis.ZRangeBy{Min: scoreFrom, Max: scoreTo}
-	values, err := r.singleton().ZRangeByScoreWithScores(ctx, fixedKey, &args).Result()
+	values, err := r.singleton().ZRangeByScoreWithScores(r.context(), fixedKey, &args).Result()
 	if err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYSCORE command failed")
 		return nil, nil, err
@@ -1213,7 +1288,7 @@ func (r *RedisCluster) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string)
 	}
 	log.WithFields(logEntry).Debug("Removing sorted set range")
 
-	if err := r.singleton().ZRemRangeByScore(ctx, fixedKey, scoreFrom, scoreTo).Err(); err != nil {
+	if err := r.singleton().ZRemRangeByScore(r.context(), fixedKey, scoreFrom, scoreTo).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZREMRANGEBYSCORE command failed")
 		return err
 	}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/TykTechnologies/tyk/trace"
+)
+
+// tracingHook records a span for every redis command issued with a context
+// that already carries a span, that is the commands run on behalf of a traced
+// request.
+type tracingHook struct{}
+
+type tracingSpanKey struct{}
+
+func (tracingHook) start(ctx context.Context, name string, statement string) context.Context {
+	if !trace.IsEnabled() || opentracing.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+	span, ctx := trace.Span(ctx, name)
+	ext.DBType.Set(span, "redis")
+	ext.DBStatement.Set(span, statement)
+	ext.SpanKindRPCClient.Set(span)
+	return context.WithValue(ctx, tracingSpanKey{}, span)
+}
+
+func (tracingHook) finish(ctx context.Context, err error) {
+	span, ok := ctx.Value(tracingSpanKey{}).(opentracing.Span)
+	if !ok {
+		return
+	}
+	if err != nil && err != redis.Nil {
+		ext.Error.Set(span, true)
+		span.SetTag("error.message", err.Error())
+	}
+	span.Finish()
+}
+
+func (h tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis "+cmd.Name(), cmd.Name()), nil
+}
+
+func (h tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.finish(ctx, cmd.Err())
+	return nil
+}
+
+func (h tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	statement := ""
+	for i, cmd := range cmds {
+		if i > 0 {
+			statement += " "
+		}
+		statement += cmd.Name()
+	}
+	return h.start(ctx, "redis pipeline", statement), nil
+}
+
+func (h tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			h.finish(ctx, err)
+			return nil
+		}
+	}
+	h.finish(ctx, nil)
+	return nil
+}
@@ -55,10 +55,49 @@ type Handler interface {
 	RemoveSortedSetRange(string, string, string) error
 	GetListRange(string, int64, int64) ([]string, error)
 	RemoveFromList(string, string) error
+	TrimList(string, int64, int64) error
 	AppendToSet(string, string)
 	Exists(string) (bool, error)
 }
 
+// PubSub is implemented by the storage handlers delivering notifications.
+type PubSub interface {
+	StartPubSubHandler(string, func(interface{})) error
+	Publish(string, string) error
+}
+
+// backend is implemented by the storage managers the gateway can run on.
+type backend interface {
+	Handler
+	AnalyticsHandler
+	PubSub
+}
+
+func newBackend(keyPrefix string, hashKeys, isCache bool) backend {
+	if config.Global().Storage.Type == EmbeddedType {
+		return &EmbeddedStorage{KeyPrefix: keyPrefix, HashKeys: hashKeys, IsCache: isCache}
+	}
+	return &RedisCluster{KeyPrefix: keyPrefix, HashKeys: hashKeys, IsCache: isCache}
+}
+
+// New returns a handler of the configured storage backend, Redis or the
+// embedded database.
+func New(keyPrefix string, hashKeys, isCache bool) Handler {
+	return newBackend(keyPrefix, hashKeys, isCache)
+}
+
+// NewAnalytics returns an analytics handler of the configured storage
+// backend.
+func NewAnalytics(keyPrefix string) AnalyticsHandler {
+	return newBackend(keyPrefix, false, false)
+}
+
+// NewPubSub returns the notification channel of the configured storage
+// backend.
+func NewPubSub() PubSub {
+	return newBackend("", false, false)
+}
+
 type AnalyticsHandler interface {
 	Connect() bool
 	AppendToSetPipelined(string, [][]byte)
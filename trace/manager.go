@@ -12,6 +12,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/request"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 // ErrManagerDisabled is returned when trying to use global trace manager when
@@ -162,6 +163,8 @@ func Root(service string, r *http.Request) (opentracing.Span, *http.Request) {
 		"endpoint": r.URL.Path,
 		"raw_url":  r.URL.String(),
 		"size":     strconv.Itoa(int(r.ContentLength)),
+
+		string(ext.SpanKind): ext.SpanKindRPCServerEnum,
 	}
 	if err != nil {
 		// TODO log this error?
@@ -0,0 +1,36 @@
+package opentelemetry
+
+import (
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	defaultGRPCEndpoint = "localhost:4317"
+	defaultHTTPEndpoint = "http://localhost:4318"
+	defaultTimeout      = 10
+	defaultBatchSize    = 512
+)
+
+// Load returns opentelemetry configuration from opts with defaults applied.
+func Load(opts map[string]interface{}) (*config.OpenTelemetryConfig, error) {
+	var c config.OpenTelemetryConfig
+	if err := config.DecodeJSON(&c, opts); err != nil {
+		return nil, err
+	}
+	if c.Exporter == "" {
+		c.Exporter = "grpc"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = defaultGRPCEndpoint
+		if c.Exporter == "http" {
+			c.Endpoint = defaultHTTPEndpoint
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	return &c, nil
+}
@@ -0,0 +1,358 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	flushInterval = 5 * time.Second
+	queueSize     = 2048
+
+	exportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	tracesPath   = "/v1/traces"
+)
+
+// exporter sends an encoded ExportTraceServiceRequest to a collector.
+type exporter interface {
+	export(ctx context.Context, payload []byte) error
+	close() error
+}
+
+func newExporter(c *config.OpenTelemetryConfig) (exporter, error) {
+	switch c.Exporter {
+	case "grpc":
+		return newGRPCExporter(c)
+	case "http":
+		return newHTTPExporter(c)
+	}
+	return nil, fmt.Errorf("opentelemetry: unknown exporter %s", c.Exporter)
+}
+
+// rawCodec passes already encoded protobuf messages through grpc, it is
+// registered under the proto name so collectors accept the content type.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = data
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+}
+
+func newGRPCExporter(c *config.OpenTelemetryConfig) (*grpcExporter, error) {
+	creds := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	if c.Insecure {
+		creds = grpc.WithInsecure()
+	}
+	conn, err := grpc.Dial(c.Endpoint, creds)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcExporter{conn: conn, headers: metadata.New(c.Headers)}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, payload []byte) error {
+	var reply []byte
+	ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	return e.conn.Invoke(ctx, exportMethod, &payload, &reply, grpc.ForceCodec(rawCodec{}))
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+type httpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPExporter(c *config.OpenTelemetryConfig) (*httpExporter, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+	return &httpExporter{url: u.String(), headers: c.Headers, client: &http.Client{}}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("opentelemetry: collector responded with %s", res.Status)
+	}
+	return nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// batcher collects finished spans and exports them in batches, either when a
+// batch is full or periodically.
+type batcher struct {
+	service string
+	exp     exporter
+	size    int
+	timeout time.Duration
+	logger  Logger
+
+	spans     chan *Span
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newBatcher(service string, exp exporter, size int, timeout time.Duration, logger Logger) *batcher {
+	b := &batcher{
+		service: service,
+		exp:     exp,
+		size:    size,
+		timeout: timeout,
+		logger:  logger,
+		spans:   make(chan *Span, queueSize),
+		done:    make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// add queues a finished span, spans are dropped when the queue is full so
+// tracing never blocks requests.
+func (b *batcher) add(s *Span) {
+	select {
+	case b.spans <- s:
+	default:
+	}
+}
+
+func (b *batcher) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, b.size)
+	for {
+		select {
+		case s := <-b.spans:
+			batch = append(batch, s)
+			if len(batch) >= b.size {
+				batch = b.flush(batch)
+			}
+		case <-ticker.C:
+			batch = b.flush(batch)
+		case <-b.done:
+			for {
+				select {
+				case s := <-b.spans:
+					batch = append(batch, s)
+					if len(batch) >= b.size {
+						batch = b.flush(batch)
+					}
+				default:
+					b.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *batcher) flush(batch []*Span) []*Span {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	if err := b.exp.export(ctx, encodeSpans(b.service, batch)); err != nil && b.logger != nil {
+		b.logger.Errorf("opentelemetry: failed to export %d spans: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+func (b *batcher) close() error {
+	err := error(nil)
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+		err = b.exp.close()
+	})
+	return err
+}
+
+// encodeSpans encodes spans as an OTLP ExportTraceServiceRequest, see
+// https://github.com/open-telemetry/opentelemetry-proto
+func encodeSpans(service string, spans []*Span) []byte {
+	var resource []byte
+	resource = appendKeyValue(resource, 1, "service.name", service)
+
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendBytes(scope, protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "tyk"))
+	for _, s := range spans {
+		scope = protowire.AppendTag(scope, 2, protowire.BytesType)
+		scope = protowire.AppendBytes(scope, encodeSpan(s))
+	}
+
+	var resourceSpans []byte
+	resourceSpans = protowire.AppendTag(resourceSpans, 1, protowire.BytesType)
+	resourceSpans = protowire.AppendBytes(resourceSpans, resource)
+	resourceSpans = protowire.AppendTag(resourceSpans, 2, protowire.BytesType)
+	resourceSpans = protowire.AppendBytes(resourceSpans, scope)
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	return protowire.AppendBytes(req, resourceSpans)
+}
+
+func encodeSpan(s *Span) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.ctx.traceID[:])
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.ctx.spanID[:])
+	if s.ctx.traceState != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, s.ctx.traceState)
+	}
+	if s.parentID != [8]byte{} {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.parentID[:])
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendString(b, s.name)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.kind))
+	b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.start.UnixNano()))
+	b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.end.UnixNano()))
+	for k, v := range s.attributes {
+		b = appendKeyValue(b, 9, k, v)
+	}
+	for _, e := range s.events {
+		var ev []byte
+		ev = protowire.AppendTag(ev, 1, protowire.Fixed64Type)
+		ev = protowire.AppendFixed64(ev, uint64(e.time.UnixNano()))
+		ev = protowire.AppendTag(ev, 2, protowire.BytesType)
+		ev = protowire.AppendString(ev, e.name)
+		for k, v := range e.attributes {
+			ev = appendKeyValue(ev, 3, k, v)
+		}
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, ev)
+	}
+	if s.failed {
+		var status []byte
+		status = protowire.AppendTag(status, 3, protowire.VarintType)
+		status = protowire.AppendVarint(status, statusError)
+		b = protowire.AppendTag(b, 15, protowire.BytesType)
+		b = protowire.AppendBytes(b, status)
+	}
+	return b
+}
+
+// appendKeyValue appends a KeyValue message as field num of the message in b.
+func appendKeyValue(b []byte, num protowire.Number, key string, value interface{}) []byte {
+	var val []byte
+	switch v := value.(type) {
+	case string:
+		val = protowire.AppendTag(val, 1, protowire.BytesType)
+		val = protowire.AppendString(val, v)
+	case bool:
+		val = protowire.AppendTag(val, 2, protowire.VarintType)
+		val = protowire.AppendVarint(val, protowire.EncodeBool(v))
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		val = protowire.AppendTag(val, 3, protowire.VarintType)
+		val = protowire.AppendVarint(val, uint64(toInt64(v)))
+	case float32:
+		val = protowire.AppendTag(val, 4, protowire.Fixed64Type)
+		val = protowire.AppendFixed64(val, math.Float64bits(float64(v)))
+	case float64:
+		val = protowire.AppendTag(val, 4, protowire.Fixed64Type)
+		val = protowire.AppendFixed64(val, math.Float64bits(v))
+	default:
+		val = protowire.AppendTag(val, 1, protowire.BytesType)
+		val = protowire.AppendString(val, fmt.Sprint(v))
+	}
+
+	var kv []byte
+	kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+	kv = protowire.AppendString(kv, key)
+	kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, val)
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, kv)
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,367 @@
+package opentelemetry
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+var _ opentracing.Tracer = (*otelTracer)(nil)
+var _ opentracing.SpanContext = spanContext{}
+var _ opentracing.Span = (*Span)(nil)
+
+// Name is the name of this tracer.
+const Name = "opentelemetry"
+
+// W3C trace context headers, see https://www.w3.org/TR/trace-context/
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// OTLP span kinds.
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+	kindProducer = 4
+	kindConsumer = 5
+)
+
+const statusError = 2
+
+type spanContext struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	sampled    bool
+	traceState string
+}
+
+func (spanContext) ForeachBaggageItem(handler func(k, v string) bool) {}
+
+type event struct {
+	time       time.Time
+	name       string
+	attributes map[string]interface{}
+}
+
+// Span is an opentracing.Span recorded in the OpenTelemetry data model.
+type Span struct {
+	tr *otelTracer
+
+	mu         sync.Mutex
+	ctx        spanContext
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	events     []event
+	failed     bool
+	finished   bool
+}
+
+func (s *Span) Context() opentracing.SpanContext {
+	return s.ctx
+}
+
+func (s *Span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *Span) FinishWithOptions(opts opentracing.FinishOptions) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.end = opts.FinishTime
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	for _, lr := range opts.LogRecords {
+		s.addEvent(lr.Timestamp, lr.Fields)
+	}
+	s.mu.Unlock()
+
+	if s.ctx.sampled {
+		s.tr.batcher.add(s)
+	}
+}
+
+func (s *Span) SetOperationName(operationName string) opentracing.Span {
+	s.mu.Lock()
+	s.name = operationName
+	s.mu.Unlock()
+	return s
+}
+
+func (s *Span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	s.setTag(key, value)
+	s.mu.Unlock()
+	return s
+}
+
+func (s *Span) setTag(key string, value interface{}) {
+	switch key {
+	case string(ext.SpanKind):
+		s.kind = spanKind(value)
+	case string(ext.Error):
+		if v, ok := value.(bool); ok {
+			s.failed = v
+		}
+	default:
+		s.attributes[key] = value
+	}
+}
+
+func spanKind(value interface{}) int {
+	switch fmt.Sprint(value) {
+	case string(ext.SpanKindRPCServerEnum):
+		return kindServer
+	case string(ext.SpanKindRPCClientEnum):
+		return kindClient
+	case string(ext.SpanKindProducerEnum):
+		return kindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return kindConsumer
+	}
+	return kindInternal
+}
+
+func (s *Span) LogFields(fields ...log.Field) {
+	s.mu.Lock()
+	s.addEvent(time.Now(), fields)
+	s.mu.Unlock()
+}
+
+// addEvent records fields as a span event, the "event" field is used as the
+// name of the event when it is present.
+func (s *Span) addEvent(t time.Time, fields []log.Field) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	e := event{time: t, name: "log", attributes: make(map[string]interface{}, len(fields))}
+	for _, field := range fields {
+		if field.Key() == "event" {
+			e.name = fmt.Sprint(field.Value())
+			continue
+		}
+		e.attributes[field.Key()] = field.Value()
+	}
+	s.events = append(s.events, e)
+}
+
+func (s *Span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *Span) SetBaggageItem(restrictedKey, value string) opentracing.Span { return s }
+func (*Span) BaggageItem(restrictedKey string) string                       { return "" }
+func (s *Span) Tracer() opentracing.Tracer                                  { return s.tr }
+func (s *Span) LogEvent(event string)                                       { s.LogFields(log.String("event", event)) }
+func (s *Span) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(log.String("event", event), log.Object("payload", payload))
+}
+func (s *Span) Log(data opentracing.LogData) {
+	s.LogFields(data.ToLogRecord().Fields...)
+}
+
+type otelTracer struct {
+	batcher *batcher
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newTracer(b *batcher) *otelTracer {
+	return &otelTracer{
+		batcher: b,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (t *otelTracer) randomID(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		t.rand.Read(b)
+		for _, v := range b {
+			if v != 0 {
+				return
+			}
+		}
+	}
+}
+
+func (t *otelTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var o opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+
+	s := &Span{
+		tr:         t,
+		name:       operationName,
+		kind:       kindInternal,
+		start:      o.StartTime,
+		attributes: make(map[string]interface{}, len(o.Tags)),
+	}
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+
+	var parent *spanContext
+	for _, ref := range o.References {
+		if sc, ok := ref.ReferencedContext.(spanContext); ok {
+			parent = &sc
+			break
+		}
+	}
+	if parent != nil {
+		s.ctx = spanContext{traceID: parent.traceID, sampled: parent.sampled, traceState: parent.traceState}
+		s.parentID = parent.spanID
+	} else {
+		s.ctx.sampled = true
+		t.randomID(s.ctx.traceID[:])
+	}
+	t.randomID(s.ctx.spanID[:])
+
+	for k, v := range o.Tags {
+		s.setTag(k, v)
+	}
+	return s
+}
+
+func (t *otelTracer) Inject(ctx opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := ctx.(spanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return opentracing.ErrUnsupportedFormat
+	}
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	w.Set(traceparentHeader, formatTraceparent(sc))
+	if sc.traceState != "" {
+		w.Set(tracestateHeader, sc.traceState)
+	}
+	return nil
+}
+
+func (t *otelTracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format != opentracing.HTTPHeaders && format != opentracing.TextMap {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+	var traceparent, tracestate string
+	err := r.ForeachKey(func(key, val string) error {
+		switch strings.ToLower(key) {
+		case traceparentHeader:
+			traceparent = val
+		case tracestateHeader:
+			tracestate = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if traceparent == "" {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	sc, err := parseTraceparent(traceparent)
+	if err != nil {
+		return nil, err
+	}
+	sc.traceState = tracestate
+	return sc, nil
+}
+
+func formatTraceparent(sc spanContext) string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent parses a version-format-traceid-parentid-flags header.
+// Fields appended by future versions are ignored as required by the spec.
+func parseTraceparent(v string) (spanContext, error) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || sc.traceID == [16]byte{} {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || sc.spanID == [8]byte{} {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Tracer is a tyk tracer that exports spans to an OpenTelemetry collector
+// using OTLP.
+type Tracer struct {
+	opentracing.Tracer
+	batcher *batcher
+}
+
+func (Tracer) Name() string {
+	return Name
+}
+
+// Close flushes pending spans and closes the exporter.
+func (t *Tracer) Close() error {
+	return t.batcher.close()
+}
+
+type Logger interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Init returns an implementation of tyk.Tracer exporting to an OpenTelemetry
+// collector with service as the service.name resource attribute.
+func Init(service string, opts map[string]interface{}, logger Logger) (*Tracer, error) {
+	c, err := Load(opts)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := newExporter(c)
+	if err != nil {
+		return nil, err
+	}
+	b := newBatcher(service, exp, c.BatchSize, time.Duration(c.Timeout)*time.Second, logger)
+	return &Tracer{Tracer: newTracer(b), batcher: b}, nil
+}
@@ -0,0 +1,141 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := parseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.sampled || hex.EncodeToString(sc.traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(sc.spanID[:]) != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span context %#v", sc)
+	}
+	if got := formatTraceparent(sc); got != valid {
+		t.Errorf("expected %s got %s", valid, got)
+	}
+
+	if _, err := parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Error("fields of future versions should be ignored:", err)
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := parseTraceparent(v); err != opentracing.ErrSpanContextCorrupted {
+			t.Errorf("expected %q to be rejected, got %v", v, err)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tr := newTracer(nil)
+
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set("tracestate", "vendor=value")
+	parent, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := tr.StartSpan("child", opentracing.ChildOf(parent)).(*Span)
+	out := http.Header{}
+	if err := tr.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + hex.EncodeToString(span.ctx.spanID[:]) + "-01"
+	if out.Get("traceparent") != want || out.Get("tracestate") != "vendor=value" {
+		t.Errorf("unexpected headers %v", out)
+	}
+	if hex.EncodeToString(span.parentID[:]) != "00f067aa0ba902b7" {
+		t.Errorf("expected the extracted span to be the parent, got %x", span.parentID)
+	}
+
+	if _, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("expected %v got %v", opentracing.ErrSpanContextNotFound, err)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("X-Api-Key") != "secret" {
+			t.Errorf("unexpected export %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	tr, err := Init("test-service", map[string]interface{}{
+		"exporter": "http",
+		"endpoint": collector.URL,
+		"headers":  map[string]string{"X-Api-Key": "secret"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := tr.StartSpan("root")
+	child := tr.StartSpan("child", opentracing.ChildOf(root.Context()))
+	ext.SpanKindRPCClient.Set(child)
+	ext.Error.Set(child, true)
+	child.SetTag("tyk.api.id", "api-1")
+	child.LogKV("event", "retry", "attempt", 2)
+	child.Finish()
+	root.Finish()
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-bodies
+	rootSpan, childSpan := root.(*Span), child.(*Span)
+	if childSpan.ctx.traceID != rootSpan.ctx.traceID || childSpan.parentID != rootSpan.ctx.spanID {
+		t.Error("the child span should belong to the root span")
+	}
+	if childSpan.kind != kindClient || !childSpan.failed || len(childSpan.events) != 1 || childSpan.events[0].name != "retry" {
+		t.Errorf("unexpected child span %+v", childSpan)
+	}
+	for _, want := range [][]byte{
+		[]byte("test-service"), []byte("root"), []byte("child"), []byte("tyk.api.id"), []byte("api-1"),
+		rootSpan.ctx.traceID[:], rootSpan.ctx.spanID[:], childSpan.ctx.spanID[:],
+	} {
+		if !bytes.Contains(body, want) {
+			t.Errorf("expected the export to contain %q", want)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	if _, err := Init("test", map[string]interface{}{"exporter": "kafka"}, nil); err == nil {
+		t.Error("expected unknown exporters to fail")
+	}
+
+	tr, err := Init("test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if tr.Name() != Name {
+		t.Errorf("expected %s got %s", Name, tr.Name())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/TykTechnologies/tyk/trace/jaeger"
+	"github.com/TykTechnologies/tyk/trace/opentelemetry"
 	"github.com/TykTechnologies/tyk/trace/openzipkin"
 	opentracing "github.com/opentracing/opentracing-go"
 )
@@ -38,6 +39,8 @@ func Init(name string, service string, opts map[string]interface{}, logger Logge
 		return jaeger.Init(service, opts, logger)
 	case openzipkin.Name:
 		return openzipkin.Init(service, opts)
+	case opentelemetry.Name:
+		return opentelemetry.Init(service, opts, logger)
 	default:
 		return NoopTracer{}, nil
 	}
@@ -104,6 +104,7 @@ type SessionState struct {
 	OauthClientID                 string                      `json:"oauth_client_id" msg:"oauth_client_id"`
 	OauthKeys                     map[string]string           `json:"oauth_keys" msg:"oauth_keys"`
 	Certificate                   string                      `json:"certificate" msg:"certificate"`
+	CertificateBinding            string                      `json:"certificate_binding" msg:"certificate_binding"`
 	BasicAuthData                 BasicAuthData               `json:"basic_auth_data" msg:"basic_auth_data"`
 	JWTData                       JWTData                     `json:"jwt_data" msg:"jwt_data"`
 	HMACEnabled                   bool                        `json:"hmac_enabled" msg:"hmac_enabled"`
@@ -125,6 +126,12 @@ type SessionState struct {
 	LastUpdated             string                 `json:"last_updated" msg:"last_updated"`
 	IdExtractorDeadline     int64                  `json:"id_extractor_deadline" msg:"id_extractor_deadline"`
 	SessionLifetime         int64                  `bson:"session_lifetime" json:"session_lifetime"`
+	// CounterKeyHash is set on keys issued by a rotation and holds the hash
+	// of the original key, so that both keys share quota and rate counters.
+	CounterKeyHash string `json:"counter_key_hash,omitempty" msg:"counter_key_hash"`
+	// RotationExpires is set on keys replaced by a rotation and holds the
+	// end of their grace period, the key is not stored past it.
+	RotationExpires int64 `json:"rotation_expires,omitempty" msg:"rotation_expires"`
 
 	// Used to store token hash
 	keyHash string
@@ -156,6 +163,7 @@ func (s *SessionState) Clone() SessionState {
 		OauthClientID:                 s.OauthClientID,
 		OauthKeys:                     cloneKeys(s.OauthKeys),
 		Certificate:                   s.Certificate,
+		CertificateBinding:            s.CertificateBinding,
 		BasicAuthData:                 s.BasicAuthData,
 		JWTData:                       s.JWTData,
 		HMACEnabled:                   s.HMACEnabled,
@@ -175,6 +183,8 @@ func (s *SessionState) Clone() SessionState {
 		LastUpdated:                   s.LastUpdated,
 		IdExtractorDeadline:           s.IdExtractorDeadline,
 		SessionLifetime:               s.SessionLifetime,
+		CounterKeyHash:                s.CounterKeyHash,
+		RotationExpires:               s.RotationExpires,
 		// Used to store token hash
 		keyHash: s.keyHash,
 		KeyID:   s.KeyID,
@@ -273,6 +283,23 @@ func (s *SessionState) KeyHashEmpty() bool {
 }
 
 func (s *SessionState) Lifetime(fallback int64) int64 {
+	lifetime := s.lifetime(fallback)
+	if s.RotationExpires <= 0 {
+		return lifetime
+	}
+
+	// keys replaced by a rotation must be gone once their grace period ends
+	remaining := s.RotationExpires - time.Now().Unix()
+	if remaining < 1 {
+		remaining = 1
+	}
+	if lifetime <= 0 || lifetime > remaining {
+		return remaining
+	}
+	return lifetime
+}
+
+func (s *SessionState) lifetime(fallback int64) int64 {
 	if config.Global().ForceGlobalSessionLifetime {
 		return config.Global().GlobalSessionLifetime
 	}
@@ -339,6 +366,16 @@ func (s *SessionState) GetKeyHash() string {
 	return s.keyHash
 }
 
+// GetCounterKeyHash returns the hash used to key quota and rate limit
+// counters. Rotated keys keep counting against the key they replaced.
+func (s *SessionState) GetCounterKeyHash() string {
+	if s.CounterKeyHash != "" {
+		return s.CounterKeyHash
+	}
+
+	return s.GetKeyHash()
+}
+
 func (s *SessionState) SetPolicies(ids ...string) {
 	s.ApplyPolicyID = ""
 	s.ApplyPolicies = ids